@@ -0,0 +1,33 @@
+##@ Development
+
+CONTROLLER_GEN_VERSION ?= v0.19.0
+
+.PHONY: generate
+generate: ## Generates the deepcopy functions and the CRDs of the API.
+	@echo "====> $@"
+	go run sigs.k8s.io/controller-tools/cmd/controller-gen@$(CONTROLLER_GEN_VERSION) \
+		object:headerFile=hack/boilerplate.go.txt \
+		crd output:crd:artifacts:config=helm/upgrade-schedule-operator/crds \
+		paths=./api/...
+
+##@ Plugin
+
+.PHONY: build-plugin
+build-plugin: ## Builds the kubectl upgrade-schedule plugin.
+	@echo "====> $@"
+	CGO_ENABLED=0 go build -trimpath -ldflags "$(LDFLAGS)" -o kubectl-upgrade_schedule ./cmd/kubectl-upgrade_schedule
+
+.PHONY: install-plugin
+install-plugin: ## Installs the kubectl upgrade-schedule plugin.
+	@echo "====> $@"
+	go install -ldflags "$(LDFLAGS)" ./cmd/kubectl-upgrade_schedule
+
+##@ Test
+
+ENVTEST_K8S_VERSION ?= 1.34.x
+
+.PHONY: test-integration
+test-integration: ## Runs the envtest based integration tests.
+	@echo "====> $@"
+	KUBEBUILDER_ASSETS="$$(go run sigs.k8s.io/controller-runtime/tools/setup-envtest@release-0.22 use $(ENVTEST_K8S_VERSION) -p path)" \
+		go test -tags integration -count=1 ./tests/integration/...
@@ -0,0 +1,79 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// UpgradeFreezeSpec selects the scheduled upgrades frozen by an
+// UpgradeFreeze. An upgrade is frozen if it matches all of the set fields.
+type UpgradeFreezeSpec struct {
+	// TargetReleases are the frozen target release versions, e.g. 15.2.1.
+	// Upgrades to all releases are frozen if it is empty.
+	// +optional
+	TargetReleases []string `json:"targetReleases,omitempty"`
+	// Providers are the infrastructure providers of the frozen clusters,
+	// e.g. aws. Clusters of all providers are frozen if it is empty.
+	// +optional
+	Providers []string `json:"providers,omitempty"`
+	// ClusterSelector selects the frozen clusters by their labels, e.g. by
+	// region. All clusters are frozen if it is not set.
+	// +optional
+	ClusterSelector *metav1.LabelSelector `json:"clusterSelector,omitempty"`
+	// ReplacementRelease is the release version frozen upgrades are
+	// retargeted to instead of being blocked, e.g. 15.2.2.
+	// +optional
+	ReplacementRelease string `json:"replacementRelease,omitempty"`
+	// Reason explains the freeze in the events of the frozen clusters.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+	// Until is the time the freeze is lifted at. The freeze applies until it
+	// is deleted if it is not set.
+	// +optional
+	Until *metav1.Time `json:"until,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster,categories=giantswarm
+// +kubebuilder:printcolumn:name="Releases",type=string,JSONPath=`.spec.targetReleases`
+// +kubebuilder:printcolumn:name="Providers",type=string,JSONPath=`.spec.providers`
+// +kubebuilder:printcolumn:name="Replacement",type=string,JSONPath=`.spec.replacementRelease`
+// +kubebuilder:printcolumn:name="Until",type=date,JSONPath=`.spec.until`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// UpgradeFreeze blocks or retargets the scheduled upgrades of an
+// installation to specific releases or of specific providers or clusters.
+type UpgradeFreeze struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec UpgradeFreezeSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// UpgradeFreezeList contains a list of UpgradeFreeze
+type UpgradeFreezeList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []UpgradeFreeze `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&UpgradeFreeze{}, &UpgradeFreezeList{})
+}
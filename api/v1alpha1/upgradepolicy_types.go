@@ -0,0 +1,119 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Weekday is a day of the week, e.g. Monday.
+// +kubebuilder:validation:Enum=Monday;Tuesday;Wednesday;Thursday;Friday;Saturday;Sunday
+type Weekday string
+
+// VersionBump is the most significant part of the release version changed by
+// an upgrade.
+// +kubebuilder:validation:Enum=major;minor;patch
+type VersionBump string
+
+const (
+	VersionBumpMajor VersionBump = "major"
+	VersionBumpMinor VersionBump = "minor"
+	VersionBumpPatch VersionBump = "patch"
+)
+
+// HourWindow is a window of hours of the day in UTC. A window with an end
+// before its start spans midnight, e.g. 22 to 4.
+type HourWindow struct {
+	// Start is the first hour of the window.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=23
+	Start int32 `json:"start"`
+	// End is the hour the window ends at, it is not part of the window.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=24
+	End int32 `json:"end"`
+}
+
+// UpgradePolicySpec constrains the upgrades that can be scheduled for the
+// clusters in the namespace of the policy. Unset fields do not constrain
+// upgrades.
+type UpgradePolicySpec struct {
+	// AllowedDays are the days of the week in UTC upgrades can be scheduled
+	// on.
+	// +optional
+	AllowedDays []Weekday `json:"allowedDays,omitempty"`
+	// AllowedHours is the window of hours of the day in UTC upgrades can be
+	// scheduled in.
+	// +optional
+	AllowedHours *HourWindow `json:"allowedHours,omitempty"`
+	// MinimumNotice is the minimum time between scheduling an upgrade and
+	// the upgrade time. It defaults to and can not be less than 16 minutes.
+	// +optional
+	MinimumNotice *metav1.Duration `json:"minimumNotice,omitempty"`
+	// MaximumHorizon is the maximum time between scheduling an upgrade and
+	// the upgrade time. It defaults to six months.
+	// +optional
+	MaximumHorizon *metav1.Duration `json:"maximumHorizon,omitempty"`
+	// AllowedBumps are the version bumps upgrades can make.
+	// +optional
+	AllowedBumps []VersionBump `json:"allowedBumps,omitempty"`
+	// RequiredApprovals is the number of approvals required for upgrades of
+	// production clusters. It defaults to 1.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	RequiredApprovals *int32 `json:"requiredApprovals,omitempty"`
+	// MaxConcurrentUpgrades is the maximum number of clusters in the
+	// namespace upgraded at the same time. Further upgrades are held back
+	// until a running upgrade completed.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxConcurrentUpgrades *int32 `json:"maxConcurrentUpgrades,omitempty"`
+	// EndOfLifeUpgrades allows the operator to schedule upgrades of clusters
+	// running a release that reached its end of life to the oldest supported
+	// release.
+	// +optional
+	EndOfLifeUpgrades *bool `json:"endOfLifeUpgrades,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:categories=giantswarm
+// +kubebuilder:printcolumn:name="Days",type=string,JSONPath=`.spec.allowedDays`
+// +kubebuilder:printcolumn:name="Approvals",type=integer,JSONPath=`.spec.requiredApprovals`
+// +kubebuilder:printcolumn:name="Concurrency",type=integer,JSONPath=`.spec.maxConcurrentUpgrades`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// UpgradePolicy is the upgrade policy of the clusters of an organization. It
+// applies to all clusters in its namespace.
+type UpgradePolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec UpgradePolicySpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// UpgradePolicyList contains a list of UpgradePolicy
+type UpgradePolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []UpgradePolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&UpgradePolicy{}, &UpgradePolicyList{})
+}
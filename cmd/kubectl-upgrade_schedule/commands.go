@@ -0,0 +1,402 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/giantswarm/k8smetadata/pkg/annotation"
+	"github.com/giantswarm/k8smetadata/pkg/label"
+	"github.com/pkg/errors"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/giantswarm/upgrade-schedule-operator/controllers"
+)
+
+// localTimeFormat is used to show times in the local time zone of the user.
+const localTimeFormat = "Mon, 02 Jan 2006 15:04 MST"
+
+// now is replaced in tests.
+var now = time.Now
+
+// schedule is the upgrade scheduled for a cluster as shown by list and
+// describe.
+type schedule struct {
+	Namespace        string     `json:"namespace"`
+	Cluster          string     `json:"cluster"`
+	Release          string     `json:"release"`
+	TargetRelease    string     `json:"targetRelease"`
+	UpgradeTime      *time.Time `json:"upgradeTime,omitempty"`
+	AnnouncementTime *time.Time `json:"announcementTime,omitempty"`
+	Announced        bool       `json:"announced"`
+	ApprovedBy       []string   `json:"approvedBy,omitempty"`
+	Errors           []string   `json:"errors,omitempty"`
+}
+
+func newSchedule(cluster *capi.Cluster, announcementOffset time.Duration) schedule {
+	s := schedule{
+		Namespace:     cluster.Namespace,
+		Cluster:       cluster.Name,
+		Release:       cluster.Labels[label.ReleaseVersion],
+		TargetRelease: cluster.Annotations[annotation.UpdateScheduleTargetRelease],
+	}
+	_, s.Announced = cluster.Annotations[controllers.ClusterUpgradeAnnouncement]
+	if approvedBy := controllers.ParseApprovers(cluster.Annotations[controllers.ClusterUpgradeApprovedBy]); len(approvedBy) > 0 {
+		s.ApprovedBy = approvedBy
+	}
+
+	upgradeTime, err := controllers.ParseUpgradeTime(cluster.Annotations[annotation.UpdateScheduleTargetTime])
+	if err != nil {
+		s.Errors = append(s.Errors, err.Error())
+	} else {
+		announcementTime := upgradeTime.Add(-announcementOffset)
+		s.UpgradeTime = &upgradeTime
+		s.AnnouncementTime = &announcementTime
+	}
+	if s.TargetRelease == "" {
+		s.Errors = append(s.Errors, fmt.Sprintf("no target release version set via annotation %s", annotation.UpdateScheduleTargetRelease))
+	} else if _, err := controllers.ParseTargetVersion(s.TargetRelease); err != nil {
+		s.Errors = append(s.Errors, err.Error())
+	}
+	return s
+}
+
+func runSet(o *options, args []string) error {
+	name, err := clusterArg(args)
+	if err != nil {
+		return err
+	}
+	if o.release == "" {
+		return errors.New("--release is required")
+	}
+	if err := o.connect(); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if err := o.loadAnnouncementOffset(ctx); err != nil {
+		return err
+	}
+	cluster := &capi.Cluster{}
+	if err := o.client.Get(ctx, client.ObjectKey{Namespace: o.namespace, Name: name}, cluster); err != nil {
+		return errors.Wrapf(err, "failed to get cluster %s/%s", o.namespace, name)
+	}
+
+	policy, err := controllers.GetEffectivePolicy(ctx, o.client, o.namespace)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get upgrade policy of namespace %s", o.namespace)
+	}
+	upgradeTime, err := validatePlan(o, cluster, policy)
+	if err != nil {
+		return err
+	}
+
+	patch := client.MergeFrom(cluster.DeepCopy())
+	if cluster.Annotations == nil {
+		cluster.Annotations = map[string]string{}
+	}
+	cluster.Annotations[annotation.UpdateScheduleTargetRelease] = o.release
+	cluster.Annotations[annotation.UpdateScheduleTargetTime] = controllers.FormatUpgradeTime(upgradeTime)
+	cluster.Annotations[controllers.ClusterUpgradeScheduledAt] = now().UTC().Format(time.RFC3339)
+	// A rescheduled upgrade has to be announced and approved again.
+	delete(cluster.Annotations, controllers.ClusterUpgradeAnnouncement)
+	delete(cluster.Annotations, controllers.ClusterUpgradeApprovedBy)
+	if err := o.client.Patch(ctx, cluster, patch); err != nil {
+		return errors.Wrapf(err, "failed to schedule upgrade of cluster %s/%s", o.namespace, name)
+	}
+
+	fmt.Fprintf(o.out, "Scheduled upgrade of cluster %s/%s to release %s.\n\n", o.namespace, name, o.release)
+	printPlan(o, upgradeTime)
+	return nil
+}
+
+func runCancel(o *options, args []string) error {
+	name, err := clusterArg(args)
+	if err != nil {
+		return err
+	}
+	if err := o.connect(); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	cluster := &capi.Cluster{}
+	if err := o.client.Get(ctx, client.ObjectKey{Namespace: o.namespace, Name: name}, cluster); err != nil {
+		return errors.Wrapf(err, "failed to get cluster %s/%s", o.namespace, name)
+	}
+	if cluster.Annotations[annotation.UpdateScheduleTargetTime] == "" && cluster.Annotations[annotation.UpdateScheduleTargetRelease] == "" {
+		fmt.Fprintf(o.out, "Cluster %s/%s has no upgrade scheduled.\n", o.namespace, name)
+		return nil
+	}
+
+	patch := client.MergeFrom(cluster.DeepCopy())
+	delete(cluster.Annotations, annotation.UpdateScheduleTargetTime)
+	delete(cluster.Annotations, annotation.UpdateScheduleTargetRelease)
+	delete(cluster.Annotations, controllers.ClusterUpgradeScheduledAt)
+	delete(cluster.Annotations, controllers.ClusterUpgradeAnnouncement)
+	delete(cluster.Annotations, controllers.ClusterUpgradeApprovedBy)
+	if err := o.client.Patch(ctx, cluster, patch); err != nil {
+		return errors.Wrapf(err, "failed to cancel upgrade of cluster %s/%s", o.namespace, name)
+	}
+
+	fmt.Fprintf(o.out, "Cancelled upgrade of cluster %s/%s.\n", o.namespace, name)
+	return nil
+}
+
+func runApprove(o *options, args []string) error {
+	name, err := clusterArg(args)
+	if err != nil {
+		return err
+	}
+	if err := o.connect(); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	cluster := &capi.Cluster{}
+	if err := o.client.Get(ctx, client.ObjectKey{Namespace: o.namespace, Name: name}, cluster); err != nil {
+		return errors.Wrapf(err, "failed to get cluster %s/%s", o.namespace, name)
+	}
+	if cluster.Annotations[annotation.UpdateScheduleTargetTime] == "" {
+		return errors.Errorf("cluster %s/%s has no upgrade scheduled", o.namespace, name)
+	}
+
+	// Approvals are bound to the identity of the caller as seen by the API
+	// server, the audit webhook rejects approvals on behalf of others.
+	review := &authenticationv1.SelfSubjectReview{}
+	if err := o.client.Create(ctx, review); err != nil {
+		return errors.Wrap(err, "failed to determine the current user")
+	}
+	user := review.Status.UserInfo.Username
+	if user == "" {
+		return errors.New("failed to determine the current user")
+	}
+	if user == cluster.Annotations[controllers.ClusterUpgradeRequestedBy] {
+		return errors.Errorf("%s scheduled the upgrade of cluster %s/%s and can not approve it", user, o.namespace, name)
+	}
+
+	approvedBy := controllers.ParseApprovers(cluster.Annotations[controllers.ClusterUpgradeApprovedBy])
+	if slices.Contains(approvedBy, user) {
+		fmt.Fprintf(o.out, "Upgrade of cluster %s/%s is already approved by %s.\n", o.namespace, name, user)
+		return nil
+	}
+
+	patch := client.MergeFrom(cluster.DeepCopy())
+	cluster.Annotations[controllers.ClusterUpgradeApprovedBy] = strings.Join(append(approvedBy, user), ",")
+	if err := o.client.Patch(ctx, cluster, patch); err != nil {
+		return errors.Wrapf(err, "failed to approve upgrade of cluster %s/%s", o.namespace, name)
+	}
+
+	fmt.Fprintf(o.out, "Approved upgrade of cluster %s/%s as %s.\n", o.namespace, name, user)
+	return nil
+}
+
+func runList(o *options, args []string) error {
+	if len(args) != 0 {
+		return errors.New("list does not take arguments")
+	}
+	if err := o.loadAnnouncementOffset(context.Background()); err != nil {
+		return err
+	}
+
+	var opts []client.ListOption
+	if !o.allNamespaces {
+		opts = append(opts, client.InNamespace(o.namespace))
+	}
+	clusters := &capi.ClusterList{}
+	if err := o.client.List(context.Background(), clusters, opts...); err != nil {
+		return errors.Wrap(err, "failed to list clusters")
+	}
+
+	schedules := []schedule{}
+	for i := range clusters.Items {
+		if clusters.Items[i].Annotations[annotation.UpdateScheduleTargetTime] == "" {
+			continue
+		}
+		schedules = append(schedules, newSchedule(&clusters.Items[i], o.announcementOffset))
+	}
+
+	if o.output == "json" {
+		return printJSON(o, schedules)
+	}
+	if len(schedules) == 0 {
+		fmt.Fprintln(o.out, "No scheduled upgrades found.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(o.out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tNAME\tRELEASE\tTARGET\tUPGRADE TIME (UTC)\tLOCAL TIME\tIN\tANNOUNCED")
+	for _, s := range schedules {
+		utc, local, in := "<invalid>", "<invalid>", "<invalid>"
+		if s.UpgradeTime != nil {
+			utc = controllers.FormatUpgradeTime(*s.UpgradeTime)
+			local = s.UpgradeTime.Local().Format(localTimeFormat)
+			in = until(*s.UpgradeTime)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%t\n", s.Namespace, s.Cluster, s.Release, s.TargetRelease, utc, local, in, s.Announced)
+	}
+	return w.Flush()
+}
+
+func runDescribe(o *options, args []string) error {
+	name, err := clusterArg(args)
+	if err != nil {
+		return err
+	}
+	if err := o.loadAnnouncementOffset(context.Background()); err != nil {
+		return err
+	}
+
+	cluster := &capi.Cluster{}
+	if err := o.client.Get(context.Background(), client.ObjectKey{Namespace: o.namespace, Name: name}, cluster); err != nil {
+		return errors.Wrapf(err, "failed to get cluster %s/%s", o.namespace, name)
+	}
+	if cluster.Annotations[annotation.UpdateScheduleTargetTime] == "" {
+		fmt.Fprintf(o.out, "Cluster %s/%s has no upgrade scheduled.\n", o.namespace, name)
+		return nil
+	}
+
+	s := newSchedule(cluster, o.announcementOffset)
+	if o.output == "json" {
+		return printJSON(o, s)
+	}
+
+	w := tabwriter.NewWriter(o.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Cluster:\t%s/%s\n", s.Namespace, s.Cluster)
+	fmt.Fprintf(w, "Release:\t%s\n", s.Release)
+	fmt.Fprintf(w, "Target release:\t%s\n", s.TargetRelease)
+	if s.UpgradeTime != nil {
+		fmt.Fprintf(w, "Announcement time:\t%s\t(%s)\n", controllers.FormatUpgradeTime(*s.AnnouncementTime), s.AnnouncementTime.Local().Format(localTimeFormat))
+		fmt.Fprintf(w, "Upgrade time:\t%s\t(%s)\n", controllers.FormatUpgradeTime(*s.UpgradeTime), s.UpgradeTime.Local().Format(localTimeFormat))
+		fmt.Fprintf(w, "Upgrade in:\t%s\n", until(*s.UpgradeTime))
+	}
+	fmt.Fprintf(w, "Announced:\t%t\n", s.Announced)
+	if len(s.ApprovedBy) > 0 {
+		fmt.Fprintf(w, "Approved by:\t%s\n", strings.Join(s.ApprovedBy, ", "))
+	}
+	for _, e := range s.Errors {
+		fmt.Fprintf(w, "Error:\t%s\n", e)
+	}
+	return w.Flush()
+}
+
+func runPlan(o *options, args []string) error {
+	if len(args) > 1 {
+		return errors.New("at most one cluster name is allowed")
+	}
+
+	ctx := context.Background()
+	if err := o.loadAnnouncementOffset(ctx); err != nil {
+		return err
+	}
+	var cluster *capi.Cluster
+	var policy controllers.EffectivePolicy
+	if len(args) == 1 {
+		if err := o.connect(); err != nil {
+			return err
+		}
+		cluster = &capi.Cluster{}
+		if err := o.client.Get(ctx, client.ObjectKey{Namespace: o.namespace, Name: args[0]}, cluster); err != nil {
+			return errors.Wrapf(err, "failed to get cluster %s/%s", o.namespace, args[0])
+		}
+		var err error
+		policy, err = controllers.GetEffectivePolicy(ctx, o.client, o.namespace)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get upgrade policy of namespace %s", o.namespace)
+		}
+	}
+
+	upgradeTime, err := validatePlan(o, cluster, policy)
+	if err != nil {
+		return err
+	}
+
+	printPlan(o, upgradeTime)
+	if cluster != nil && o.release != "" {
+		fmt.Fprintf(o.out, "\nThe cluster %s/%s would be upgraded from release %s to %s.\n", cluster.Namespace, cluster.Name, cluster.Labels[label.ReleaseVersion], o.release)
+	}
+	return nil
+}
+
+// validatePlan resolves the upgrade time from the flags and validates it as
+// well as the target release against the cluster if given. It applies the
+// same upgrade policy as the operator.
+func validatePlan(o *options, cluster *capi.Cluster, policy controllers.EffectivePolicy) (time.Time, error) {
+	var upgradeTime time.Time
+	switch {
+	case o.time != "" && o.in != "":
+		return time.Time{}, errors.New("only one of --time and --in can be set")
+	case o.time != "":
+		t, err := controllers.ParseUpgradeTime(o.time)
+		if err != nil {
+			return time.Time{}, err
+		}
+		upgradeTime = t
+	case o.in != "":
+		d, err := time.ParseDuration(o.in)
+		if err != nil {
+			return time.Time{}, errors.Wrapf(err, "invalid duration %q", o.in)
+		}
+		// The annotation has minute precision, round up to not undercut
+		// the requested duration.
+		upgradeTime = now().UTC().Add(d).Add(time.Minute - time.Nanosecond).Truncate(time.Minute)
+	default:
+		return time.Time{}, errors.New("one of --time and --in is required")
+	}
+
+	bump := ""
+	if o.release != "" {
+		targetVersion, err := controllers.ParseTargetVersion(o.release)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if cluster != nil {
+			currentVersion, err := controllers.ParseTargetVersion(cluster.Labels[label.ReleaseVersion])
+			if err != nil {
+				return time.Time{}, errors.Wrapf(err, "failed to parse current release version of cluster %s/%s", cluster.Namespace, cluster.Name)
+			}
+			if err := controllers.ValidateTargetVersion(*targetVersion, *currentVersion); err != nil {
+				return time.Time{}, err
+			}
+			bump = controllers.VersionBump(*currentVersion, *targetVersion)
+		}
+	}
+
+	policy.AnnouncementOffset = o.announcementOffset
+	if err := policy.Validate(upgradeTime, now(), bump); err != nil {
+		return time.Time{}, err
+	}
+
+	return upgradeTime, nil
+}
+
+func printPlan(o *options, upgradeTime time.Time) {
+	announcementTime := upgradeTime.Add(-o.announcementOffset)
+
+	w := tabwriter.NewWriter(o.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Annotation value:\t%s\n", controllers.FormatUpgradeTime(upgradeTime))
+	fmt.Fprintf(w, "Announcement time:\t%s\t(%s)\n", controllers.FormatUpgradeTime(announcementTime), announcementTime.Local().Format(localTimeFormat))
+	fmt.Fprintf(w, "Upgrade time:\t%s\t(%s)\n", controllers.FormatUpgradeTime(upgradeTime), upgradeTime.Local().Format(localTimeFormat))
+	fmt.Fprintf(w, "Upgrade in:\t%s\n", until(upgradeTime))
+	_ = w.Flush()
+}
+
+func printJSON(o *options, v interface{}) error {
+	enc := json.NewEncoder(o.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func until(t time.Time) string {
+	d := t.Sub(now()).Round(time.Minute)
+	if d < 0 {
+		return "due"
+	}
+	return d.String()
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	upgradev1alpha1 "github.com/giantswarm/upgrade-schedule-operator/api/v1alpha1"
+)
+
+func init() {
+	now = func() time.Time { return time.Date(2021, 9, 1, 12, 0, 0, 0, time.UTC) }
+}
+
+func newTestCluster(annotations map[string]string) *capi.Cluster {
+	return &capi.Cluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "dh82p",
+			Namespace: "org-acme",
+			Labels: map[string]string{
+				"release.giantswarm.io/version": "14.2.2",
+			},
+			Annotations: annotations,
+		},
+	}
+}
+
+func TestSet(t *testing.T) {
+	testCases := []struct {
+		name          string
+		release       string
+		time          string
+		in            string
+		policy        *upgradev1alpha1.UpgradePolicySpec
+		expectedErr   string
+		expectedValue string
+	}{
+		{
+			name:          "absolute time",
+			release:       "15.2.1",
+			time:          "05 Sep 21 08:00 UTC",
+			expectedValue: "05 Sep 21 08:00 UTC",
+		},
+		{
+			name:          "relative time",
+			release:       "15.2.1",
+			in:            "2h",
+			expectedValue: "01 Sep 21 14:00 UTC",
+		},
+		{
+			name:        "not in UTC",
+			release:     "15.2.1",
+			time:        "05 Sep 21 08:00 CET",
+			expectedErr: "UTC time zone",
+		},
+		{
+			name:        "too soon",
+			release:     "15.2.1",
+			in:          "10m",
+			expectedErr: "at least 16m0s in the future",
+		},
+		{
+			name:        "too late",
+			release:     "15.2.1",
+			time:        "05 Sep 22 08:00 UTC",
+			expectedErr: "more than 6 months in the future",
+		},
+		{
+			name:        "invalid release",
+			release:     "v15",
+			time:        "05 Sep 21 08:00 UTC",
+			expectedErr: "only the desired release version",
+		},
+		{
+			name:        "downgrade",
+			release:     "14.0.0",
+			time:        "05 Sep 21 08:00 UTC",
+			expectedErr: "has to be higher than the current release version",
+		},
+		{
+			name:          "within upgrade policy",
+			release:       "14.3.0",
+			time:          "07 Sep 21 08:00 UTC",
+			policy:        &upgradev1alpha1.UpgradePolicySpec{AllowedDays: []upgradev1alpha1.Weekday{"Tuesday"}, AllowedBumps: []upgradev1alpha1.VersionBump{"minor"}},
+			expectedValue: "07 Sep 21 08:00 UTC",
+		},
+		{
+			name:        "violates upgrade policy",
+			release:     "15.2.1",
+			time:        "05 Sep 21 08:00 UTC",
+			policy:      &upgradev1alpha1.UpgradePolicySpec{AllowedDays: []upgradev1alpha1.Weekday{"Tuesday"}, AllowedBumps: []upgradev1alpha1.VersionBump{"minor"}},
+			expectedErr: "upgrade policy acme: upgrade time 05 Sep 21 08:00 UTC is on a Sunday, upgrades are allowed on Tuesday; upgrade policy acme: major upgrades are not allowed",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cluster := newTestCluster(map[string]string{
+				"alpha.giantswarm.io/update-schedule-upgrade-announcement": "true",
+			})
+			objects := []client.Object{cluster}
+			if tc.policy != nil {
+				objects = append(objects, &upgradev1alpha1.UpgradePolicy{
+					ObjectMeta: metav1.ObjectMeta{Name: "acme", Namespace: cluster.Namespace},
+					Spec:       *tc.policy,
+				})
+			}
+			out := &bytes.Buffer{}
+			o := &options{
+				out:       out,
+				namespace: cluster.Namespace,
+				release:   tc.release,
+				time:      tc.time,
+				in:        tc.in,
+				client:    fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build(),
+			}
+
+			err := runSet(o, []string{cluster.Name})
+			if tc.expectedErr != "" {
+				assert.ErrorContains(t, err, tc.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+
+			obj := &capi.Cluster{}
+			assert.NoError(t, o.client.Get(context.Background(), client.ObjectKeyFromObject(cluster), obj))
+			assert.Equal(t, tc.release, obj.Annotations["alpha.giantswarm.io/update-schedule-target-release"])
+			assert.Equal(t, tc.expectedValue, obj.Annotations["alpha.giantswarm.io/update-schedule-target-time"])
+			assert.Equal(t, "2021-09-01T12:00:00Z", obj.Annotations["alpha.giantswarm.io/update-schedule-scheduled-at"])
+			assert.NotContains(t, obj.Annotations, "alpha.giantswarm.io/update-schedule-upgrade-announcement")
+			assert.Contains(t, out.String(), "Scheduled upgrade of cluster org-acme/dh82p to release "+tc.release)
+		})
+	}
+}
+
+func TestCancel(t *testing.T) {
+	cluster := newTestCluster(map[string]string{
+		"alpha.giantswarm.io/update-schedule-target-release":       "15.2.1",
+		"alpha.giantswarm.io/update-schedule-target-time":          "05 Sep 21 08:00 UTC",
+		"alpha.giantswarm.io/update-schedule-scheduled-at":         "2021-09-01T08:00:00Z",
+		"alpha.giantswarm.io/update-schedule-upgrade-announcement": "true",
+		"giantswarm.io/other":                                      "kept",
+	})
+	o := &options{
+		out:       &bytes.Buffer{},
+		namespace: cluster.Namespace,
+		client:    fake.NewClientBuilder().WithScheme(scheme).WithObjects(cluster).Build(),
+	}
+
+	assert.NoError(t, runCancel(o, []string{cluster.Name}))
+
+	obj := &capi.Cluster{}
+	assert.NoError(t, o.client.Get(context.Background(), client.ObjectKeyFromObject(cluster), obj))
+	assert.Equal(t, map[string]string{"giantswarm.io/other": "kept"}, obj.Annotations)
+}
+
+func TestApprove(t *testing.T) {
+	testCases := []struct {
+		name          string
+		approvedBy    string
+		expectedErr   string
+		expectedValue string
+	}{
+		{
+			name:          "first approval",
+			expectedValue: "john@acme.com",
+		},
+		{
+			name:          "additional approval",
+			approvedBy:    "jim@acme.com",
+			expectedValue: "jim@acme.com,john@acme.com",
+		},
+		{
+			name:          "already approved",
+			approvedBy:    "john@acme.com",
+			expectedValue: "john@acme.com",
+		},
+		{
+			name:        "requester",
+			expectedErr: "can not approve it",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			requestedBy := "jane@acme.com"
+			if tc.expectedErr != "" {
+				requestedBy = "john@acme.com"
+			}
+			annotations := map[string]string{
+				"alpha.giantswarm.io/update-schedule-target-release": "15.2.1",
+				"alpha.giantswarm.io/update-schedule-target-time":    "05 Sep 21 08:00 UTC",
+				"alpha.giantswarm.io/update-schedule-requested-by":   requestedBy,
+			}
+			if tc.approvedBy != "" {
+				annotations["alpha.giantswarm.io/update-schedule-approved-by"] = tc.approvedBy
+			}
+			cluster := newTestCluster(annotations)
+			o := &options{
+				out:       &bytes.Buffer{},
+				namespace: cluster.Namespace,
+				client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(cluster).WithInterceptorFuncs(interceptor.Funcs{
+					Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+						if review, ok := obj.(*authenticationv1.SelfSubjectReview); ok {
+							review.Status.UserInfo.Username = "john@acme.com"
+							return nil
+						}
+						return c.Create(ctx, obj, opts...)
+					},
+				}).Build(),
+			}
+
+			err := runApprove(o, []string{cluster.Name})
+			if tc.expectedErr != "" {
+				assert.ErrorContains(t, err, tc.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+
+			obj := &capi.Cluster{}
+			assert.NoError(t, o.client.Get(context.Background(), client.ObjectKeyFromObject(cluster), obj))
+			assert.Equal(t, tc.expectedValue, obj.Annotations["alpha.giantswarm.io/update-schedule-approved-by"])
+		})
+	}
+}
+
+func TestList(t *testing.T) {
+	scheduled := newTestCluster(map[string]string{
+		"alpha.giantswarm.io/update-schedule-target-release": "15.2.1",
+		"alpha.giantswarm.io/update-schedule-target-time":    "05 Sep 21 08:00 UTC",
+	})
+	invalid := newTestCluster(map[string]string{
+		"alpha.giantswarm.io/update-schedule-target-release": "15.2.1",
+		"alpha.giantswarm.io/update-schedule-target-time":    "tomorrow",
+	})
+	invalid.Namespace = "org-other"
+	unscheduled := newTestCluster(nil)
+	unscheduled.Name = "ga83x"
+
+	out := &bytes.Buffer{}
+	o := &options{
+		out:           out,
+		allNamespaces: true,
+		client:        fake.NewClientBuilder().WithScheme(scheme).WithObjects(scheduled, invalid, unscheduled).Build(),
+	}
+
+	assert.NoError(t, runList(o, nil))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 3)
+	assert.Contains(t, lines[1], "org-acme")
+	assert.Contains(t, lines[1], "05 Sep 21 08:00 UTC")
+	assert.Contains(t, lines[1], "92h0m0s")
+	assert.Contains(t, lines[2], "org-other")
+	assert.Contains(t, lines[2], "<invalid>")
+}
+
+func TestPlanAnnouncementOffset(t *testing.T) {
+	operatorConfig := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "upgrade-schedule-operator-config", Namespace: "giantswarm"},
+		Data: map[string]string{
+			"config.yaml": "apiVersion: config.upgrade-schedule-operator.giantswarm.io/v1alpha1\nkind: OperatorConfig\noperator:\n  announcementOffset: 1h\n",
+		},
+	}
+
+	testCases := []struct {
+		name               string
+		objects            []client.Object
+		getErr             error
+		announcementOffset time.Duration
+		in                 string
+		expectedErr        string
+		expectedOutput     string
+	}{
+		{
+			name:           "default offset without operator config",
+			in:             "2h",
+			expectedOutput: "01 Sep 21 13:45 UTC",
+		},
+		{
+			name:           "default offset if the operator config is forbidden",
+			objects:        []client.Object{operatorConfig},
+			getErr:         apierrors.NewForbidden(corev1.Resource("configmaps"), "upgrade-schedule-operator-config", errors.New("customer")),
+			in:             "2h",
+			expectedOutput: "01 Sep 21 13:45 UTC",
+		},
+		{
+			name:        "operator config not readable",
+			objects:     []client.Object{operatorConfig},
+			getErr:      apierrors.NewServiceUnavailable("unavailable"),
+			in:          "2h",
+			expectedErr: "failed to get operator config giantswarm/upgrade-schedule-operator-config",
+		},
+		{
+			name:           "offset of the operator config",
+			objects:        []client.Object{operatorConfig},
+			in:             "2h",
+			expectedOutput: "01 Sep 21 13:00 UTC",
+		},
+		{
+			name:        "minimum notice of the operator config",
+			objects:     []client.Object{operatorConfig},
+			in:          "30m",
+			expectedErr: "at least 1h1m0s in the future",
+		},
+		{
+			name:               "offset flag",
+			objects:            []client.Object{operatorConfig},
+			announcementOffset: 30 * time.Minute,
+			in:                 "2h",
+			expectedOutput:     "01 Sep 21 13:30 UTC",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			o := &options{
+				out:                out,
+				namespace:          "org-acme",
+				in:                 tc.in,
+				announcementOffset: tc.announcementOffset,
+				operatorConfig:     defaultOperatorConfig,
+				client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(tc.objects...).WithInterceptorFuncs(interceptor.Funcs{
+					Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+						if _, ok := obj.(*corev1.ConfigMap); ok && tc.getErr != nil {
+							return tc.getErr
+						}
+						return c.Get(ctx, key, obj, opts...)
+					},
+				}).Build(),
+			}
+
+			err := runPlan(o, nil)
+			if tc.expectedErr != "" {
+				assert.ErrorContains(t, err, tc.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Contains(t, out.String(), "Announcement time:  "+tc.expectedOutput)
+		})
+	}
+}
+
+func TestParseInterspersed(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	release := fs.String("release", "", "")
+	namespace := fs.String("n", "", "")
+
+	args, err := parseInterspersed(fs, []string{"-n", "org-acme", "dh82p", "--release", "15.2.1"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dh82p"}, args)
+	assert.Equal(t, "15.2.1", *release)
+	assert.Equal(t, "org-acme", *namespace)
+}
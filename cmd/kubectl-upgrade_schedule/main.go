@@ -0,0 +1,253 @@
+// Command kubectl-upgrade_schedule is a kubectl plugin to schedule and inspect
+// upgrades of workload clusters handled by the upgrade-schedule-operator.
+//
+// Install the binary anywhere in PATH and call it as kubectl upgrade-schedule.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
+	_ "k8s.io/client-go/plugin/pkg/client/auth"
+
+	upgradev1alpha1 "github.com/giantswarm/upgrade-schedule-operator/api/v1alpha1"
+	"github.com/giantswarm/upgrade-schedule-operator/util/config"
+)
+
+const usage = `Schedule and inspect upgrades of workload clusters.
+
+Usage:
+  kubectl upgrade-schedule <command> [flags]
+
+Commands:
+  set       Schedule an upgrade of a cluster
+  cancel    Cancel the scheduled upgrade of a cluster
+  approve   Approve the scheduled upgrade of a production cluster
+  list      List all scheduled upgrades
+  describe  Show the scheduled upgrade of a cluster
+  plan      Show when an upgrade would be announced and triggered without scheduling it
+
+Use "kubectl upgrade-schedule <command> -h" for more information about a command.
+`
+
+const (
+	// defaultOperatorConfig is the ConfigMap of the config file of the
+	// operator installed by its app.
+	defaultOperatorConfig = "giantswarm/upgrade-schedule-operator-config"
+	// operatorConfigKey is the key of the config file in the ConfigMap.
+	operatorConfigKey = "config.yaml"
+)
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(capi.AddToScheme(scheme))
+	utilruntime.Must(upgradev1alpha1.AddToScheme(scheme))
+}
+
+type command struct {
+	name  string
+	usage string
+	run   func(o *options, args []string) error
+}
+
+var commands = []command{
+	{name: "set", usage: "set CLUSTER --release VERSION (--time TIME | --in DURATION)", run: runSet},
+	{name: "cancel", usage: "cancel CLUSTER", run: runCancel},
+	{name: "approve", usage: "approve CLUSTER", run: runApprove},
+	{name: "list", usage: "list [-A]", run: runList},
+	{name: "describe", usage: "describe CLUSTER", run: runDescribe},
+	{name: "plan", usage: "plan [CLUSTER] [--release VERSION] (--time TIME | --in DURATION)", run: runPlan},
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, out io.Writer) error {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		fmt.Fprint(out, usage)
+		return nil
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != args[0] {
+			continue
+		}
+
+		o := &options{out: out}
+		fs := o.flagSet(cmd)
+		positional, err := parseInterspersed(fs, args[1:])
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		return cmd.run(o, positional)
+	}
+
+	return errors.Errorf("unknown command %q\n\n%s", args[0], usage)
+}
+
+// options holds the flags shared by all commands.
+type options struct {
+	out io.Writer
+
+	kubeconfig    string
+	context       string
+	namespace     string
+	allNamespaces bool
+	release       string
+	time          string
+	in            string
+	output        string
+
+	announcementOffset time.Duration
+	operatorConfig     string
+
+	client client.Client
+}
+
+func (o *options) flagSet(cmd command) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.SetOutput(o.out)
+	fs.Usage = func() {
+		fmt.Fprintf(o.out, "Usage:\n  kubectl upgrade-schedule %s [flags]\n\nFlags:\n", cmd.usage)
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&o.kubeconfig, "kubeconfig", "", "Path to the kubeconfig file to use.")
+	fs.StringVar(&o.context, "context", "", "The name of the kubeconfig context to use.")
+	fs.StringVar(&o.namespace, "namespace", "", "The namespace of the cluster. Defaults to the namespace of the current context.")
+	fs.StringVar(&o.namespace, "n", "", "Shorthand for --namespace.")
+
+	switch cmd.name {
+	case "list":
+		fs.BoolVar(&o.allNamespaces, "all-namespaces", false, "List scheduled upgrades in all namespaces.")
+		fs.BoolVar(&o.allNamespaces, "A", false, "Shorthand for --all-namespaces.")
+	case "set", "plan":
+		fs.StringVar(&o.release, "release", "", "The target release version, e.g. 15.2.1.")
+		fs.StringVar(&o.time, "time", "", "The upgrade time in RFC822 format and UTC, e.g. \"05 Sep 21 08:00 UTC\".")
+		fs.StringVar(&o.in, "in", "", "The upgrade time relative to now, e.g. 2h30m. Alternative to --time.")
+	}
+	if cmd.name != "cancel" && cmd.name != "approve" {
+		fs.DurationVar(&o.announcementOffset, "announcement-offset", 0, "How long before the upgrade time upgrades are announced. Read from the operator config if not set.")
+		fs.StringVar(&o.operatorConfig, "operator-config", defaultOperatorConfig, "The namespace/name of the ConfigMap containing the config file of the operator.")
+	}
+	if cmd.name == "list" || cmd.name == "describe" {
+		fs.StringVar(&o.output, "output", "", "Output format. One of: json.")
+		fs.StringVar(&o.output, "o", "", "Shorthand for --output.")
+	}
+
+	return fs
+}
+
+// connect creates the client and defaults the namespace from the kubeconfig.
+// It is a noop if the client is already set.
+func (o *options) connect() error {
+	if o.client != nil {
+		return nil
+	}
+
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = o.kubeconfig
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{CurrentContext: o.context})
+
+	if o.namespace == "" {
+		namespace, _, err := clientConfig.Namespace()
+		if err != nil {
+			return errors.Wrap(err, "failed to get namespace from kubeconfig")
+		}
+		o.namespace = namespace
+	}
+
+	restConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		return errors.Wrap(err, "failed to load kubeconfig")
+	}
+	o.client, err = client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		return errors.Wrap(err, "failed to create client")
+	}
+	return nil
+}
+
+// loadAnnouncementOffset reads the announcement offset from the config file
+// of the operator unless it is set by flag. The default offset is used if
+// the operator has no config file or the user may not read it.
+func (o *options) loadAnnouncementOffset(ctx context.Context) error {
+	if o.announcementOffset > 0 {
+		return nil
+	}
+	if err := o.connect(); err != nil {
+		return err
+	}
+
+	o.announcementOffset = config.Default().Operator.AnnouncementOffset.Duration
+	if o.operatorConfig == "" {
+		return nil
+	}
+	namespace, name, ok := strings.Cut(o.operatorConfig, "/")
+	if !ok {
+		return errors.Errorf("operator config %q has to be namespace/name", o.operatorConfig)
+	}
+	cm := &corev1.ConfigMap{}
+	err := o.client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, cm)
+	if apierrors.IsNotFound(err) || apierrors.IsForbidden(err) {
+		return nil
+	} else if err != nil {
+		return errors.Wrapf(err, "failed to get operator config %s", o.operatorConfig)
+	}
+	operatorConfig, err := config.Parse([]byte(cm.Data[operatorConfigKey]))
+	if err != nil {
+		return errors.Wrapf(err, "invalid operator config %s", o.operatorConfig)
+	}
+	o.announcementOffset = operatorConfig.Operator.AnnouncementOffset.Duration
+	return nil
+}
+
+// parseInterspersed parses flags that follow positional arguments as kubectl
+// does, e.g. "set mycluster --release 15.2.1".
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		if args[0] == "--" {
+			return append(positional, args[1:]...), nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func clusterArg(args []string) (string, error) {
+	if len(args) != 1 || strings.TrimSpace(args[0]) == "" {
+		return "", errors.New("exactly one cluster name is required")
+	}
+	return args[0], nil
+}
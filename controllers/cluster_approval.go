@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/giantswarm/k8smetadata/pkg/annotation"
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/labels"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// ClusterUpgradeApprovedBy lists the identities that approved the
+	// scheduled upgrade, separated by commas.
+	ClusterUpgradeApprovedBy = "alpha.giantswarm.io/update-schedule-approved-by"
+
+	// DefaultProductionSelector is the label selector of the production
+	// clusters of Giant Swarm.
+	DefaultProductionSelector = "giantswarm.io/service-priority=highest"
+	// DefaultRequiredApprovals is the number of approvals required for
+	// upgrades of production clusters unless the upgrade policy requires
+	// another number.
+	DefaultRequiredApprovals = 1
+)
+
+// ParseApprovers returns the distinct identities of an approved by
+// annotation value.
+func ParseApprovers(value string) []string {
+	seen := map[string]bool{}
+	approvers := []string{}
+	for _, approver := range strings.Split(value, ",") {
+		approver = strings.TrimSpace(approver)
+		if approver == "" || seen[approver] {
+			continue
+		}
+		seen[approver] = true
+		approvers = append(approvers, approver)
+	}
+	sort.Strings(approvers)
+	return approvers
+}
+
+// approvers returns the identities that approved the upgrade of the cluster
+// without the identity that scheduled it.
+func approvers(cluster *clusterv1.Cluster) []string {
+	requester := scheduledBy(cluster)
+	result := []string{}
+	for _, approver := range ParseApprovers(cluster.Annotations[ClusterUpgradeApprovedBy]) {
+		if approver != requester {
+			result = append(result, approver)
+		}
+	}
+	return result
+}
+
+// requiresApproval returns true if upgrades of the cluster require approval.
+func (r *ClusterReconciler) requiresApproval(cluster *clusterv1.Cluster) bool {
+	return r.ProductionSelector != nil && r.ProductionSelector.Matches(labels.Set(cluster.Labels))
+}
+
+// reconcileApproval holds back the upgrade of a production cluster until it
+// has been approved by enough identities other than the one that scheduled
+// it. The number of required approvals is set by the upgrade policy.
+// Unapproved upgrades expire at their announcement time. It returns nil if the
+// upgrade may proceed.
+func (r *ClusterReconciler) reconcileApproval(ctx context.Context, cluster *clusterv1.Cluster, upgrade ScheduledUpgrade, policy EffectivePolicy, log logr.Logger) (*ctrl.Result, error) {
+	if !r.requiresApproval(cluster) || upgrade.Announced {
+		return nil, nil
+	}
+
+	required := policy.RequiredApprovals()
+	approvedBy := approvers(cluster)
+	if len(approvedBy) >= required {
+		return nil, nil
+	}
+
+	if !upgradeAnnouncementTimeReached(upgrade.Time, r.now()) {
+		log.Info(fmt.Sprintf("The scheduled upgrade is pending approval, %d of %d approvals.", len(approvedBy), required))
+		upgrade.State = UpgradeStatePendingApproval
+		r.trackUpgrade(upgrade)
+		result := r.requeueAt(cluster, ActionAnnouncement, upgrade.AnnouncementTime())
+		return &result, nil
+	}
+
+	log.Info(fmt.Sprintf("The scheduled upgrade was not approved in time, %d of %d approvals.", len(approvedBy), required))
+	// A schedule approved or changed meanwhile is not removed.
+	patched, err := r.patchClusterLocked(ctx, cluster, cluster.DeepCopy(), func(cluster *clusterv1.Cluster) error {
+		delete(cluster.Annotations, annotation.UpdateScheduleTargetTime)
+		delete(cluster.Annotations, annotation.UpdateScheduleTargetRelease)
+		delete(cluster.Annotations, ClusterUpgradeScheduledAt)
+		delete(cluster.Annotations, ClusterUpgradeApprovedBy)
+		delete(cluster.Annotations, ClusterUpgradeRequestedBy)
+		delete(cluster.Annotations, ClusterUpgradeEndOfLife)
+		return nil
+	})
+	if err != nil {
+		log.Error(err, "Failed to remove expired upgrade schedule.")
+		reason := r.warnUpdateFailed(cluster, err, "Failed to remove expired upgrade schedule")
+		r.trackFailedUpgrade(upgrade, reason, err)
+		return &ctrl.Result{}, err
+	}
+	if !patched {
+		log.Info("The schedule changed while the expired upgrade schedule was removed. The change will be reconciled.")
+		return &ctrl.Result{}, nil
+	}
+	r.Recorder.Warnf(cluster, ReasonUpgradeApprovalExpired, "The upgrade to release version %v scheduled at %v was cancelled because it got %d of %d required approvals until %v.",
+		upgrade.TargetVersion,
+		upgrade.Time.Format(time.RFC822),
+		len(approvedBy),
+		required,
+		upgrade.AnnouncementTime().Format(time.RFC822),
+	)
+	r.forgetUpgrade(client.ObjectKeyFromObject(cluster))
+	return &ctrl.Result{}, nil
+}
@@ -0,0 +1,289 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	clocktesting "k8s.io/utils/clock/testing"
+	"k8s.io/utils/ptr"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	"github.com/giantswarm/upgrade-schedule-operator/api/v1alpha1"
+)
+
+func TestParseApprovers(t *testing.T) {
+	testCases := []struct {
+		name     string
+		value    string
+		expected []string
+	}{
+		{
+			name:     "case 0: empty",
+			value:    "",
+			expected: []string{},
+		},
+		{
+			name:     "case 1: single approver",
+			value:    "john@acme.com",
+			expected: []string{"john@acme.com"},
+		},
+		{
+			name:     "case 2: sorted without blanks and duplicates",
+			value:    " john@acme.com, ,jane@acme.com,john@acme.com",
+			expected: []string{"jane@acme.com", "john@acme.com"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, ParseApprovers(tc.value))
+		})
+	}
+}
+
+func TestClusterControllerApproval(t *testing.T) {
+	upgradeTime := time.Date(2025, 3, 12, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name              string
+		production        bool
+		approvedBy        string
+		requiredApprovals []int32
+		now               time.Time
+
+		expectedState     UpgradeState
+		expectedRequeue   time.Duration
+		expectedAnnounced bool
+		expectedRemoved   bool
+		expectedWarning   string
+	}{
+		{
+			name:            "case 0: production upgrade pending approval",
+			production:      true,
+			now:             upgradeTime.Add(-time.Hour),
+			expectedState:   UpgradeStatePendingApproval,
+			expectedRequeue: 45*time.Minute + time.Second,
+		},
+		{
+			name:            "case 1: requester can not approve",
+			production:      true,
+			approvedBy:      "jane@acme.com",
+			now:             upgradeTime.Add(-20 * time.Minute),
+			expectedState:   UpgradeStatePendingApproval,
+			expectedRequeue: 5*time.Minute + time.Second,
+		},
+		{
+			name:              "case 2: approved production upgrade is announced",
+			production:        true,
+			approvedBy:        "jane@acme.com,john@acme.com",
+			now:               upgradeTime.Add(-10 * time.Minute),
+			expectedState:     UpgradeStatePending,
+			expectedRequeue:   10*time.Minute + time.Second,
+			expectedAnnounced: true,
+		},
+		{
+			name:              "case 3: not enough approvals for the organization",
+			production:        true,
+			approvedBy:        "john@acme.com",
+			requiredApprovals: []int32{2},
+			now:               upgradeTime.Add(-time.Hour),
+			expectedState:     UpgradeStatePendingApproval,
+			expectedRequeue:   45*time.Minute + time.Second,
+		},
+		{
+			name:              "case 4: organization does not require approvals",
+			production:        true,
+			requiredApprovals: []int32{0},
+			now:               upgradeTime.Add(-10 * time.Minute),
+			expectedState:     UpgradeStatePending,
+			expectedRequeue:   10*time.Minute + time.Second,
+			expectedAnnounced: true,
+		},
+		{
+			name:            "case 5: unapproved upgrade expires",
+			production:      true,
+			approvedBy:      "jane@acme.com",
+			now:             upgradeTime.Add(-10 * time.Minute),
+			expectedRemoved: true,
+			expectedWarning: ReasonUpgradeApprovalExpired,
+		},
+		{
+			name:              "case 6: the strictest upgrade policy applies",
+			production:        true,
+			approvedBy:        "john@acme.com",
+			requiredApprovals: []int32{0, 2},
+			now:               upgradeTime.Add(-time.Hour),
+			expectedState:     UpgradeStatePendingApproval,
+			expectedRequeue:   45*time.Minute + time.Second,
+		},
+		{
+			name:              "case 7: other clusters do not require approval",
+			now:               upgradeTime.Add(-10 * time.Minute),
+			expectedState:     UpgradeStatePending,
+			expectedRequeue:   10*time.Minute + time.Second,
+			expectedAnnounced: true,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+			drainEvents()
+
+			cluster := &capi.Cluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "approval",
+					Namespace: "org-acme",
+					Labels: map[string]string{
+						"release.giantswarm.io/version": "14.2.2",
+					},
+					Annotations: map[string]string{
+						"alpha.giantswarm.io/update-schedule-target-release": "15.2.1",
+						"alpha.giantswarm.io/update-schedule-target-time":    "12 Mar 25 12:00 UTC",
+						ClusterUpgradeScheduledAt:                            "2025-03-11T12:00:00Z",
+						ClusterUpgradeRequestedBy:                            "jane@acme.com",
+					},
+				},
+			}
+			if tc.production {
+				cluster.Labels["giantswarm.io/service-priority"] = "highest"
+			}
+			if tc.approvedBy != "" {
+				cluster.Annotations[ClusterUpgradeApprovedBy] = tc.approvedBy
+			}
+			objects := []client.Object{cluster}
+			for i, required := range tc.requiredApprovals {
+				objects = append(objects, &v1alpha1.UpgradePolicy{
+					ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("policy-%d", i), Namespace: "org-acme"},
+					Spec:       v1alpha1.UpgradePolicySpec{RequiredApprovals: ptr.To(required)},
+				})
+			}
+
+			fakeClock := clocktesting.NewFakeClock(tc.now)
+			fakeClient := fake.NewClientBuilder().WithScheme(fakeScheme).WithObjects(objects...).Build()
+			r := &ClusterReconciler{
+				Client:             fakeClient,
+				Scheme:             fakeScheme,
+				Log:                ctrl.Log.WithName("fake"),
+				Upgrades:           NewUpgradeStore(fakeClock),
+				Clock:              fakeClock,
+				ProductionSelector: labels.SelectorFromSet(labels.Set{"giantswarm.io/service-priority": "highest"}),
+			}
+			ctx := context.TODO()
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: cluster.GetName(), Namespace: cluster.GetNamespace()}}
+
+			result, err := r.Reconcile(ctx, req)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedRequeue, result.RequeueAfter)
+
+			upgrade, ok := r.Upgrades.Get(r.Installation, req.NamespacedName)
+			if tc.expectedState == "" {
+				assert.False(t, ok)
+			} else {
+				assert.Equal(t, tc.expectedState, upgrade.State)
+			}
+			if tc.expectedState == UpgradeStatePendingApproval {
+				assert.Equal(t, float64(1), testutil.ToFloat64(UpgradeStateInfo.WithLabelValues(r.Installation, req.Name, req.Namespace, metricStatePendingApproval)))
+			}
+
+			obj := &capi.Cluster{}
+			assert.NoError(t, fakeClient.Get(ctx, req.NamespacedName, obj))
+			_, announced := obj.Annotations[ClusterUpgradeAnnouncement]
+			assert.Equal(t, tc.expectedAnnounced, announced)
+			_, scheduled := obj.Annotations["alpha.giantswarm.io/update-schedule-target-time"]
+			assert.Equal(t, tc.expectedRemoved, !scheduled)
+			if tc.expectedRemoved {
+				assert.NotContains(t, obj.Annotations, ClusterUpgradeApprovedBy)
+				assert.NotContains(t, obj.Annotations, ClusterUpgradeRequestedBy)
+			}
+
+			warning := ""
+			for _, event := range drainEvents() {
+				if strings.HasPrefix(event, corev1.EventTypeWarning) {
+					warning = strings.Fields(event)[1]
+				}
+			}
+			assert.Equal(t, tc.expectedWarning, warning)
+		})
+	}
+}
+
+func TestClusterControllerApprovalExpiryConflict(t *testing.T) {
+	upgradeTime := time.Date(2025, 3, 12, 12, 0, 0, 0, time.UTC)
+	drainEvents()
+
+	cluster := &capi.Cluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "approval",
+			Namespace: "org-acme",
+			Labels: map[string]string{
+				"release.giantswarm.io/version":  "14.2.2",
+				"giantswarm.io/service-priority": "highest",
+			},
+			Annotations: map[string]string{
+				"alpha.giantswarm.io/update-schedule-target-release": "15.2.1",
+				"alpha.giantswarm.io/update-schedule-target-time":    "12 Mar 25 12:00 UTC",
+				ClusterUpgradeScheduledAt:                            "2025-03-11T12:00:00Z",
+				ClusterUpgradeRequestedBy:                            "jane@acme.com",
+			},
+		},
+	}
+
+	// The upgrade is approved while its expired schedule is removed.
+	clusterPatches := 0
+	fakeClient := fake.NewClientBuilder().WithScheme(fakeScheme).WithObjects(cluster).WithInterceptorFuncs(interceptor.Funcs{
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			if _, ok := obj.(*capi.Cluster); ok {
+				clusterPatches++
+				if clusterPatches == 1 {
+					latest := &capi.Cluster{}
+					if err := c.Get(ctx, client.ObjectKeyFromObject(obj), latest); err != nil {
+						return err
+					}
+					latest.Annotations[ClusterUpgradeApprovedBy] = "john@acme.com"
+					if err := c.Update(ctx, latest); err != nil {
+						return err
+					}
+				}
+			}
+			return c.Patch(ctx, obj, patch, opts...)
+		},
+	}).Build()
+	fakeClock := clocktesting.NewFakeClock(upgradeTime.Add(-10 * time.Minute))
+	r := &ClusterReconciler{
+		Client:             fakeClient,
+		Scheme:             fakeScheme,
+		Log:                ctrl.Log.WithName("fake"),
+		Upgrades:           NewUpgradeStore(fakeClock),
+		Clock:              fakeClock,
+		ProductionSelector: labels.SelectorFromSet(labels.Set{"giantswarm.io/service-priority": "highest"}),
+	}
+	ctx := context.TODO()
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: cluster.GetName(), Namespace: cluster.GetNamespace()}}
+
+	_, err := r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, clusterPatches)
+
+	obj := &capi.Cluster{}
+	assert.NoError(t, fakeClient.Get(ctx, req.NamespacedName, obj))
+	assert.Equal(t, "12 Mar 25 12:00 UTC", obj.Annotations["alpha.giantswarm.io/update-schedule-target-time"])
+	assert.Equal(t, "john@acme.com", obj.Annotations[ClusterUpgradeApprovedBy])
+	for _, event := range drainEvents() {
+		assert.NotContains(t, event, ReasonUpgradeApprovalExpired)
+	}
+}
@@ -0,0 +1,255 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/blang/semver"
+	"github.com/giantswarm/k8smetadata/pkg/annotation"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	// ClusterAutoUpgradeChannel enables automatic upgrades of the cluster to
+	// newer releases of the channel, either patch or minor.
+	ClusterAutoUpgradeChannel = "alpha.giantswarm.io/update-schedule-auto-upgrade"
+
+	// AutoUpgradeChannelPatch upgrades to newer patch releases of the
+	// current minor release.
+	AutoUpgradeChannelPatch = "patch"
+	// AutoUpgradeChannelMinor upgrades to newer minor and patch releases of
+	// the current major release.
+	AutoUpgradeChannelMinor = "minor"
+
+	// DefaultAutoUpgradeLeadTime is how long in advance automatic upgrades
+	// are scheduled at least.
+	DefaultAutoUpgradeLeadTime = 72 * time.Hour
+
+	ReasonAutoUpgradeScheduled      = "AutoUpgradeScheduled"
+	ReasonAutoUpgradeChannelInvalid = "AutoUpgradeChannelInvalid"
+	ReasonAutoUpgradeFailed         = "AutoUpgradeFailed"
+)
+
+// releaseListGVK is the kind of the Giant Swarm Release CRs listing the
+// available releases.
+var releaseListGVK = schema.GroupVersionKind{
+	Group:   "release.giantswarm.io",
+	Version: "v1alpha1",
+	Kind:    "ReleaseList",
+}
+
+// availableRelease is a release the cluster can be upgraded to.
+type availableRelease struct {
+	Name  string
+	State string
+	// EndOfLife is the end of life date of the release. It is zero if the
+	// release has none.
+	EndOfLife time.Time
+}
+
+// ReconcileAutoUpgrade schedules an upgrade of a cluster without scheduled
+// upgrade to the latest release of its auto upgrade channel. The upgrade is
+// scheduled in the first maintenance window of the upgrade policy after the
+// lead time and then proceeds like any scheduled upgrade.
+func (r *ClusterReconciler) ReconcileAutoUpgrade(ctx context.Context, cluster *clusterv1.Cluster, channel string, log logr.Logger) (ctrl.Result, error) {
+	ctx, span := tracer.Start(ctx, "ReconcileAutoUpgrade")
+	defer span.End()
+
+	if channel != AutoUpgradeChannelPatch && channel != AutoUpgradeChannelMinor {
+		log.Info(fmt.Sprintf("The auto upgrade channel %q is invalid.", channel))
+		r.Recorder.Warnf(cluster, ReasonAutoUpgradeChannelInvalid, "The auto upgrade channel %q in annotation %v is invalid, it has to be %s or %s.", channel, ClusterAutoUpgradeChannel, AutoUpgradeChannelPatch, AutoUpgradeChannelMinor)
+		return ctrl.Result{}, nil
+	}
+	currentVersion, err := semver.New(getClusterReleaseVersionLabel(cluster))
+	if err != nil {
+		log.Error(err, "Failed to parse current cluster release version label.")
+		r.Recorder.Warnf(cluster, ReasonReleaseVersionInvalid, "The current release version %q can not be parsed: %v", getClusterReleaseVersionLabel(cluster), err)
+		return ctrl.Result{}, err
+	}
+
+	releases, err := r.listReleases(ctx)
+	if err != nil {
+		log.Error(err, "Failed to list the releases.")
+		r.Recorder.Warnf(cluster, ReasonAutoUpgradeFailed, "The releases of the auto upgrade channel %s can not be listed: %v", channel, err)
+		return ctrl.Result{}, err
+	}
+	target, ok := latestChannelRelease(releases, releasePrefix(cluster), *currentVersion, channel)
+	if !ok {
+		log.Info(fmt.Sprintf("The cluster runs the latest release of the %s channel.", channel))
+		return ctrl.Result{}, nil
+	}
+
+	policy, err := GetEffectivePolicy(ctx, r.Client, cluster.Namespace)
+	if err != nil {
+		log.Error(err, "Failed to get the upgrade policy.")
+		r.Recorder.Warnf(cluster, ReasonUpgradePolicyFailed, "The upgrade policy of namespace %s can not be read: %v", cluster.Namespace, err)
+		return ctrl.Result{}, err
+	}
+	upgradeTime := r.automaticUpgradeTime(cluster, policy, *currentVersion, target, log)
+	if upgradeTime.IsZero() {
+		return ctrl.Result{}, nil
+	}
+	scheduled, err := r.scheduleUpgrade(ctx, cluster, target, upgradeTime, nil, log)
+	if err != nil || !scheduled {
+		return ctrl.Result{}, err
+	}
+	r.Recorder.Eventf(cluster, ReasonAutoUpgradeScheduled, "The upgrade from release version %v to %v was scheduled at %v by the %s auto upgrade channel.",
+		currentVersion,
+		target,
+		FormatUpgradeTime(upgradeTime),
+		channel,
+	)
+	return ctrl.Result{}, nil
+}
+
+// automaticUpgradeTime returns the first hour of the first maintenance window
+// of the upgrade policy after the lead time. It returns the zero time if the
+// policy does not allow the upgrade to the target release.
+func (r *ClusterReconciler) automaticUpgradeTime(cluster *clusterv1.Cluster, policy EffectivePolicy, currentVersion semver.Version, target semver.Version, log logr.Logger) time.Time {
+	leadTime := r.AutoUpgradeLeadTime
+	if leadTime == 0 {
+		leadTime = DefaultAutoUpgradeLeadTime
+	}
+	if notice := policy.MinimumNotice(); notice > leadTime {
+		leadTime = notice
+	}
+	now := r.now()
+	upgradeTime, ok := policy.NextMaintenanceWindow(now.Add(leadTime))
+	if !ok {
+		log.Info("The upgrade policy has no maintenance window.")
+		r.Recorder.Warnf(cluster, ReasonAutoUpgradeFailed, "The upgrade to release version %v can not be scheduled because the upgrade policy has no maintenance window.", target)
+		return time.Time{}
+	}
+	if err := policy.Validate(upgradeTime, now, VersionBump(currentVersion, target)); err != nil {
+		log.Info(fmt.Sprintf("The automatic upgrade violates the upgrade policy: %v", err))
+		r.Recorder.Warnf(cluster, ReasonAutoUpgradeFailed, "The upgrade to release version %v can not be scheduled because it violates the upgrade policy: %v", target, err)
+		return time.Time{}
+	}
+	return upgradeTime
+}
+
+// scheduleUpgrade schedules the upgrade of the cluster to the target release
+// at upgradeTime and sets the given annotations along with the schedule. It
+// returns false if the cluster was scheduled or upgraded meanwhile.
+func (r *ClusterReconciler) scheduleUpgrade(ctx context.Context, cluster *clusterv1.Cluster, target semver.Version, upgradeTime time.Time, annotations map[string]string, log logr.Logger) (bool, error) {
+	patched, err := r.patchClusterLocked(ctx, cluster, cluster.DeepCopy(), func(cluster *clusterv1.Cluster) error {
+		if cluster.Annotations == nil {
+			cluster.Annotations = map[string]string{}
+		}
+		for k, v := range annotations {
+			cluster.Annotations[k] = v
+		}
+		cluster.Annotations[annotation.UpdateScheduleTargetRelease] = target.String()
+		cluster.Annotations[annotation.UpdateScheduleTargetTime] = FormatUpgradeTime(upgradeTime)
+		cluster.Annotations[ClusterUpgradeScheduledAt] = r.now().Format(time.RFC3339)
+		return nil
+	})
+	if err != nil {
+		log.Error(err, "Failed to schedule the automatic upgrade.")
+		r.warnUpdateFailed(cluster, err, "Failed to schedule the automatic upgrade")
+		return false, err
+	}
+	if !patched {
+		log.Info("The cluster changed while the automatic upgrade was scheduled. The change will be reconciled.")
+		return false, nil
+	}
+	log.Info(fmt.Sprintf("Scheduled the automatic upgrade to release version %v at %v.", target, FormatUpgradeTime(upgradeTime)))
+	return true, nil
+}
+
+// listReleases returns the releases of the Release CRs. It returns no
+// releases if the Release CRD is not installed.
+func (r *ClusterReconciler) listReleases(ctx context.Context) ([]availableRelease, error) {
+	ctx, span := tracer.Start(ctx, "ListReleases")
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(releaseListGVK)
+	err := r.List(ctx, list)
+	endSpan(span, err)
+	if meta.IsNoMatchError(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var releases []availableRelease
+	for _, item := range list.Items {
+		release := availableRelease{Name: item.GetName()}
+		release.State, _, _ = unstructured.NestedString(item.Object, "spec", "state")
+		if value, ok, _ := unstructured.NestedString(item.Object, "spec", "endOfLifeDate"); ok && value != "" {
+			release.EndOfLife, err = time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to parse the end of life date of release %s", item.GetName())
+			}
+		}
+		releases = append(releases, release)
+	}
+	return releases, nil
+}
+
+// releasePrefix returns the prefix of the names of the releases of the
+// provider of the cluster, e.g. aws- for CAPI clusters on AWS and v for
+// vintage clusters.
+func releasePrefix(cluster *clusterv1.Cluster) string {
+	if isCAPIProvider(cluster) {
+		return getClusterProvider(cluster) + "-"
+	}
+	return "v"
+}
+
+// latestChannelRelease returns the highest active release version named with
+// the prefix that is newer than the current version and within the channel.
+func latestChannelRelease(releases []availableRelease, prefix string, current semver.Version, channel string) (semver.Version, bool) {
+	var candidates []semver.Version
+	for _, release := range releases {
+		version, ok := release.activeVersion(prefix)
+		if !ok || !version.GT(current) || version.Major != current.Major {
+			continue
+		}
+		if channel == AutoUpgradeChannelPatch && version.Minor != current.Minor {
+			continue
+		}
+		candidates = append(candidates, version)
+	}
+	if len(candidates) == 0 {
+		return semver.Version{}, false
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].GT(candidates[j])
+	})
+	return candidates[0], true
+}
+
+// version returns the version of the release if it is named with the prefix.
+func (r availableRelease) version(prefix string) (semver.Version, bool) {
+	if !strings.HasPrefix(r.Name, prefix) {
+		return semver.Version{}, false
+	}
+	version, err := semver.Parse(strings.TrimPrefix(r.Name, prefix))
+	if err != nil {
+		return semver.Version{}, false
+	}
+	return version, true
+}
+
+// activeVersion returns the version of the release if it is named with the
+// prefix and neither deprecated, work in progress nor a pre-release.
+func (r availableRelease) activeVersion(prefix string) (semver.Version, bool) {
+	if r.State == "deprecated" || r.State == "wip" {
+		return semver.Version{}, false
+	}
+	version, ok := r.version(prefix)
+	if !ok || len(version.Pre) > 0 {
+		return semver.Version{}, false
+	}
+	return version, true
+}
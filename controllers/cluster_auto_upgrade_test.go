@@ -0,0 +1,221 @@
+package controllers
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blang/semver"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	clocktesting "k8s.io/utils/clock/testing"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/giantswarm/upgrade-schedule-operator/api/v1alpha1"
+)
+
+func TestLatestChannelRelease(t *testing.T) {
+	releases := []availableRelease{
+		{Name: "v15.2.1", State: "active"},
+		{Name: "v15.2.3", State: "active"},
+		{Name: "v15.2.4", State: "deprecated"},
+		{Name: "v15.3.0", State: "active"},
+		{Name: "v15.4.0-beta.1", State: "active"},
+		{Name: "v15.5.0", State: "wip"},
+		{Name: "v16.0.0", State: "active"},
+		{Name: "aws-15.6.0", State: "active"},
+		{Name: "aws-15.2.9", State: "active"},
+	}
+
+	testCases := []struct {
+		name            string
+		prefix          string
+		current         string
+		channel         string
+		expectedVersion string
+	}{
+		{
+			name:            "case 0: patch channel",
+			prefix:          "v",
+			current:         "15.2.1",
+			channel:         AutoUpgradeChannelPatch,
+			expectedVersion: "15.2.3",
+		},
+		{
+			name:            "case 1: minor channel",
+			prefix:          "v",
+			current:         "15.2.1",
+			channel:         AutoUpgradeChannelMinor,
+			expectedVersion: "15.3.0",
+		},
+		{
+			name:    "case 2: latest release of the channel",
+			prefix:  "v",
+			current: "15.3.0",
+			channel: AutoUpgradeChannelPatch,
+		},
+		{
+			name:            "case 3: releases of the provider",
+			prefix:          "aws-",
+			current:         "15.2.1",
+			channel:         AutoUpgradeChannelPatch,
+			expectedVersion: "15.2.9",
+		},
+		{
+			name:            "case 4: minor channel of the provider",
+			prefix:          "aws-",
+			current:         "15.2.1",
+			channel:         AutoUpgradeChannelMinor,
+			expectedVersion: "15.6.0",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			version, ok := latestChannelRelease(releases, tc.prefix, semver.MustParse(tc.current), tc.channel)
+			if tc.expectedVersion == "" {
+				assert.False(t, ok)
+			} else {
+				assert.True(t, ok)
+				assert.Equal(t, tc.expectedVersion, version.String())
+			}
+		})
+	}
+}
+
+func TestClusterControllerAutoUpgrade(t *testing.T) {
+	// Monday.
+	now := time.Date(2025, 3, 10, 9, 30, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name     string
+		channel  string
+		policy   *v1alpha1.UpgradePolicySpec
+		schedule map[string]string
+
+		expectedVersion string
+		expectedTime    string
+		expectedEvent   string
+	}{
+		{
+			name:            "case 0: schedule after the lead time",
+			channel:         AutoUpgradeChannelPatch,
+			expectedVersion: "15.2.3",
+			expectedTime:    "13 Mar 25 10:00 UTC",
+			expectedEvent:   ReasonAutoUpgradeScheduled,
+		},
+		{
+			name:            "case 1: schedule in the maintenance window",
+			channel:         AutoUpgradeChannelMinor,
+			policy:          &v1alpha1.UpgradePolicySpec{AllowedDays: []v1alpha1.Weekday{"Tuesday"}, AllowedHours: &v1alpha1.HourWindow{Start: 6, End: 8}},
+			expectedVersion: "15.3.0",
+			expectedTime:    "18 Mar 25 06:00 UTC",
+			expectedEvent:   ReasonAutoUpgradeScheduled,
+		},
+		{
+			name:          "case 2: not allowed version bump",
+			channel:       AutoUpgradeChannelMinor,
+			policy:        &v1alpha1.UpgradePolicySpec{AllowedBumps: []v1alpha1.VersionBump{"patch"}},
+			expectedEvent: ReasonAutoUpgradeFailed,
+		},
+		{
+			name:          "case 3: invalid channel",
+			channel:       "major",
+			expectedEvent: ReasonAutoUpgradeChannelInvalid,
+		},
+		{
+			name:    "case 4: scheduled upgrades take precedence",
+			channel: AutoUpgradeChannelPatch,
+			schedule: map[string]string{
+				"alpha.giantswarm.io/update-schedule-target-release": "15.2.2",
+				"alpha.giantswarm.io/update-schedule-target-time":    "20 Mar 25 10:00 UTC",
+				ClusterUpgradeScheduledAt:                            "2025-03-19T10:00:00Z",
+			},
+			expectedVersion: "15.2.2",
+			expectedTime:    "20 Mar 25 10:00 UTC",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+			drainEvents()
+
+			cluster := &capi.Cluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "auto",
+					Namespace: "org-acme",
+					Labels: map[string]string{
+						"release.giantswarm.io/version": "15.2.1",
+					},
+					Annotations: map[string]string{
+						ClusterAutoUpgradeChannel: tc.channel,
+					},
+				},
+			}
+			for k, v := range tc.schedule {
+				cluster.Annotations[k] = v
+			}
+			objects := []client.Object{cluster}
+			for _, name := range []string{"v15.2.1", "v15.2.3", "v15.3.0", "v16.0.0"} {
+				objects = append(objects, newRelease(name, "active"))
+			}
+			if tc.policy != nil {
+				objects = append(objects, &v1alpha1.UpgradePolicy{
+					ObjectMeta: metav1.ObjectMeta{Name: "acme", Namespace: "org-acme"},
+					Spec:       *tc.policy,
+				})
+			}
+
+			mapper := meta.NewDefaultRESTMapper(nil)
+			mapper.Add(capi.GroupVersion.WithKind("Cluster"), meta.RESTScopeNamespace)
+			mapper.Add(v1alpha1.GroupVersion.WithKind("UpgradePolicy"), meta.RESTScopeNamespace)
+			mapper.Add(releaseListGVK.GroupVersion().WithKind("Release"), meta.RESTScopeRoot)
+
+			fakeClock := clocktesting.NewFakeClock(now)
+			fakeClient := fake.NewClientBuilder().WithScheme(fakeScheme).WithRESTMapper(mapper).WithObjects(objects...).Build()
+			r := &ClusterReconciler{
+				Client:   fakeClient,
+				Scheme:   fakeScheme,
+				Log:      ctrl.Log.WithName("fake"),
+				Upgrades: NewUpgradeStore(fakeClock),
+				Clock:    fakeClock,
+			}
+			ctx := context.TODO()
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: cluster.GetName(), Namespace: cluster.GetNamespace()}}
+
+			_, err := r.Reconcile(ctx, req)
+			assert.NoError(t, err)
+
+			obj := &capi.Cluster{}
+			assert.NoError(t, fakeClient.Get(ctx, req.NamespacedName, obj))
+			assert.Equal(t, tc.expectedVersion, obj.Annotations["alpha.giantswarm.io/update-schedule-target-release"])
+			assert.Equal(t, tc.expectedTime, obj.Annotations["alpha.giantswarm.io/update-schedule-target-time"])
+			if tc.expectedTime != "" && tc.schedule == nil {
+				assert.Equal(t, now.Format(time.RFC3339), obj.Annotations[ClusterUpgradeScheduledAt])
+			}
+
+			event := ""
+			for _, e := range drainEvents() {
+				event = strings.Fields(e)[1]
+			}
+			assert.Equal(t, tc.expectedEvent, event)
+		})
+	}
+}
+
+func newRelease(name string, state string) *unstructured.Unstructured {
+	release := &unstructured.Unstructured{}
+	release.SetGroupVersionKind(releaseListGVK.GroupVersion().WithKind("Release"))
+	release.SetName(name)
+	_ = unstructured.SetNestedField(release.Object, state, "spec", "state")
+	return release
+}
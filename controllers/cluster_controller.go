@@ -19,7 +19,6 @@ package controllers
 import (
 	"context"
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/blang/semver"
@@ -30,13 +29,44 @@ import (
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/utils/clock"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	"sigs.k8s.io/cluster-api/util/annotations"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"github.com/giantswarm/upgrade-schedule-operator/api/v1alpha1"
+	"github.com/giantswarm/upgrade-schedule-operator/util/record"
+)
+
+// Event reasons emitted on the Cluster. They are part of the user facing
+// interface and must stay stable.
+const (
+	ReasonClusterUpgradeAnnouncement = "ClusterUpgradeAnnouncement"
+	ReasonTargetReleaseMissing       = "TargetReleaseMissing"
+	ReasonUpgradeTimeInvalid         = "UpgradeTimeInvalid"
+	ReasonReleaseVersionInvalid      = "ReleaseVersionInvalid"
+	ReasonTargetReleaseInvalid       = "TargetReleaseInvalid"
+	ReasonUserConfigNotFound         = "UserConfigNotFound"
+	ReasonUserConfigFailed           = "UserConfigFailed"
+	ReasonUpdateConflict             = "UpdateConflict"
+	ReasonUpdateFailed               = "UpdateFailed"
+	ReasonUpgradeInProgressInvalid   = "UpgradeInProgressInvalid"
+	ReasonUpgradeCompleted           = "UpgradeCompleted"
+	ReasonUpgradeVerificationTimeout = "UpgradeVerificationTimeout"
+	ReasonUpgradeHistoryFailed       = "UpgradeHistoryFailed"
+	ReasonUpgradeApprovalExpired     = "UpgradeApprovalExpired"
+	ReasonUpgradePolicyFailed        = "UpgradePolicyFailed"
+	ReasonUpgradePolicyViolated      = "UpgradePolicyViolated"
+	ReasonUpgradeDelayed             = "UpgradeDelayed"
 )
 
 // ClusterReconciler reconciles a Cluster object
@@ -45,14 +75,55 @@ type ClusterReconciler struct {
 	Log          logr.Logger
 	Scheme       *runtime.Scheme
 	Installation string
-
-	recorder record.EventRecorder
+	// Upgrades is updated with the scheduled upgrade of every reconciled
+	// cluster. It is optional.
+	Upgrades *UpgradeStore
+	// Clock is used for all time based decisions. It defaults to the real
+	// clock.
+	Clock clock.PassiveClock
+	// HistoryRetention and HistoryLimit bound the upgrade history of each
+	// cluster. They default to DefaultHistoryRetention and
+	// DefaultHistoryLimit.
+	HistoryRetention time.Duration
+	HistoryLimit     int
+	// AuditSink receives the records of the persisted changes of the
+	// schedules, which are kept in the audit trail of the history ConfigMap
+	// of each cluster as well. Auditing is disabled if it is nil.
+	AuditSink *AuditSink
+	// AuditLimit is the maximum number of audit records kept per cluster. It
+	// defaults to DefaultAuditLimit.
+	AuditLimit int
+	// ProductionSelector selects the clusters whose upgrades have to be
+	// approved. Without selector no approvals are required.
+	ProductionSelector labels.Selector
+	// AutoUpgradeLeadTime is how long in advance upgrades of auto upgrade
+	// channels are scheduled at least. It defaults to
+	// DefaultAutoUpgradeLeadTime.
+	AutoUpgradeLeadTime time.Duration
+	// EmergencyStop is the ConfigMap halting all upgrades of the
+	// installation while its halted key is true. The emergency stop is
+	// disabled if the name is empty.
+	EmergencyStop types.NamespacedName
+	// APIReader confirms that a cluster missing from the cache was deleted
+	// before its history is pruned, the cache only contains the clusters
+	// matching the watch selector. It defaults to the client.
+	APIReader client.Reader
+	// Scheduler keeps the next time based action of every cluster. Without
+	// scheduler the clusters are requeued until their next action is due.
+	Scheduler *Scheduler
+	// Recorder records the events of the clusters. It defaults to the global
+	// recorder of the record package.
+	Recorder record.Recorder
 }
 
 // +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters/finalizers,verbs=update
-// +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;update
+// +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=upgrade.giantswarm.io,resources=upgradepolicies,verbs=get;list;watch
+// +kubebuilder:rbac:groups=upgrade.giantswarm.io,resources=upgradefreezes,verbs=get;list;watch
+// +kubebuilder:rbac:groups=release.giantswarm.io,resources=releases,verbs=get;list;watch
+// +kubebuilder:rbac:groups=application.giantswarm.io,resources=apps,verbs=get;list;watch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -66,67 +137,175 @@ type ClusterReconciler struct {
 func (r *ClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := r.Log.WithValues("cluster", req.NamespacedName)
 
+	// The reconcile schedules the next action again if there is one.
+	if r.Scheduler != nil {
+		r.Scheduler.Cancel(req.NamespacedName)
+	}
+
 	// Fetch the Cluster instance.
 	cluster := &clusterv1.Cluster{}
 	if err := r.Get(ctx, req.NamespacedName, cluster); err != nil {
 		if apierrors.IsNotFound(err) {
 			// Object not found, return.  Created objects are automatically garbage collected.
 			// For additional cleanup logic use finalizers.
-			UpgradesInfo.WithLabelValues(req.Name, req.Namespace, "", "").Set(0)
-			return ctrl.Result{}, nil
+			r.deleteUpgradeMetrics(req.NamespacedName)
+			if r.Upgrades != nil {
+				r.Upgrades.Delete(r.Installation, req.NamespacedName)
+			}
+			// The history outlives the cluster until its records expired.
+			result, err := r.pruneUpgradeHistory(ctx, req.NamespacedName)
+			if err != nil {
+				log.Error(err, "Failed to prune the upgrade history of the deleted cluster.")
+			}
+			return result, err
 		}
 
 		// Error reading the object - requeue the request.
-		UpgradesInfo.WithLabelValues(req.Name, req.Namespace, "", "").Set(-1)
 		return ctrl.Result{}, err
 	}
 
+	ctx, span := startReconcileSpan(ctx, cluster)
+	log = log.WithValues("traceID", span.SpanContext().TraceID().String())
+	result, err := r.reconcile(ctx, cluster, log)
+	endSpan(span, err)
+	return result, err
+}
+
+// reconcile schedules, triggers and verifies the upgrade of the cluster.
+func (r *ClusterReconciler) reconcile(ctx context.Context, cluster *clusterv1.Cluster, log logr.Logger) (ctrl.Result, error) {
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(cluster)}
+
+	// Record who changed the schedule since the last reconcile.
+	r.reconcileAudit(ctx, cluster, log)
+
 	// Return if the Cluster is paused.
 	if annotations.IsPaused(cluster, cluster) {
 		log.Info("The cluster is paused.")
-		UpgradesInfo.WithLabelValues(cluster.Name, cluster.Namespace, "", "").Set(0)
-		return defaultRequeue(), nil
+		r.forgetUpgrade(req.NamespacedName)
+		return ctrl.Result{}, nil
 	}
 
 	// Return if the Cluster is deleted.
 	if !cluster.DeletionTimestamp.IsZero() {
 		log.Info("The cluster is deleted.")
-		UpgradesInfo.WithLabelValues(cluster.Name, cluster.Namespace, "", "").Set(0)
+		r.forgetUpgrade(req.NamespacedName)
+		r.deleteUpgradeMetrics(req.NamespacedName)
 		return ctrl.Result{}, nil
 	}
 
+	// Follow a triggered upgrade until it has been verified.
+	progress, err := getUpgradeProgress(cluster)
+	if err != nil {
+		log.Error(err, "Failed to parse upgrade in progress annotation.")
+		r.Recorder.Warnf(cluster, ReasonUpgradeInProgressInvalid, "The annotation %v can not be parsed: %v", ClusterUpgradeInProgress, err)
+		return ctrl.Result{}, err
+	}
+	if progress != nil && progress.Step == upgradeStepIntent {
+		return r.ResumeUpgrade(ctx, cluster, progress, log)
+	}
+	if progress != nil {
+		return r.ReconcileVerification(ctx, cluster, progress, log)
+	}
+
+	// Warn about and upgrade end of life releases.
+	if result, err := r.reconcileEndOfLife(ctx, cluster, log); result != nil {
+		r.forgetUpgrade(req.NamespacedName)
+		return *result, err
+	}
+
 	// Return if there is no upgrade time scheduled.
 	if getClusterUpgradeTimeAnnotation(cluster) == "" {
-		log.Info("The cluster has no upgrade scheduled.")
-		UpgradesInfo.WithLabelValues(cluster.Name, cluster.Namespace, "", "").Set(0)
-		return defaultRequeue(), nil
+		r.forgetUpgrade(req.NamespacedName)
+		// Schedule the next upgrade of the auto upgrade channel.
+		if channel := cluster.Annotations[ClusterAutoUpgradeChannel]; channel != "" {
+			result, err := r.ReconcileAutoUpgrade(ctx, cluster, channel, log)
+			if err != nil || !result.IsZero() {
+				return result, err
+			}
+		} else {
+			log.Info("The cluster has no upgrade scheduled.")
+		}
+		return r.endOfLifeRequeue(ctx, cluster), nil
 	}
 
 	// Return if the upgrade release version is not specified.
 	if getClusterUpgradeVersionAnnotation(cluster) == "" {
 		log.Info(fmt.Sprintf("The scheduled update at %v can not proceed because no target release version has been set via annotation %v.", getClusterUpgradeTimeAnnotation(cluster), annotation.UpdateScheduleTargetRelease))
-		UpgradesInfo.WithLabelValues(cluster.Name, cluster.Namespace, "", "").Set(0)
-		return defaultRequeue(), nil
+		r.Recorder.Warnf(cluster, ReasonTargetReleaseMissing, "The scheduled upgrade at %v can not proceed because no target release version has been set via annotation %v.", getClusterUpgradeTimeAnnotation(cluster), annotation.UpdateScheduleTargetRelease)
+		r.forgetUpgrade(req.NamespacedName)
+		r.setUpgradeMetrics(ScheduledUpgrade{
+			Installation: r.Installation,
+			Cluster:      cluster.Name,
+			Namespace:    cluster.Namespace,
+			Reason:       ReasonTargetReleaseMissing,
+		}, metricStateBlocked)
+		return ctrl.Result{}, nil
 	}
 	return r.ReconcileUpgrade(ctx, cluster, log)
 }
 
 func (r *ClusterReconciler) ReconcileUpgrade(ctx context.Context, cluster *clusterv1.Cluster, log logr.Logger) (ctrl.Result, error) {
-	upgradeTime, err := time.Parse(time.RFC822, getClusterUpgradeTimeAnnotation(cluster))
+	ctx, span := tracer.Start(ctx, "ReconcileUpgrade")
+	defer span.End()
+
+	upgrade := ScheduledUpgrade{
+		Installation:  r.Installation,
+		Cluster:       cluster.Name,
+		Namespace:     cluster.Namespace,
+		Organization:  cluster.Labels[label.Organization],
+		OriginVersion: getClusterReleaseVersionLabel(cluster),
+		TargetVersion: getClusterUpgradeVersionAnnotation(cluster),
+		State:         UpgradeStatePending,
+	}
+
+	upgradeTime, err := ParseUpgradeTime(getClusterUpgradeTimeAnnotation(cluster))
 	if err != nil {
 		log.Error(err, fmt.Sprintf("Failed to parse cluster upgrade time annotation %v. The value has to be in RFC822 Format and UTC time zone. e.g. 30 Jan 21 15:04 UTC", getClusterUpgradeTimeAnnotation(cluster)))
-		UpgradesInfo.WithLabelValues(cluster.Name, cluster.Namespace, "", "").Set(-1)
+		r.Recorder.Warnf(cluster, ReasonUpgradeTimeInvalid, "The upgrade time %q in annotation %v can not be parsed. The value has to be in RFC822 Format and UTC time zone, e.g. 30 Jan 21 15:04 UTC.", getClusterUpgradeTimeAnnotation(cluster), annotation.UpdateScheduleTargetTime)
+		r.trackFailedUpgrade(upgrade, ReasonUpgradeTimeInvalid, err)
 		return ctrl.Result{}, err
 	}
+	upgrade.Time = upgradeTime
+	_, upgrade.Announced = cluster.Annotations[ClusterUpgradeAnnouncement]
+
+	// Refuse upgrades violating the upgrade policy of the namespace.
+	policy, result, err := r.reconcilePolicy(ctx, cluster, upgrade, log)
+	if result != nil {
+		return *result, err
+	}
+
+	// Retarget or block upgrades frozen by an UpgradeFreeze.
+	if result, err := r.reconcileFreeze(ctx, cluster, upgrade, log); result != nil {
+		return *result, err
+	}
+
+	// Remind of upgrades of end of life releases.
+	if result, err := r.reconcileEndOfLifeReminder(ctx, cluster, upgrade, log); result != nil {
+		return *result, err
+	}
+
+	// Hold back upgrades of production clusters until they are approved.
+	if result, err := r.reconcileApproval(ctx, cluster, upgrade, policy, log); result != nil {
+		return *result, err
+	}
+
+	// Hold back announcements and triggers while upgrades are halted.
+	if result, err := r.reconcileEmergencyStop(ctx, cluster, upgrade, log); result != nil {
+		return *result, err
+	}
 
 	// Send scheduled cluster upgrade announcement.
 	if _, exists := cluster.Annotations[ClusterUpgradeAnnouncement]; !exists {
-		if upgradeAnnouncementTimeReached(upgradeTime) {
-			cluster.Annotations[ClusterUpgradeAnnouncement] = "true"
-			err = r.Update(ctx, cluster)
+		if upgradeAnnouncementTimeReached(upgradeTime, r.now()) {
+			// The announcement is decided on the cluster as it was read, a
+			// conflict fails the reconcile to decide on the latest cluster.
+			base := cluster.DeepCopy()
+			cluster.Annotations[ClusterUpgradeAnnouncement] = r.now().Format(time.RFC3339)
+			err = r.tracedPatch(ctx, "PatchCluster", cluster, client.MergeFromWithOptions(base, client.MergeFromWithOptimisticLock{}))
 			if err != nil {
 				log.Error(err, "Failed to set upgrade announcement annotation.")
-				UpgradesInfo.WithLabelValues(cluster.Name, cluster.Namespace, "", "").Set(-1)
+				reason := r.warnUpdateFailed(cluster, err, "Failed to set upgrade announcement annotation")
+				r.trackFailedUpgrade(upgrade, reason, err)
 				return ctrl.Result{}, err
 			}
 			log.Info("Sending cluster upgrade announcement event.")
@@ -137,107 +316,281 @@ func (r *ClusterReconciler) ReconcileUpgrade(ctx context.Context, cluster *clust
 				r.Installation,
 				getClusterReleaseVersionLabel(cluster),
 				getClusterUpgradeVersionAnnotation(cluster),
-				upgradeTime.Sub(time.Now().UTC()).Round(time.Minute),
+				upgradeTime.Sub(r.now()).Round(time.Minute),
 			)
-			if outOfOffice(upgradeTime) {
-				msg += fmt.Sprintf(" Please contact us via %s in case of anomalies.", OutOfHoursContact)
+			if contact := CurrentSettings().Contact; contact != "" && outOfOffice(upgradeTime) {
+				msg += fmt.Sprintf(" Please contact us via %s in case of anomalies.", contact)
 			}
-			r.sendClusterUpgradeEvent(cluster, msg)
+			r.sendClusterUpgradeEvent(ctx, cluster, msg)
+			upgrade.Announced = true
+
+			provider, bump := histogramLabelValues(cluster, upgrade.OriginVersion, upgrade.TargetVersion)
+			AnnouncementLeadTime.WithLabelValues(r.Installation, provider, bump).Observe(upgradeTime.Sub(r.now()).Seconds())
 		}
 	}
 
 	currentVersion, err := semver.New(getClusterReleaseVersionLabel(cluster))
 	if err != nil {
 		log.Error(err, "Failed to parse current cluster release version label.")
-		UpgradesInfo.WithLabelValues(cluster.Name, cluster.Namespace).Set(-1)
+		r.Recorder.Warnf(cluster, ReasonReleaseVersionInvalid, "The current release version %q in label %v can not be parsed.", getClusterReleaseVersionLabel(cluster), label.ReleaseVersion)
+		r.trackFailedUpgrade(upgrade, ReasonReleaseVersionInvalid, err)
 		return ctrl.Result{}, err
 	}
-	targetVersion, err := semver.New(getClusterUpgradeVersionAnnotation(cluster))
+	targetVersion, err := ParseTargetVersion(getClusterUpgradeVersionAnnotation(cluster))
 	if err != nil {
 		log.Error(err, fmt.Sprintf("Failed to parse cluster upgrade target version annotation %v. The value has to be only the desired release version, e.g 15.2.1.", getClusterUpgradeVersionAnnotation(cluster)))
-		UpgradesInfo.WithLabelValues(cluster.Name, cluster.Namespace).Set(-1)
+		r.Recorder.Warnf(cluster, ReasonTargetReleaseInvalid, "The target release version %q in annotation %v can not be parsed. The value has to be only the desired release version, e.g. 15.2.1.", getClusterUpgradeVersionAnnotation(cluster), annotation.UpdateScheduleTargetRelease)
+		r.trackFailedUpgrade(upgrade, ReasonTargetReleaseInvalid, err)
 		return ctrl.Result{}, err
 	}
+	upgrade.OriginVersion = currentVersion.String()
+	upgrade.TargetVersion = targetVersion.String()
 
 	// Return if the scheduled upgrade time is not reached yet.
-	if !upgradeTimeReached(upgradeTime) {
-		log.Info(fmt.Sprintf("The scheduled update time is not reached yet. Cluster will be upgraded in %v at %v.", upgradeTime.Sub(time.Now().UTC()).Round(time.Minute), upgradeTime))
-		UpgradesInfo.WithLabelValues(cluster.Name, cluster.Namespace, currentVersion.String(), targetVersion.String()).Set(float64(upgradeTime.Unix()))
-		return timedRequeue(upgradeTime), nil
+	if !upgradeTimeReached(upgradeTime, r.now()) {
+		log.Info(fmt.Sprintf("The scheduled update time is not reached yet. Cluster will be upgraded in %v at %v.", upgradeTime.Sub(r.now()).Round(time.Minute), upgradeTime))
+		r.trackUpgrade(upgrade)
+		action, due := nextUpgradeAction(cluster, upgrade, r.now())
+		return r.requeueAt(cluster, action, due), nil
 	}
 
 	// Return if the upgrade to the target release has already been performed.
 	if upgradeApplied(*targetVersion, *currentVersion) {
 		log.Info(fmt.Sprintf("The upgrade to target version %v has already been applied. The current release version is %v.", targetVersion, currentVersion))
-		UpgradesInfo.WithLabelValues(cluster.Name, cluster.Namespace, currentVersion.String(), targetVersion.String()).Set(0)
-		return defaultRequeue(), nil
+		r.forgetUpgrade(client.ObjectKeyFromObject(cluster))
+		return ctrl.Result{}, nil
 	}
 
-	// Apply the upgrade and remove annotations
+	// Hold back the upgrade while too many clusters are upgraded.
+	if result, err := r.reconcileConcurrency(ctx, cluster, upgrade, policy, log); result != nil {
+		return *result, err
+	}
+
+	// Record the intent to upgrade before anything is changed, so that an
+	// interrupted upgrade is resumed instead of being applied twice.
 	log.Info(fmt.Sprintf("The cluster will be upgraded from version %v to %v.", currentVersion, targetVersion))
-	if isCAPIProvider(cluster) {
-		cm := &corev1.ConfigMap{}
-		// Retrieve the existing ConfigMap
-		err := r.Get(ctx, types.NamespacedName{Name: fmt.Sprintf("%s-userconfig", cluster.GetName()), Namespace: cluster.GetNamespace()}, cm)
-		if err != nil {
-			log.Error(err, "Failed to get userconfig configmap from cluster.")
-			FailuresTotal.WithLabelValues(cluster.Name, cluster.Namespace, currentVersion.String(), targetVersion.String()).Inc()
-			UpgradesInfo.WithLabelValues(cluster.Name, cluster.Namespace, currentVersion.String(), targetVersion.String()).Set(-1)
-			return ctrl.Result{}, err
-		}
+	upgrade.State = UpgradeStateInProgress
+	r.trackUpgrade(upgrade)
+	progress := upgradeProgress{
+		OriginVersion: currentVersion.String(),
+		TargetVersion: targetVersion.String(),
+		ScheduledAt:   upgradeTime,
+		TriggeredAt:   r.now(),
+		Step:          upgradeStepIntent,
+		ScheduledBy:   scheduledBy(cluster),
+	}
+	decided := cluster.DeepCopy()
+	patched, err := r.patchClusterLocked(ctx, cluster, decided, func(cluster *clusterv1.Cluster) error {
+		return setUpgradeProgress(cluster, progress)
+	})
+	if err != nil {
+		log.Error(err, "Failed to record the upgrade intent.")
+		reason := r.warnUpdateFailed(cluster, err, "Failed to record the upgrade intent")
+		r.incUpgradeCounter(FailuresTotal, client.ObjectKeyFromObject(cluster), currentVersion.String(), targetVersion.String())
+		r.trackFailedUpgrade(upgrade, reason, err)
+		return ctrl.Result{}, err
+	}
+	if !patched {
+		log.Info("The schedule changed while the upgrade intent was recorded. The change will be reconciled.")
+		return ctrl.Result{}, nil
+	}
+	r.incUpgradeCounter(UpgradesTotal, client.ObjectKeyFromObject(cluster), currentVersion.String(), targetVersion.String())
+
+	return r.applyUpgrade(ctx, cluster, progress, upgrade, log)
+}
+
+// SetupWithManager sets up the controller with the Manager. Besides the
+// clusters, the objects affecting their upgrades are watched: userconfig and
+// emergency stop ConfigMaps, upgrade policies and freezes as well as the App
+// and Release CRs if their CRDs are installed.
+func (r *ClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return r.setup(mgr, nil)
+}
 
-		// Extract the values field and replace the current version with the target version
-		values := cm.Data["values"]
-		values = strings.ReplaceAll(values, fmt.Sprintf("version: %s", currentVersion.String()), fmt.Sprintf("version: %s", targetVersion.String()))
-		cm.Data["values"] = values
+// SetupWithCluster sets up a controller of the Manager reconciling the
+// clusters of a remote management cluster. The objects are watched in the
+// cache of the remote cluster, the controller is named after the
+// installation.
+func (r *ClusterReconciler) SetupWithCluster(mgr ctrl.Manager, remote cluster.Cluster) error {
+	return r.setup(mgr, remote)
+}
 
-		err = r.Update(ctx, cm)
+func (r *ClusterReconciler) setup(mgr ctrl.Manager, remote cluster.Cluster) error {
+	b := ctrl.NewControllerManagedBy(mgr)
+	watch := func(obj client.Object, h handler.EventHandler) {
+		b = b.Watches(obj, h)
+	}
+	mapper := mgr.GetRESTMapper()
+	if remote == nil {
+		b = b.For(&clusterv1.Cluster{})
+	} else {
+		watch = func(obj client.Object, h handler.EventHandler) {
+			b = b.WatchesRawSource(source.Kind(remote.GetCache(), obj, h))
+		}
+		mapper = remote.GetRESTMapper()
+		b = b.Named("cluster-" + r.Installation)
+		watch(&clusterv1.Cluster{}, &handler.EnqueueRequestForObject{})
+	}
+	watch(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.mapConfigMap))
+	watch(&v1alpha1.UpgradePolicy{}, handler.EnqueueRequestsFromMapFunc(r.mapUpgradePolicy))
+	watch(&v1alpha1.UpgradeFreeze{}, handler.EnqueueRequestsFromMapFunc(r.mapAllClusters))
+	for gvk, mapFunc := range map[schema.GroupVersionKind]handler.MapFunc{
+		appGVK:     r.mapApp,
+		releaseGVK: r.mapRelease,
+	} {
+		installed, err := kindInstalled(mapper, gvk)
 		if err != nil {
-			log.Error(err, "Failed to update release version tag and remove scheduled upgrade annotations.")
-			FailuresTotal.WithLabelValues(cluster.Name, cluster.Namespace, currentVersion.String(), targetVersion.String()).Inc()
-			UpgradesInfo.WithLabelValues(cluster.Name, cluster.Namespace, currentVersion.String(), targetVersion.String()).Set(-1)
-			return ctrl.Result{}, err
+			return errors.Wrapf(err, "failed to look up %s", gvk.Kind)
 		}
-
-		log.Info(fmt.Sprintf("The configmap was modified, changed release version %v to %v.", currentVersion, targetVersion))
+		if !installed {
+			r.Log.Info(fmt.Sprintf("The %s CRD is not installed, %s CRs are not watched.", gvk.GroupKind(), gvk.Kind))
+			continue
+		}
+		watch(newUnstructured(gvk), handler.EnqueueRequestsFromMapFunc(mapFunc))
 	}
+	if r.Scheduler != nil {
+		b = b.WatchesRawSource(source.Channel(r.Scheduler.Events(), &handler.EnqueueRequestForObject{}))
+	}
+	err := b.Complete(r)
+	if err != nil {
+		return errors.Wrap(err, "failed setting up with a controller manager")
+	}
+
+	return nil
+}
 
-	if !isCAPIProvider(cluster) {
-		cluster.Labels[label.ReleaseVersion] = getClusterUpgradeVersionAnnotation(cluster)
+// now returns the current time in UTC.
+func (r *ClusterReconciler) now() time.Time {
+	if r.Clock == nil {
+		return time.Now().UTC()
 	}
+	return r.Clock.Now().UTC()
+}
 
-	delete(cluster.Annotations, annotation.UpdateScheduleTargetTime)
-	delete(cluster.Annotations, annotation.UpdateScheduleTargetRelease)
-	delete(cluster.Annotations, ClusterUpgradeAnnouncement)
+func (r *ClusterReconciler) sendClusterUpgradeEvent(ctx context.Context, cluster *clusterv1.Cluster, message string) {
+	_, span := tracer.Start(ctx, "SendAnnouncement")
+	defer span.End()
+	r.Recorder.Event(cluster, ReasonClusterUpgradeAnnouncement, message)
+}
 
-	UpgradesTotal.WithLabelValues(cluster.Name, cluster.Namespace, currentVersion.String(), targetVersion.String()).Inc()
-	err = r.Update(ctx, cluster)
-	if err != nil {
-		log.Error(err, "Failed to update release version tag and remove scheduled upgrade annotations.")
-		FailuresTotal.WithLabelValues(cluster.Name, cluster.Namespace, currentVersion.String(), targetVersion.String()).Inc()
-		UpgradesInfo.WithLabelValues(cluster.Name, cluster.Namespace, currentVersion.String(), targetVersion.String()).Set(-1)
-		return ctrl.Result{}, err
+// trackUpgrade records the upgrade in the store and the metrics.
+func (r *ClusterReconciler) trackUpgrade(upgrade ScheduledUpgrade) {
+	switch {
+	case upgrade.State == UpgradeStatePending && upgrade.Announced:
+		r.setUpgradeMetrics(upgrade, metricStateAnnounced)
+	case upgrade.State == UpgradeStatePending:
+		r.setUpgradeMetrics(upgrade, metricStateScheduled)
+	default:
+		r.setUpgradeMetrics(upgrade, string(upgrade.State))
+	}
+	if r.Upgrades != nil {
+		r.Upgrades.Set(upgrade)
 	}
-	log.Info(fmt.Sprintf("The cluster CR was modified, changed release version %v to %v.", currentVersion, targetVersion))
-	SuccessTotal.WithLabelValues(cluster.Name, cluster.Namespace, currentVersion.String(), targetVersion.String()).Inc()
-	UpgradesInfo.WithLabelValues(cluster.Name, cluster.Namespace, currentVersion.String(), targetVersion.String()).Set(0)
+}
 
-	return defaultRequeue(), nil
+// trackFailedUpgrade records a failed upgrade. Failures before the upgrade was
+// triggered block the upgrade.
+func (r *ClusterReconciler) trackFailedUpgrade(upgrade ScheduledUpgrade, reason string, err error) {
+	state := metricStateFailed
+	if upgrade.State == UpgradeStatePending {
+		state = metricStateBlocked
+	}
+	upgrade.State = UpgradeStateFailed
+	upgrade.Reason = reason
+	upgrade.Message = err.Error()
+	r.setUpgradeMetrics(upgrade, state)
+	if r.Upgrades != nil {
+		r.Upgrades.Set(upgrade)
+	}
 }
 
-// SetupWithManager sets up the controller with the Manager.
-func (r *ClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	err := ctrl.NewControllerManagedBy(mgr).
-		For(&clusterv1.Cluster{}).
-		Complete(r)
+// forgetUpgrade removes the scheduled upgrade of a cluster. Completed upgrades
+// are kept by the store until their retention expired.
+func (r *ClusterReconciler) forgetUpgrade(cluster types.NamespacedName) {
+	r.forgetUpgradeMetrics(cluster)
+	if r.Upgrades != nil {
+		r.Upgrades.DeletePending(r.Installation, cluster)
+	}
+}
+
+// recordHistory adds the record to the upgrade history of the cluster. A
+// failure is reported but does not block the upgrade.
+func (r *ClusterReconciler) recordHistory(ctx context.Context, cluster *clusterv1.Cluster, history UpgradeRecord, log logr.Logger) {
+	err := r.recordUpgrade(ctx, cluster, history)
 	if err != nil {
-		return errors.Wrap(err, "failed setting up with a controller manager")
+		log.Error(err, "Failed to record upgrade history.")
+		r.Recorder.Warnf(cluster, ReasonUpgradeHistoryFailed, "The upgrade from release version %v to %v can not be recorded in ConfigMap %s: %v", history.OriginVersion, history.TargetVersion, UpgradeHistoryName(cluster.Name), err)
 	}
+}
 
-	r.recorder = mgr.GetEventRecorderFor("cluster-controller")
-	return nil
+// warnUpdateFailed emits a Warning event for a failed write and returns its
+// reason. Conflicts get their own reason because they are retried and usually
+// resolve themselves.
+func (r *ClusterReconciler) warnUpdateFailed(cluster *clusterv1.Cluster, err error, message string) string {
+	if apierrors.IsConflict(err) {
+		r.Recorder.Warnf(cluster, ReasonUpdateConflict, "%s because the object was modified concurrently. The operation will be retried.", message)
+		return ReasonUpdateConflict
+	}
+	r.Recorder.Warnf(cluster, ReasonUpdateFailed, "%s: %v", message, err)
+	return ReasonUpdateFailed
+}
+
+// scheduleAnnotations are the annotations an upgrade step is decided on.
+var scheduleAnnotations = []string{
+	annotation.UpdateScheduleTargetRelease,
+	annotation.UpdateScheduleTargetTime,
+	ClusterUpgradeScheduledAt,
+	ClusterUpgradeAnnouncement,
+	ClusterUpgradeApprovedBy,
+	ClusterUpgradeEndOfLife,
+	ClusterUpgradeInProgress,
+}
+
+// patchClusterLocked patches the change made by mutate to the cluster with an
+// optimistic lock. On conflicts the cluster is read again and the change is
+// retried as long as the latest cluster has the release and schedule the
+// change was decided on. It returns false without an error if they changed,
+// the cluster is the latest one then.
+func (r *ClusterReconciler) patchClusterLocked(ctx context.Context, cluster *clusterv1.Cluster, decided *clusterv1.Cluster, mutate func(cluster *clusterv1.Cluster) error) (bool, error) {
+	retried, patched := false, false
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if retried {
+			latest := &clusterv1.Cluster{}
+			if err := r.tracedGet(ctx, "GetCluster", client.ObjectKeyFromObject(cluster), latest); err != nil {
+				return err
+			}
+			latest.DeepCopyInto(cluster)
+			if !scheduleUnchanged(decided, cluster) {
+				return nil
+			}
+		}
+		retried = true
+
+		base := cluster.DeepCopy()
+		if err := mutate(cluster); err != nil {
+			return err
+		}
+		if err := r.tracedPatch(ctx, "PatchCluster", cluster, client.MergeFromWithOptions(base, client.MergeFromWithOptimisticLock{})); err != nil {
+			return err
+		}
+		patched = true
+		return nil
+	})
+	return patched, err
 }
 
-func (r *ClusterReconciler) sendClusterUpgradeEvent(cluster *clusterv1.Cluster, message string) {
-	r.recorder.Eventf(cluster, corev1.EventTypeNormal, "ClusterUpgradeAnnouncement", message)
+// scheduleUnchanged returns true if the latest cluster has the release
+// version and the schedule of the decided one.
+func scheduleUnchanged(decided *clusterv1.Cluster, latest *clusterv1.Cluster) bool {
+	if getClusterReleaseVersionLabel(decided) != getClusterReleaseVersionLabel(latest) {
+		return false
+	}
+	for _, key := range scheduleAnnotations {
+		value, ok := decided.Annotations[key]
+		latestValue, latestOk := latest.Annotations[key]
+		if ok != latestOk || value != latestValue {
+			return false
+		}
+	}
+	return true
 }
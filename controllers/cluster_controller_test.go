@@ -6,7 +6,9 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -14,20 +16,27 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
-	"k8s.io/client-go/tools/record"
+	k8srecord "k8s.io/client-go/tools/record"
+	clocktesting "k8s.io/utils/clock/testing"
 
 	capi "sigs.k8s.io/cluster-api/api/v1beta1"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/giantswarm/upgrade-schedule-operator/api/v1alpha1"
+	"github.com/giantswarm/upgrade-schedule-operator/util/record"
 )
 
 var (
-	fakeScheme = runtime.NewScheme()
+	fakeScheme   = runtime.NewScheme()
+	fakeRecorder = k8srecord.NewFakeRecorder(10)
 )
 
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(fakeScheme))
 	_ = capi.AddToScheme(fakeScheme)
+	utilruntime.Must(v1alpha1.AddToScheme(fakeScheme))
+	record.InitFromRecorder(fakeRecorder)
 }
 
 func TestClusterController(t *testing.T) {
@@ -35,6 +44,8 @@ func TestClusterController(t *testing.T) {
 		name                   string
 		expectedReleaseVersion string
 		expectedEventTriggered bool
+		expectedWarning        string
+		expectedErr            bool
 		annotationsKept        bool
 
 		cluster   *capi.Cluster
@@ -60,6 +71,7 @@ func TestClusterController(t *testing.T) {
 					Annotations: map[string]string{
 						"alpha.giantswarm.io/update-schedule-target-release": "15.2.1",
 						"alpha.giantswarm.io/update-schedule-target-time":    "10 Sep 21 12:00 UTC",
+						ClusterUpgradeScheduledAt:                            "2021-09-09T12:00:00Z",
 					},
 				},
 			},
@@ -84,6 +96,7 @@ func TestClusterController(t *testing.T) {
 					Annotations: map[string]string{
 						"alpha.giantswarm.io/update-schedule-target-release": "15.2.1",
 						"alpha.giantswarm.io/update-schedule-target-time":    "11 Sep 21 12:00 UTC",
+						ClusterUpgradeScheduledAt:                            "2021-09-10T12:00:00Z",
 					},
 				},
 			},
@@ -108,6 +121,7 @@ func TestClusterController(t *testing.T) {
 					Annotations: map[string]string{
 						"alpha.giantswarm.io/update-schedule-target-release": "15.2.1",
 						"alpha.giantswarm.io/update-schedule-target-time":    "13 Sep 21 19:00 UTC",
+						ClusterUpgradeScheduledAt:                            "2021-09-12T19:00:00Z",
 					},
 				},
 			},
@@ -132,6 +146,7 @@ func TestClusterController(t *testing.T) {
 					Annotations: map[string]string{
 						"alpha.giantswarm.io/update-schedule-target-release": "15.2.1",
 						"alpha.giantswarm.io/update-schedule-target-time":    "31 Dec 50 20:00 UTC",
+						ClusterUpgradeScheduledAt:                            "2050-12-30T20:00:00Z",
 					},
 				},
 			},
@@ -155,6 +170,7 @@ func TestClusterController(t *testing.T) {
 					Annotations: map[string]string{
 						"alpha.giantswarm.io/update-schedule-target-release": "26.0.0",
 						"alpha.giantswarm.io/update-schedule-target-time":    "31 Jul 24 14:00 UTC",
+						ClusterUpgradeScheduledAt:                            "2024-07-30T14:00:00Z",
 					},
 				},
 			},
@@ -189,22 +205,71 @@ func TestClusterController(t *testing.T) {
 				},
 			},
 		},
+		// invalid target release, warning emitted
+		{
+			name:                   "case 5",
+			expectedReleaseVersion: "14.2.2",
+			expectedEventTriggered: false,
+			expectedWarning:        ReasonTargetReleaseInvalid,
+			expectedErr:            true,
+			annotationsKept:        true,
+			cluster: &capi.Cluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test4",
+					Namespace: "default",
+					Labels: map[string]string{
+						"giantswarm.io/cluster":         "h4x8z",
+						"giantswarm.io/organization":    "giantswarm",
+						"release.giantswarm.io/version": "14.2.2",
+					},
+					Annotations: map[string]string{
+						"alpha.giantswarm.io/update-schedule-target-release": "v15.2",
+						"alpha.giantswarm.io/update-schedule-target-time":    "31 Dec 50 20:00 UTC",
+						ClusterUpgradeScheduledAt:                            "2050-12-30T20:00:00Z",
+					},
+				},
+			},
+		},
+		// missing userconfig configmap, warning emitted
+		{
+			name:                   "case 6",
+			expectedEventTriggered: true,
+			expectedWarning:        ReasonUserConfigNotFound,
+			expectedErr:            true,
+			annotationsKept:        true,
+			cluster: &capi.Cluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test5",
+					Namespace: "org-giantswarm",
+					Labels: map[string]string{
+						"giantswarm.io/cluster":         "k2f9a",
+						"giantswarm.io/organization":    "giantswarm",
+						"release.giantswarm.io/version": "25.0.0",
+						"cluster.x-k8s.io/watch-filter": "capi",
+					},
+					Annotations: map[string]string{
+						"alpha.giantswarm.io/update-schedule-target-release": "26.0.0",
+						"alpha.giantswarm.io/update-schedule-target-time":    "31 Jul 24 14:00 UTC",
+						ClusterUpgradeScheduledAt:                            "2024-07-30T14:00:00Z",
+					},
+				},
+			},
+		},
 	}
 
 	for i, tc := range testCases {
 		t.Run(strconv.Itoa(i), func(t *testing.T) {
 			t.Log(tc.name)
 			fakeClient := fake.NewClientBuilder().WithScheme(fakeScheme).WithObjects(tc.cluster).Build()
-			fakeRecorder := record.NewFakeRecorder(1)
 			r := &ClusterReconciler{
-				Client:   fakeClient,
-				Scheme:   fakeScheme,
-				Log:      ctrl.Log.WithName("fake"),
-				recorder: fakeRecorder,
+				Client: fakeClient,
+				Scheme: fakeScheme,
+				Log:    ctrl.Log.WithName("fake"),
+				Clock:  clocktesting.NewFakeClock(time.Date(2024, 9, 1, 12, 0, 0, 0, time.UTC)),
 			}
 			ctx := context.TODO()
 
-			if isCAPIProvider(tc.cluster) {
+			if tc.configMap != nil {
 				err := fakeClient.Create(ctx, tc.configMap)
 				if err != nil {
 					t.Error(err)
@@ -212,8 +277,8 @@ func TestClusterController(t *testing.T) {
 			}
 
 			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: tc.cluster.GetName(), Namespace: tc.cluster.GetNamespace()}})
-			if err != nil {
-				t.Error(err)
+			if (err != nil) != tc.expectedErr {
+				t.Errorf("expected error to be %v, got %v", tc.expectedErr, err)
 			}
 
 			obj := &capi.Cluster{}
@@ -222,7 +287,7 @@ func TestClusterController(t *testing.T) {
 				t.Error(err)
 			}
 
-			if isCAPIProvider(tc.cluster) {
+			if tc.configMap != nil {
 				cm := &corev1.ConfigMap{}
 				err = fakeClient.Get(ctx, types.NamespacedName{Name: tc.configMap.GetName(), Namespace: tc.configMap.GetNamespace()}, cm)
 				if err != nil {
@@ -231,7 +296,7 @@ func TestClusterController(t *testing.T) {
 				if !strings.Contains(cm.Data["values"], fmt.Sprintf("version: %s", tc.expectedReleaseVersion)) {
 					t.Fatalf("expected release to be %v, got %s", tc.expectedReleaseVersion, cm.Data["values"])
 				}
-			} else {
+			} else if !isCAPIProvider(tc.cluster) {
 				if obj.Labels["release.giantswarm.io/version"] != tc.expectedReleaseVersion {
 					t.Fatalf("expected release.giantswarm.io/version to be %v, got %s", tc.expectedReleaseVersion, obj.Labels["release.giantswarm.io/version"])
 				}
@@ -246,12 +311,16 @@ func TestClusterController(t *testing.T) {
 			}
 
 			triggered := false
+			warning := ""
 			for eventsLeft := true; eventsLeft; {
 				select {
 				case event := <-fakeRecorder.Events:
-					if strings.Contains(event, "ClusterUpgradeAnnouncement") {
+					if strings.Contains(event, ReasonClusterUpgradeAnnouncement) {
 						t.Log(event)
 						triggered = true
+					} else if strings.HasPrefix(event, corev1.EventTypeWarning) {
+						t.Log(event)
+						warning = strings.Fields(event)[1]
 					} else {
 						t.Fatalf("test case %v failed. unexpected event %v", tc.name, event)
 					}
@@ -260,10 +329,221 @@ func TestClusterController(t *testing.T) {
 				}
 			}
 			assert.Equal(t, tc.expectedEventTriggered, triggered, "test case %v failed.", tc.name)
+			assert.Equal(t, tc.expectedWarning, warning, "test case %v failed.", tc.name)
 		})
 	}
 }
 
+// TestClusterControllerLifecycle walks a scheduled upgrade through
+// announcement and trigger by advancing a fake clock.
+func TestClusterControllerLifecycle(t *testing.T) {
+	drainEvents()
+
+	upgradeTime := time.Date(2025, 3, 12, 12, 0, 0, 0, time.UTC)
+	cluster := &capi.Cluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "lifecycle",
+			Namespace: "org-giantswarm",
+			UID:       "5e2f0b1c-lifecycle",
+			Labels: map[string]string{
+				"giantswarm.io/cluster":         "lifecycle",
+				"giantswarm.io/organization":    "giantswarm",
+				"release.giantswarm.io/version": "14.2.2",
+			},
+			Annotations: map[string]string{
+				"alpha.giantswarm.io/update-schedule-target-release": "15.2.1",
+				"alpha.giantswarm.io/update-schedule-target-time":    "12 Mar 25 12:00 UTC",
+				ClusterUpgradeScheduledAt:                            "2025-03-11T12:00:00Z",
+			},
+		},
+	}
+	fakeClock := clocktesting.NewFakeClock(upgradeTime.Add(-time.Hour))
+	fakeClient := fake.NewClientBuilder().WithScheme(fakeScheme).WithObjects(cluster).Build()
+	r := &ClusterReconciler{
+		Client:   fakeClient,
+		Scheme:   fakeScheme,
+		Log:      ctrl.Log.WithName("fake"),
+		Upgrades: NewUpgradeStore(fakeClock),
+		Clock:    fakeClock,
+	}
+	ctx := context.TODO()
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: cluster.GetName(), Namespace: cluster.GetNamespace()}}
+
+	steps := []struct {
+		name                 string
+		now                  time.Time
+		expectedRequeueAfter time.Duration
+		expectedEvent        string
+		expectedState        UpgradeState
+		expectedMetricState  string
+		expectedAnnounced    bool
+		expectedRelease      string
+	}{
+		{
+			name:                 "scheduled",
+			now:                  upgradeTime.Add(-time.Hour),
+			expectedRequeueAfter: 45*time.Minute + time.Second,
+			expectedState:        UpgradeStatePending,
+			expectedMetricState:  metricStateScheduled,
+			expectedRelease:      "14.2.2",
+		},
+		{
+			name:                 "announced",
+			now:                  upgradeTime.Add(-10 * time.Minute),
+			expectedRequeueAfter: 10*time.Minute + time.Second,
+			expectedEvent:        "is scheduled to start in 10m0s.",
+			expectedState:        UpgradeStatePending,
+			expectedMetricState:  metricStateAnnounced,
+			expectedAnnounced:    true,
+			expectedRelease:      "14.2.2",
+		},
+		{
+			name:                 "due soon",
+			now:                  upgradeTime.Add(-2 * time.Minute),
+			expectedRequeueAfter: 2*time.Minute + time.Second,
+			expectedState:        UpgradeStatePending,
+			expectedMetricState:  metricStateAnnounced,
+			expectedAnnounced:    true,
+			expectedRelease:      "14.2.2",
+		},
+		{
+			name:                 "triggered",
+			now:                  upgradeTime.Add(time.Second),
+			expectedRequeueAfter: 2*time.Hour + time.Second,
+			expectedState:        UpgradeStateInProgress,
+			expectedMetricState:  metricStateInProgress,
+			expectedAnnounced:    true,
+			expectedRelease:      "15.2.1",
+		},
+		{
+			name:                "verified",
+			now:                 upgradeTime.Add(5*time.Minute + time.Second),
+			expectedEvent:       "was upgraded from release version 14.2.2 to 15.2.1 in 5m0s.",
+			expectedState:       UpgradeStateCompleted,
+			expectedMetricState: metricStateCompleted,
+			expectedAnnounced:   true,
+			expectedRelease:     "15.2.1",
+		},
+	}
+
+	for _, step := range steps {
+		fakeClock.SetTime(step.now)
+
+		result, err := r.Reconcile(ctx, req)
+		assert.NoError(t, err, step.name)
+		assert.Equal(t, step.expectedRequeueAfter, result.RequeueAfter, step.name)
+
+		events := drainEvents()
+		if step.expectedEvent == "" {
+			assert.Empty(t, events, step.name)
+		} else if assert.Len(t, events, 1, step.name) {
+			assert.Contains(t, events[0], step.expectedEvent, step.name)
+		}
+
+		obj := &capi.Cluster{}
+		assert.NoError(t, fakeClient.Get(ctx, req.NamespacedName, obj))
+		assert.Equal(t, step.expectedRelease, obj.Labels["release.giantswarm.io/version"], step.name)
+
+		upgrade, ok := r.Upgrades.Get(r.Installation, req.NamespacedName)
+		assert.True(t, ok, step.name)
+		assert.Equal(t, step.expectedState, upgrade.State, step.name)
+		assert.Equal(t, step.expectedAnnounced, upgrade.Announced, step.name)
+		assert.Equal(t, float64(1), testutil.ToFloat64(UpgradeStateInfo.WithLabelValues(r.Installation, req.Name, req.Namespace, step.expectedMetricState)), step.name)
+	}
+
+	cm := &corev1.ConfigMap{}
+	assert.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "lifecycle-upgrade-history", Namespace: "org-giantswarm"}, cm))
+	history, err := ParseUpgradeHistory(cm)
+	assert.NoError(t, err)
+	if assert.Len(t, history, 1) {
+		assert.Equal(t, "14.2.2", history[0].OriginVersion)
+		assert.Equal(t, "15.2.1", history[0].TargetVersion)
+		assert.Equal(t, upgradeTime, history[0].UpgradeTime)
+		assert.Equal(t, upgradeTime.Add(-10*time.Minute), *history[0].AnnouncedAt)
+		assert.Equal(t, upgradeTime.Add(time.Second), history[0].TriggeredAt)
+		assert.Equal(t, upgradeTime.Add(5*time.Minute+time.Second), *history[0].CompletedAt)
+		assert.Equal(t, UpgradeStateCompleted, history[0].Outcome)
+	}
+	assert.Empty(t, cm.OwnerReferences, "the history is not deleted with the cluster")
+
+	// Completed upgrades are forgotten once their retention expired.
+	fakeClock.SetTime(upgradeTime.Add(25 * time.Hour))
+	_, err = r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.Empty(t, r.Upgrades.List())
+}
+
+// TestClusterControllerVerificationTimeout checks that a triggered upgrade of
+// a cluster which does not become ready is given up after the timeout.
+func TestClusterControllerVerificationTimeout(t *testing.T) {
+	drainEvents()
+
+	triggeredAt := time.Date(2025, 3, 12, 12, 0, 0, 0, time.UTC)
+	cluster := &capi.Cluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "unhealthy",
+			Namespace: "org-giantswarm",
+			Labels: map[string]string{
+				"release.giantswarm.io/version": "15.2.1",
+			},
+			Annotations: map[string]string{
+				ClusterUpgradeInProgress: `{"origin":"14.2.2","target":"15.2.1","scheduledAt":"2025-03-12T12:00:00Z","triggeredAt":"2025-03-12T12:00:00Z"}`,
+			},
+		},
+		Status: capi.ClusterStatus{
+			Conditions: capi.Conditions{
+				{Type: capi.ReadyCondition, Status: corev1.ConditionFalse},
+			},
+		},
+	}
+	fakeClock := clocktesting.NewFakeClock(triggeredAt.Add(time.Hour))
+	fakeClient := fake.NewClientBuilder().WithScheme(fakeScheme).WithObjects(cluster).Build()
+	r := &ClusterReconciler{
+		Client:   fakeClient,
+		Scheme:   fakeScheme,
+		Log:      ctrl.Log.WithName("fake"),
+		Upgrades: NewUpgradeStore(fakeClock),
+		Clock:    fakeClock,
+	}
+	ctx := context.TODO()
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: cluster.GetName(), Namespace: cluster.GetNamespace()}}
+
+	result, err := r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Hour+time.Second, result.RequeueAfter)
+	assert.Empty(t, drainEvents())
+	upgrade, _ := r.Upgrades.Get(r.Installation, req.NamespacedName)
+	assert.Equal(t, UpgradeStateInProgress, upgrade.State)
+
+	fakeClock.SetTime(triggeredAt.Add(2*time.Hour + time.Second))
+	_, err = r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	events := drainEvents()
+	if assert.Len(t, events, 1) {
+		assert.Contains(t, events[0], ReasonUpgradeVerificationTimeout)
+	}
+	upgrade, _ = r.Upgrades.Get(r.Installation, req.NamespacedName)
+	assert.Equal(t, UpgradeStateFailed, upgrade.State)
+	assert.Equal(t, float64(1), testutil.ToFloat64(UpgradeStateInfo.WithLabelValues(r.Installation, req.Name, req.Namespace, metricStateFailed)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(UpgradeStateReason.WithLabelValues(r.Installation, req.Name, req.Namespace, ReasonUpgradeVerificationTimeout)))
+
+	obj := &capi.Cluster{}
+	assert.NoError(t, fakeClient.Get(ctx, req.NamespacedName, obj))
+	assert.NotContains(t, obj.Annotations, ClusterUpgradeInProgress)
+}
+
+func drainEvents() []string {
+	var events []string
+	for {
+		select {
+		case event := <-fakeRecorder.Events:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
 func StringPtr(s string) *string {
 	return &s
 }
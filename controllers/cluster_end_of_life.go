@@ -0,0 +1,214 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/blang/semver"
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// ClusterUpgradeEndOfLife marks an upgrade scheduled by the operator
+	// because the release of the cluster reached its end of life. The value
+	// is the number of reminders sent.
+	ClusterUpgradeEndOfLife = "alpha.giantswarm.io/update-schedule-end-of-life"
+
+	ReasonReleaseEndOfLife          = "ReleaseEndOfLife"
+	ReasonEndOfLifeUpgradeScheduled = "EndOfLifeUpgradeScheduled"
+	ReasonEndOfLifeUpgradeReminder  = "EndOfLifeUpgradeReminder"
+)
+
+// endOfLifeReminders are the times before an end of life upgrade reminders
+// are sent at, in addition to the announcement.
+var endOfLifeReminders = []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour}
+
+// reconcileEndOfLife warns if the cluster runs a release that reached its end
+// of life and, if the upgrade policy allows it, schedules an upgrade to the
+// oldest supported release. It returns nil if the reconcile continues.
+func (r *ClusterReconciler) reconcileEndOfLife(ctx context.Context, cluster *clusterv1.Cluster, log logr.Logger) (*ctrl.Result, error) {
+	key := client.ObjectKeyFromObject(cluster)
+	currentVersion, err := semver.New(getClusterReleaseVersionLabel(cluster))
+	if err != nil {
+		return nil, nil
+	}
+	releases, err := r.listReleases(ctx)
+	if err != nil {
+		log.Error(err, "Failed to list the releases, skipping the end of life check.")
+		return nil, nil
+	}
+	prefix := releasePrefix(cluster)
+	now := r.now()
+	endOfLife, ok := releaseEndOfLife(releases, prefix, *currentVersion)
+	if !ok || now.Before(endOfLife) {
+		r.setEndOfLifeMetric(key, false)
+		return nil, nil
+	}
+	r.setEndOfLifeMetric(key, true)
+	if getClusterUpgradeTimeAnnotation(cluster) != "" {
+		return nil, nil
+	}
+
+	log.Info(fmt.Sprintf("The release version %v reached its end of life.", currentVersion))
+	r.Recorder.Warnf(cluster, ReasonReleaseEndOfLife, "The cluster runs release version %v which reached its end of life on %v. Please upgrade to a supported release.", currentVersion, endOfLife.Format(time.RFC822))
+
+	policy, err := GetEffectivePolicy(ctx, r.Client, cluster.Namespace)
+	if err != nil {
+		log.Error(err, "Failed to get the upgrade policy.")
+		r.Recorder.Warnf(cluster, ReasonUpgradePolicyFailed, "The upgrade policy of namespace %s can not be read: %v", cluster.Namespace, err)
+		return &ctrl.Result{}, err
+	}
+	if !policy.EndOfLifeUpgrades() {
+		return nil, nil
+	}
+	target, ok := oldestSupportedRelease(releases, prefix, *currentVersion, now)
+	if !ok {
+		log.Info("There is no supported release to upgrade to.")
+		return nil, nil
+	}
+
+	upgradeTime := r.automaticUpgradeTime(cluster, policy, *currentVersion, target, log)
+	if upgradeTime.IsZero() {
+		return &ctrl.Result{}, nil
+	}
+	// Reminders due by the time the upgrade is scheduled are covered by the
+	// scheduled event.
+	scheduled, err := r.scheduleUpgrade(ctx, cluster, target, upgradeTime, map[string]string{
+		ClusterUpgradeEndOfLife: strconv.Itoa(dueReminders(upgradeTime, now)),
+	}, log)
+	if err != nil || !scheduled {
+		return &ctrl.Result{}, err
+	}
+	r.Recorder.Warnf(cluster, ReasonEndOfLifeUpgradeScheduled, "The cluster runs release version %v which reached its end of life. It will be upgraded to release version %v at %v unless another upgrade is scheduled.",
+		currentVersion,
+		target,
+		FormatUpgradeTime(upgradeTime),
+	)
+	return &ctrl.Result{}, nil
+}
+
+// reconcileEndOfLifeReminder sends the reminders of an end of life upgrade
+// that are due. It returns a result if the reminder could not be recorded and
+// the reconcile has to stop.
+func (r *ClusterReconciler) reconcileEndOfLifeReminder(ctx context.Context, cluster *clusterv1.Cluster, upgrade ScheduledUpgrade, log logr.Logger) (*ctrl.Result, error) {
+	value, ok := cluster.Annotations[ClusterUpgradeEndOfLife]
+	if !ok || upgrade.Announced {
+		return nil, nil
+	}
+	sent, _ := strconv.Atoi(value)
+	due := dueReminders(upgrade.Time, r.now())
+	if due <= sent {
+		return nil, nil
+	}
+
+	// The reminder is sent once it was recorded, a conflicting change of the
+	// schedule leaves it to the next reconcile.
+	patched, err := r.patchClusterLocked(ctx, cluster, cluster.DeepCopy(), func(cluster *clusterv1.Cluster) error {
+		cluster.Annotations[ClusterUpgradeEndOfLife] = strconv.Itoa(due)
+		return nil
+	})
+	if err != nil {
+		log.Error(err, "Failed to record the sent end of life reminder.")
+		reason := r.warnUpdateFailed(cluster, err, "Failed to record the sent end of life reminder")
+		r.trackFailedUpgrade(upgrade, reason, err)
+		return &ctrl.Result{}, err
+	}
+	if !patched {
+		log.Info("The schedule changed while the end of life reminder was recorded. The change will be reconciled.")
+		return &ctrl.Result{}, nil
+	}
+	r.Recorder.Warnf(cluster, ReasonEndOfLifeUpgradeReminder, "The cluster runs release version %v which reached its end of life. It will be upgraded to release version %v in %v.",
+		upgrade.OriginVersion,
+		upgrade.TargetVersion,
+		upgrade.Time.Sub(r.now()).Round(time.Minute),
+	)
+	return nil, nil
+}
+
+// nextEndOfLifeReminder returns the time of the next end of life reminder of
+// an upgrade at upgradeTime after now, if there is one.
+func nextEndOfLifeReminder(upgradeTime time.Time, now time.Time) (time.Time, bool) {
+	for _, reminder := range endOfLifeReminders {
+		if t := upgradeTime.Add(-reminder); t.After(now) {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// endOfLifeRequeue requeues a cluster without scheduled upgrade when its
+// release reaches its end of life, so that the end of life is handled in time.
+func (r *ClusterReconciler) endOfLifeRequeue(ctx context.Context, cluster *clusterv1.Cluster) ctrl.Result {
+	currentVersion, err := semver.New(getClusterReleaseVersionLabel(cluster))
+	if err != nil {
+		return ctrl.Result{}
+	}
+	releases, err := r.listReleases(ctx)
+	if err != nil {
+		return ctrl.Result{}
+	}
+	endOfLife, ok := releaseEndOfLife(releases, releasePrefix(cluster), *currentVersion)
+	if !ok || !r.now().Before(endOfLife) {
+		return ctrl.Result{}
+	}
+	return r.requeueAt(cluster, ActionEndOfLife, endOfLife)
+}
+
+// dueReminders returns the number of end of life reminders due at now for an
+// upgrade at upgradeTime.
+func dueReminders(upgradeTime time.Time, now time.Time) int {
+	due := 0
+	for _, reminder := range endOfLifeReminders {
+		if upgradeTime.Sub(now) <= reminder {
+			due++
+		}
+	}
+	return due
+}
+
+// releaseEndOfLife returns the end of life date of the current release. It
+// returns false if the release is unknown or has no end of life date.
+func releaseEndOfLife(releases []availableRelease, prefix string, current semver.Version) (time.Time, bool) {
+	for _, release := range releases {
+		version, ok := release.version(prefix)
+		if ok && version.Equals(current) && !release.EndOfLife.IsZero() {
+			return release.EndOfLife, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// oldestSupportedRelease returns the lowest active release version named with
+// the prefix that is newer than the current version and has not reached its
+// end of life at now.
+func oldestSupportedRelease(releases []availableRelease, prefix string, current semver.Version, now time.Time) (semver.Version, bool) {
+	var oldest *semver.Version
+	for _, release := range releases {
+		version, ok := release.activeVersion(prefix)
+		if !ok || !version.GT(current) || (!release.EndOfLife.IsZero() && !now.Before(release.EndOfLife)) {
+			continue
+		}
+		if oldest == nil || version.LT(*oldest) {
+			oldest = &version
+		}
+	}
+	if oldest == nil {
+		return semver.Version{}, false
+	}
+	return *oldest, true
+}
+
+// setEndOfLifeMetric sets the end of life gauge of the cluster.
+func (r *ClusterReconciler) setEndOfLifeMetric(key types.NamespacedName, endOfLife bool) {
+	value := 0.0
+	if endOfLife {
+		value = 1
+	}
+	ReleaseEndOfLife.WithLabelValues(r.Installation, key.Name, key.Namespace).Set(value)
+}
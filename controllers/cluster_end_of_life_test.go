@@ -0,0 +1,205 @@
+package controllers
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blang/semver"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clocktesting "k8s.io/utils/clock/testing"
+	"k8s.io/utils/ptr"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/giantswarm/upgrade-schedule-operator/api/v1alpha1"
+)
+
+func TestOldestSupportedRelease(t *testing.T) {
+	now := time.Date(2025, 3, 10, 9, 30, 0, 0, time.UTC)
+	releases := []availableRelease{
+		{Name: "v15.2.1", State: "active", EndOfLife: now.Add(-time.Hour)},
+		{Name: "v15.2.3", State: "active", EndOfLife: now.Add(-time.Hour)},
+		{Name: "v15.3.0", State: "deprecated"},
+		{Name: "v16.1.0", State: "active"},
+		{Name: "v16.0.0", State: "active", EndOfLife: now.Add(time.Hour)},
+		{Name: "aws-15.2.2", State: "active"},
+	}
+
+	testCases := []struct {
+		name            string
+		prefix          string
+		current         string
+		expectedVersion string
+	}{
+		{
+			name:            "case 0: oldest release without end of life",
+			prefix:          "v",
+			current:         "15.2.1",
+			expectedVersion: "16.0.0",
+		},
+		{
+			name:            "case 1: releases of the provider",
+			prefix:          "aws-",
+			current:         "15.2.1",
+			expectedVersion: "15.2.2",
+		},
+		{
+			name:    "case 2: no newer supported release",
+			prefix:  "v",
+			current: "16.1.0",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			version, ok := oldestSupportedRelease(releases, tc.prefix, semver.MustParse(tc.current), now)
+			if tc.expectedVersion == "" {
+				assert.False(t, ok)
+			} else {
+				assert.True(t, ok)
+				assert.Equal(t, tc.expectedVersion, version.String())
+			}
+		})
+	}
+}
+
+func TestClusterControllerEndOfLife(t *testing.T) {
+	// Monday.
+	now := time.Date(2025, 3, 10, 9, 30, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name        string
+		endOfLife   time.Time
+		policy      *v1alpha1.UpgradePolicySpec
+		schedule    map[string]string
+		expectedEOL float64
+
+		expectedVersion   string
+		expectedTime      string
+		expectedReminders string
+		expectedEvent     string
+	}{
+		{
+			name:        "case 0: supported release",
+			endOfLife:   now.Add(time.Hour),
+			expectedEOL: 0,
+		},
+		{
+			name:          "case 1: end of life release",
+			endOfLife:     now.Add(-time.Hour),
+			expectedEOL:   1,
+			expectedEvent: ReasonReleaseEndOfLife,
+		},
+		{
+			name:              "case 2: end of life upgrade allowed by the policy",
+			endOfLife:         now.Add(-time.Hour),
+			policy:            &v1alpha1.UpgradePolicySpec{EndOfLifeUpgrades: ptr.To(true)},
+			expectedEOL:       1,
+			expectedVersion:   "15.3.0",
+			expectedTime:      "13 Mar 25 10:00 UTC",
+			expectedReminders: "1",
+			expectedEvent:     ReasonEndOfLifeUpgradeScheduled,
+		},
+		{
+			name:        "case 3: end of life upgrade reminder",
+			endOfLife:   now.Add(-time.Hour),
+			policy:      &v1alpha1.UpgradePolicySpec{EndOfLifeUpgrades: ptr.To(true)},
+			expectedEOL: 1,
+			schedule: map[string]string{
+				"alpha.giantswarm.io/update-schedule-target-release": "15.3.0",
+				"alpha.giantswarm.io/update-schedule-target-time":    "11 Mar 25 08:00 UTC",
+				ClusterUpgradeScheduledAt:                            "2025-03-10T08:00:00Z",
+				ClusterUpgradeEndOfLife:                              "1",
+			},
+			expectedVersion:   "15.3.0",
+			expectedTime:      "11 Mar 25 08:00 UTC",
+			expectedReminders: "2",
+			expectedEvent:     ReasonEndOfLifeUpgradeReminder,
+		},
+		{
+			name:        "case 4: upgrade scheduled by the customer",
+			endOfLife:   now.Add(-time.Hour),
+			policy:      &v1alpha1.UpgradePolicySpec{EndOfLifeUpgrades: ptr.To(true)},
+			expectedEOL: 1,
+			schedule: map[string]string{
+				"alpha.giantswarm.io/update-schedule-target-release": "16.0.0",
+				"alpha.giantswarm.io/update-schedule-target-time":    "11 Mar 25 08:00 UTC",
+				ClusterUpgradeScheduledAt:                            "2025-03-10T08:00:00Z",
+			},
+			expectedVersion: "16.0.0",
+			expectedTime:    "11 Mar 25 08:00 UTC",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+			drainEvents()
+
+			cluster := &capi.Cluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "eol",
+					Namespace: "org-acme",
+					Labels: map[string]string{
+						"release.giantswarm.io/version": "15.2.1",
+					},
+					Annotations: map[string]string{},
+				},
+			}
+			for k, v := range tc.schedule {
+				cluster.Annotations[k] = v
+			}
+			current := newRelease("v15.2.1", "active")
+			current.Object["spec"].(map[string]interface{})["endOfLifeDate"] = tc.endOfLife.Format(time.RFC3339)
+			objects := []client.Object{cluster, current, newRelease("v15.3.0", "active"), newRelease("v16.0.0", "active")}
+			if tc.policy != nil {
+				objects = append(objects, &v1alpha1.UpgradePolicy{
+					ObjectMeta: metav1.ObjectMeta{Name: "acme", Namespace: "org-acme"},
+					Spec:       *tc.policy,
+				})
+			}
+
+			mapper := meta.NewDefaultRESTMapper(nil)
+			mapper.Add(capi.GroupVersion.WithKind("Cluster"), meta.RESTScopeNamespace)
+			mapper.Add(v1alpha1.GroupVersion.WithKind("UpgradePolicy"), meta.RESTScopeNamespace)
+			mapper.Add(releaseListGVK.GroupVersion().WithKind("Release"), meta.RESTScopeRoot)
+
+			fakeClock := clocktesting.NewFakeClock(now)
+			fakeClient := fake.NewClientBuilder().WithScheme(fakeScheme).WithRESTMapper(mapper).WithObjects(objects...).Build()
+			r := &ClusterReconciler{
+				Client:   fakeClient,
+				Scheme:   fakeScheme,
+				Log:      ctrl.Log.WithName("fake"),
+				Upgrades: NewUpgradeStore(fakeClock),
+				Clock:    fakeClock,
+			}
+			ctx := context.TODO()
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: cluster.GetName(), Namespace: cluster.GetNamespace()}}
+
+			_, err := r.Reconcile(ctx, req)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedEOL, testutil.ToFloat64(ReleaseEndOfLife.WithLabelValues(r.Installation, "eol", "org-acme")))
+
+			obj := &capi.Cluster{}
+			assert.NoError(t, fakeClient.Get(ctx, req.NamespacedName, obj))
+			assert.Equal(t, tc.expectedVersion, obj.Annotations["alpha.giantswarm.io/update-schedule-target-release"])
+			assert.Equal(t, tc.expectedTime, obj.Annotations["alpha.giantswarm.io/update-schedule-target-time"])
+			assert.Equal(t, tc.expectedReminders, obj.Annotations[ClusterUpgradeEndOfLife])
+
+			event := ""
+			for _, e := range drainEvents() {
+				event = strings.Fields(e)[1]
+			}
+			assert.Equal(t, tc.expectedEvent, event)
+		})
+	}
+}
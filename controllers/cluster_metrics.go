@@ -1,7 +1,11 @@
 package controllers
 
 import (
+	"sync"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
 )
 
@@ -12,7 +16,7 @@ const (
 
 // Counters for total applied and failed scheduled upgrades
 var (
-	counterLabels = []string{"cluster_id", "cluster_namespace", "origin_version", "target_version"}
+	counterLabels = []string{"installation", "cluster_id", "cluster_namespace", "origin_version", "target_version"}
 
 	UpgradesTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
@@ -43,22 +47,387 @@ var (
 	)
 )
 
-// Gauge for all clusters scheduled upgrade time
+// Upgrade states of the scheduled_upgrade_state gauge.
+const (
+	metricStateNone            = "none"
+	metricStateScheduled       = "scheduled"
+	metricStatePendingApproval = "pending_approval"
+	metricStateAnnounced       = "announced"
+	metricStateBlocked         = "blocked"
+	metricStateInProgress      = "in_progress"
+	metricStateFailed          = "failed"
+	metricStateCompleted       = "completed"
+)
+
+// metricStates are the states of the scheduled_upgrade_state gauge, which has
+// a series for each of them per cluster.
+var metricStates = []string{
+	metricStateNone,
+	metricStateScheduled,
+	metricStatePendingApproval,
+	metricStateAnnounced,
+	metricStateBlocked,
+	metricStateInProgress,
+	metricStateFailed,
+	metricStateCompleted,
+}
+
+// Gauges for all clusters scheduled upgrade time and state
 var (
-	infoLabels = []string{"cluster_id", "cluster_namespace", "origin_version", "target_version"}
+	infoLabels   = []string{"installation", "cluster_id", "cluster_namespace", "origin_version", "target_version"}
+	stateLabels  = []string{"installation", "cluster_id", "cluster_namespace", "state"}
+	reasonLabels = []string{"installation", "cluster_id", "cluster_namespace", "reason"}
 
 	UpgradesInfo = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: metricNamespace,
 			Subsystem: metricSubsystem,
 			Name:      "scheduled_upgrades_time",
-			Help:      "Gives upgrade time for all clusters.",
+			Help:      "Gives upgrade time for all clusters with a scheduled upgrade.",
 		},
 		infoLabels,
 	)
+	UpgradeStateInfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricNamespace,
+			Subsystem: metricSubsystem,
+			Name:      "scheduled_upgrade_state",
+			Help:      "Is 1 for the current upgrade state of each cluster and 0 for its other states, there is a series per state and cluster.",
+		},
+		stateLabels,
+	)
+	UpgradeStateReason = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricNamespace,
+			Subsystem: metricSubsystem,
+			Name:      "scheduled_upgrade_state_reason",
+			Help:      "Is 1 for the reason of the blocked or failed upgrade of each cluster, there is a single series per cluster with a blocked or failed upgrade.",
+		},
+		reasonLabels,
+	)
+	ReleaseEndOfLife = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricNamespace,
+			Subsystem: metricSubsystem,
+			Name:      "release_end_of_life",
+			Help:      "Is 1 for clusters running a release that reached its end of life and 0 otherwise.",
+		},
+		[]string{"installation", "cluster_id", "cluster_namespace"},
+	)
+	EmergencyStopActive = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricNamespace,
+			Name:      "emergency_stop_active",
+			Help:      "Is 1 while all upgrades of the installation are halted by the emergency stop and 0 otherwise.",
+		},
+		[]string{"installation"},
+	)
+	ManagementClusterUp = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricNamespace,
+			Name:      "management_cluster_up",
+			Help:      "Is 1 while the clusters of the remote management cluster are reconciled and 0 while it can not be reached or its kubeconfig is invalid.",
+		},
+		[]string{"installation"},
+	)
+	PendingUpgrades = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricNamespace,
+			Subsystem: metricSubsystem,
+			Name:      "scheduled_upgrades_pending",
+			Help:      "Number of clusters with a scheduled upgrade that was not triggered yet.",
+		},
+		[]string{"installation"},
+	)
+)
+
+// Histograms for the timing of scheduled upgrades
+var (
+	histogramLabels = []string{"installation", "provider", "version_bump"}
+
+	UpgradeLateness = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricNamespace,
+			Subsystem: metricSubsystem,
+			Name:      "scheduled_upgrade_lateness_seconds",
+			Help:      "Time between the scheduled upgrade time and the actual trigger of the upgrade.",
+			Buckets:   []float64{1, 5, 15, 30, 60, 120, 300, 600, 1800, 3600},
+		},
+		histogramLabels,
+	)
+	UpgradeDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricNamespace,
+			Subsystem: metricSubsystem,
+			Name:      "scheduled_upgrade_duration_seconds",
+			Help:      "Time between the trigger of an upgrade and the cluster being verified healthy on the target release.",
+			Buckets:   []float64{60, 300, 600, 900, 1200, 1800, 2700, 3600, 5400, 7200},
+		},
+		histogramLabels,
+	)
+	AnnouncementLeadTime = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricNamespace,
+			Subsystem: metricSubsystem,
+			Name:      "scheduled_upgrade_announcement_lead_time_seconds",
+			Help:      "Time between the announcement of an upgrade and the scheduled upgrade time.",
+			// The announcement offset can be reloaded, so the buckets cover
+			// offsets from a minute to several days.
+			Buckets: prometheus.ExponentialBuckets(60, 2, 14),
+		},
+		histogramLabels,
+	)
 )
 
 func init() {
 	// Register custom metrics with the global prometheus registry
-	metrics.Registry.MustRegister(UpgradesTotal, FailuresTotal, SuccessTotal, UpgradesInfo)
+	metrics.Registry.MustRegister(UpgradesTotal, FailuresTotal, SuccessTotal, UpgradesInfo, UpgradeStateInfo, UpgradeStateReason, ReleaseEndOfLife, EmergencyStopActive, ManagementClusterUp, PendingUpgrades)
+	metrics.Registry.MustRegister(UpgradeLateness, UpgradeDuration, AnnouncementLeadTime)
+}
+
+// clusterSeries is the state of the per cluster gauges of a cluster.
+type clusterSeries struct {
+	originVersion string
+	targetVersion string
+	// time is the scheduled upgrade time. The time gauge has no series for
+	// the cluster if it is zero.
+	time   time.Time
+	state  string
+	reason string
+}
+
+// upgradeInfoSeries keeps track of the per cluster series of every cluster,
+// so that there is at most one time and one reason series per cluster, the
+// state series of a cluster only change their value and the series of
+// deleted clusters are removed. Every cluster is indexed
+// with its series, so that updating or deleting a cluster only touches the
+// series of the cluster.
+type upgradeInfoSeries struct {
+	mu            sync.Mutex
+	versionLabels bool
+	series        map[clusterKey]clusterSeries
+	// counters are the version label values of the counter series of every
+	// cluster.
+	counters map[clusterKey]map[counterSeries]struct{}
+	// pending is the number of pending upgrades per installation.
+	pending map[string]int
+}
+
+// counterSeries is a counter series of a cluster.
+type counterSeries struct {
+	counter       *prometheus.CounterVec
+	originVersion string
+	targetVersion string
+}
+
+var upgradeInfo = newUpgradeInfoSeries()
+
+func newUpgradeInfoSeries() *upgradeInfoSeries {
+	return &upgradeInfoSeries{
+		versionLabels: true,
+		series:        map[clusterKey]clusterSeries{},
+		counters:      map[clusterKey]map[counterSeries]struct{}{},
+		pending:       map[string]int{},
+	}
+}
+
+// SetMetricVersionLabels configures whether the per cluster metrics are
+// labeled by origin and target version. Without the version labels the
+// values of these labels are empty.
+func SetMetricVersionLabels(enabled bool) {
+	upgradeInfo.mu.Lock()
+	defer upgradeInfo.mu.Unlock()
+	upgradeInfo.versionLabels = enabled
+}
+
+// versionLabelValues returns the values of the version labels.
+func (s *upgradeInfoSeries) versionLabelValues(originVersion string, targetVersion string) (string, string) {
+	if !s.versionLabels {
+		return "", ""
+	}
+	return originVersion, targetVersion
+}
+
+// set updates the gauges of the cluster and deletes its outdated series.
+func (s *upgradeInfoSeries) set(key clusterKey, series clusterSeries) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	series.originVersion, series.targetVersion = s.versionLabelValues(series.originVersion, series.targetVersion)
+	old, ok := s.series[key]
+	if ok && !old.time.IsZero() && (series.time.IsZero() || old.originVersion != series.originVersion || old.targetVersion != series.targetVersion) {
+		UpgradesInfo.DeleteLabelValues(key.Installation, key.Name, key.Namespace, old.originVersion, old.targetVersion)
+	}
+	if !series.time.IsZero() {
+		UpgradesInfo.WithLabelValues(key.Installation, key.Name, key.Namespace, series.originVersion, series.targetVersion).Set(float64(series.time.Unix()))
+	}
+
+	if !ok {
+		for _, state := range metricStates {
+			UpgradeStateInfo.WithLabelValues(key.Installation, key.Name, key.Namespace, state).Set(0)
+		}
+	}
+	if !ok || old.state != series.state {
+		if ok {
+			UpgradeStateInfo.WithLabelValues(key.Installation, key.Name, key.Namespace, old.state).Set(0)
+		}
+		UpgradeStateInfo.WithLabelValues(key.Installation, key.Name, key.Namespace, series.state).Set(1)
+	}
+	if ok && old.reason != "" && old.reason != series.reason {
+		UpgradeStateReason.DeleteLabelValues(key.Installation, key.Name, key.Namespace, old.reason)
+	}
+	if series.reason != "" {
+		UpgradeStateReason.WithLabelValues(key.Installation, key.Name, key.Namespace, series.reason).Set(1)
+	}
+
+	s.series[key] = series
+	s.updatePending(key.Installation, ok && pendingState(old.state), pendingState(series.state))
+}
+
+// forget resets the gauges of a cluster without scheduled upgrade. A completed
+// upgrade is kept until the next upgrade is scheduled.
+func (s *upgradeInfoSeries) forget(key clusterKey) {
+	s.mu.Lock()
+	old, ok := s.series[key]
+	s.mu.Unlock()
+	if ok && old.state == metricStateCompleted {
+		return
+	}
+	s.set(key, clusterSeries{state: metricStateNone})
+}
+
+// delete removes all per cluster series of the cluster.
+func (s *upgradeInfoSeries) delete(key clusterKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if old, ok := s.series[key]; ok {
+		if !old.time.IsZero() {
+			UpgradesInfo.DeleteLabelValues(key.Installation, key.Name, key.Namespace, old.originVersion, old.targetVersion)
+		}
+		for _, state := range metricStates {
+			UpgradeStateInfo.DeleteLabelValues(key.Installation, key.Name, key.Namespace, state)
+		}
+		if old.reason != "" {
+			UpgradeStateReason.DeleteLabelValues(key.Installation, key.Name, key.Namespace, old.reason)
+		}
+		delete(s.series, key)
+		s.updatePending(key.Installation, pendingState(old.state), false)
+	}
+	for c := range s.counters[key] {
+		c.counter.DeleteLabelValues(key.Installation, key.Name, key.Namespace, c.originVersion, c.targetVersion)
+	}
+	delete(s.counters, key)
+	ReleaseEndOfLife.DeleteLabelValues(key.Installation, key.Name, key.Namespace)
+}
+
+// deleteInstallation removes all per cluster and per installation series of
+// the installation.
+func (s *upgradeInfoSeries) deleteInstallation(installation string) {
+	s.mu.Lock()
+	var keys []clusterKey
+	for key := range s.series {
+		if key.Installation == installation {
+			keys = append(keys, key)
+		}
+	}
+	for key := range s.counters {
+		if key.Installation == installation {
+			keys = append(keys, key)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, key := range keys {
+		s.delete(key)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pending, installation)
+	PendingUpgrades.DeleteLabelValues(installation)
+	EmergencyStopActive.DeleteLabelValues(installation)
+}
+
+// forgetInstallation removes the series of a management cluster that is not
+// reconciled anymore.
+func forgetInstallation(installation string) {
+	upgradeInfo.deleteInstallation(installation)
+}
+
+// inc increments the counter of the cluster.
+func (s *upgradeInfoSeries) inc(counter *prometheus.CounterVec, key clusterKey, originVersion string, targetVersion string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	originVersion, targetVersion = s.versionLabelValues(originVersion, targetVersion)
+	if s.counters[key] == nil {
+		s.counters[key] = map[counterSeries]struct{}{}
+	}
+	s.counters[key][counterSeries{counter: counter, originVersion: originVersion, targetVersion: targetVersion}] = struct{}{}
+	counter.WithLabelValues(key.Installation, key.Name, key.Namespace, originVersion, targetVersion).Inc()
+}
+
+// updatePending updates the number of pending upgrades of the installation
+// when the upgrade of a cluster became pending or stopped being pending.
+func (s *upgradeInfoSeries) updatePending(installation string, wasPending bool, isPending bool) {
+	switch {
+	case isPending && !wasPending:
+		s.pending[installation]++
+	case wasPending && !isPending:
+		s.pending[installation]--
+	}
+	PendingUpgrades.WithLabelValues(installation).Set(float64(s.pending[installation]))
+}
+
+// pendingState returns true for the states of upgrades that were not
+// triggered yet.
+func pendingState(state string) bool {
+	return state == metricStateScheduled || state == metricStatePendingApproval || state == metricStateAnnounced
+}
+
+// clusterKey identifies a cluster across the management clusters of the
+// operator.
+type clusterKey struct {
+	Installation string
+	types.NamespacedName
+}
+
+// clusterKey returns the key of a cluster of the management cluster of the
+// reconciler.
+func (r *ClusterReconciler) clusterKey(cluster types.NamespacedName) clusterKey {
+	return clusterKey{Installation: r.Installation, NamespacedName: cluster}
+}
+
+// setUpgradeMetrics updates the per cluster gauges of an upgrade in the given
+// metric state.
+func (r *ClusterReconciler) setUpgradeMetrics(upgrade ScheduledUpgrade, state string) {
+	series := clusterSeries{
+		originVersion: upgrade.OriginVersion,
+		targetVersion: upgrade.TargetVersion,
+		state:         state,
+	}
+	switch state {
+	case metricStateScheduled, metricStatePendingApproval, metricStateAnnounced, metricStateBlocked, metricStateFailed:
+		series.time = upgrade.Time
+	}
+	if state == metricStateBlocked || state == metricStateFailed {
+		series.reason = upgrade.Reason
+	}
+	upgradeInfo.set(upgrade.key(), series)
+}
+
+// forgetUpgradeMetrics resets the per cluster gauges of a cluster without
+// scheduled upgrade.
+func (r *ClusterReconciler) forgetUpgradeMetrics(cluster types.NamespacedName) {
+	upgradeInfo.forget(r.clusterKey(cluster))
+}
+
+// deleteUpgradeMetrics removes all per cluster series of a deleted cluster.
+func (r *ClusterReconciler) deleteUpgradeMetrics(cluster types.NamespacedName) {
+	upgradeInfo.delete(r.clusterKey(cluster))
+}
+
+// incUpgradeCounter increments the counter of the cluster.
+func (r *ClusterReconciler) incUpgradeCounter(counter *prometheus.CounterVec, cluster types.NamespacedName, originVersion string, targetVersion string) {
+	upgradeInfo.inc(counter, r.clusterKey(cluster), originVersion, targetVersion)
 }
@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestUpgradeInfoSeries(t *testing.T) {
+	s := newUpgradeInfoSeries()
+	dh82p := clusterKey{Installation: "gauss", NamespacedName: types.NamespacedName{Name: "dh82p", Namespace: "org-metrics"}}
+	ga83x := clusterKey{Installation: "gauss", NamespacedName: types.NamespacedName{Name: "ga83x", Namespace: "org-metrics"}}
+	upgradeTime := time.Date(2021, 9, 7, 8, 0, 0, 0, time.UTC)
+	timeSeries := func(key clusterKey, originVersion string, targetVersion string) float64 {
+		return testutil.ToFloat64(UpgradesInfo.WithLabelValues(key.Installation, key.Name, key.Namespace, originVersion, targetVersion))
+	}
+	stateSeries := func(key clusterKey, state string) float64 {
+		return testutil.ToFloat64(UpgradeStateInfo.WithLabelValues(key.Installation, key.Name, key.Namespace, state))
+	}
+	states := len(metricStates)
+
+	s.set(dh82p, clusterSeries{originVersion: "14.2.2", targetVersion: "15.2.1", time: upgradeTime, state: metricStateScheduled})
+	s.set(ga83x, clusterSeries{state: metricStateNone})
+	assert.Equal(t, float64(upgradeTime.Unix()), timeSeries(dh82p, "14.2.2", "15.2.1"))
+	assert.Equal(t, 1, namespaceSeries(t, UpgradesInfo, "org-metrics"), "clusters without a scheduled upgrade have no time series")
+	assert.Equal(t, 2*states, namespaceSeries(t, UpgradeStateInfo, "org-metrics"), "there is a state series per state and cluster")
+	assert.Equal(t, float64(1), stateSeries(dh82p, metricStateScheduled))
+	assert.Equal(t, float64(0), stateSeries(dh82p, metricStateNone))
+	assert.Equal(t, float64(1), stateSeries(ga83x, metricStateNone))
+	assert.Equal(t, 0, namespaceSeries(t, UpgradeStateReason, "org-metrics"))
+	assert.Equal(t, float64(1), testutil.ToFloat64(PendingUpgrades.WithLabelValues("gauss")))
+
+	// A changed target version replaces the time series.
+	s.set(dh82p, clusterSeries{originVersion: "14.2.2", targetVersion: "16.0.0", time: upgradeTime, state: metricStateAnnounced})
+	assert.Equal(t, 1, namespaceSeries(t, UpgradesInfo, "org-metrics"))
+	assert.Equal(t, float64(upgradeTime.Unix()), timeSeries(dh82p, "14.2.2", "16.0.0"))
+	assert.Equal(t, 2*states, namespaceSeries(t, UpgradeStateInfo, "org-metrics"))
+	assert.Equal(t, float64(1), stateSeries(dh82p, metricStateAnnounced))
+	assert.Equal(t, float64(0), stateSeries(dh82p, metricStateScheduled))
+	assert.Equal(t, float64(1), testutil.ToFloat64(PendingUpgrades.WithLabelValues("gauss")))
+
+	// Blocked upgrades carry the reason and are not counted as pending.
+	s.set(dh82p, clusterSeries{originVersion: "14.2.2", targetVersion: "16.0.0", time: upgradeTime, state: metricStateBlocked, reason: ReasonReleaseVersionInvalid})
+	assert.Equal(t, 2*states, namespaceSeries(t, UpgradeStateInfo, "org-metrics"))
+	assert.Equal(t, float64(1), stateSeries(dh82p, metricStateBlocked))
+	assert.Equal(t, 1, namespaceSeries(t, UpgradeStateReason, "org-metrics"))
+	assert.Equal(t, float64(1), testutil.ToFloat64(UpgradeStateReason.WithLabelValues("gauss", "dh82p", "org-metrics", ReasonReleaseVersionInvalid)))
+	assert.Equal(t, float64(0), testutil.ToFloat64(PendingUpgrades.WithLabelValues("gauss")))
+
+	// Completed upgrades are kept when the schedule is removed.
+	s.set(dh82p, clusterSeries{originVersion: "14.2.2", targetVersion: "16.0.0", state: metricStateCompleted})
+	s.forget(dh82p)
+	assert.Equal(t, 0, namespaceSeries(t, UpgradesInfo, "org-metrics"))
+	assert.Equal(t, float64(1), stateSeries(dh82p, metricStateCompleted))
+	assert.Equal(t, 0, namespaceSeries(t, UpgradeStateReason, "org-metrics"), "the reason is removed with the blocked state")
+
+	// A cluster of the same name on another management cluster has its own
+	// series.
+	other := clusterKey{Installation: "other", NamespacedName: dh82p.NamespacedName}
+	s.set(other, clusterSeries{originVersion: "14.2.2", targetVersion: "15.2.1", time: upgradeTime, state: metricStateScheduled})
+	assert.Equal(t, float64(1), stateSeries(other, metricStateScheduled))
+	assert.Equal(t, float64(1), stateSeries(dh82p, metricStateCompleted))
+	assert.Equal(t, float64(1), testutil.ToFloat64(PendingUpgrades.WithLabelValues("other")))
+	assert.Equal(t, float64(0), testutil.ToFloat64(PendingUpgrades.WithLabelValues("gauss")))
+	s.delete(other)
+	assert.Equal(t, float64(1), stateSeries(dh82p, metricStateCompleted))
+	assert.Equal(t, float64(0), testutil.ToFloat64(PendingUpgrades.WithLabelValues("other")))
+
+	// Deleting a cluster removes all of its series including the counters.
+	s.inc(FailuresTotal, dh82p, "14.2.2", "16.0.0")
+	s.inc(FailuresTotal, dh82p, "14.2.2", "16.0.0")
+	s.inc(UpgradesTotal, dh82p, "14.2.2", "16.0.1")
+	assert.Equal(t, float64(2), testutil.ToFloat64(FailuresTotal.WithLabelValues("gauss", "dh82p", "org-metrics", "14.2.2", "16.0.0")))
+	ReleaseEndOfLife.WithLabelValues("gauss", "dh82p", "org-metrics").Set(1)
+	s.delete(dh82p)
+	assert.Equal(t, states, namespaceSeries(t, UpgradeStateInfo, "org-metrics"))
+	assert.Equal(t, 0, namespaceSeries(t, FailuresTotal, "org-metrics"))
+	assert.Equal(t, 0, namespaceSeries(t, UpgradesTotal, "org-metrics"))
+	assert.Equal(t, 0, namespaceSeries(t, ReleaseEndOfLife, "org-metrics"))
+
+	// Without version labels there is a single time series per cluster.
+	s.versionLabels = false
+	s.set(dh82p, clusterSeries{originVersion: "14.2.2", targetVersion: "15.2.1", time: upgradeTime, state: metricStateScheduled})
+	assert.Equal(t, float64(upgradeTime.Unix()), timeSeries(dh82p, "", ""))
+
+	s.delete(dh82p)
+	s.delete(ga83x)
+	assert.Equal(t, 0, namespaceSeries(t, UpgradesInfo, "org-metrics"))
+	assert.Equal(t, 0, namespaceSeries(t, UpgradeStateInfo, "org-metrics"))
+	assert.Equal(t, float64(0), testutil.ToFloat64(PendingUpgrades.WithLabelValues("gauss")))
+}
+
+// namespaceSeries returns the number of series of the collector in the given
+// cluster namespace.
+func namespaceSeries(t *testing.T, collector prometheus.Collector, namespace string) int {
+	t.Helper()
+
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(collector)
+	families, err := registry.Gather()
+	assert.NoError(t, err)
+
+	count := 0
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "cluster_namespace" && label.GetValue() == namespace {
+					count++
+				}
+			}
+		}
+	}
+	return count
+}
@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/blang/semver"
+	"github.com/go-logr/logr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// reconcilePolicy returns the effective upgrade policy of the namespace of the
+// cluster and refuses scheduled upgrades violating it. Once an upgrade was
+// announced it is not validated again. The result is nil if the upgrade may
+// proceed.
+func (r *ClusterReconciler) reconcilePolicy(ctx context.Context, cluster *clusterv1.Cluster, upgrade ScheduledUpgrade, log logr.Logger) (EffectivePolicy, *ctrl.Result, error) {
+	ctx, span := tracer.Start(ctx, "GetUpgradePolicy")
+	policy, err := GetEffectivePolicy(ctx, r.Client, cluster.Namespace)
+	endSpan(span, err)
+	if err != nil {
+		log.Error(err, "Failed to get the upgrade policy.")
+		r.Recorder.Warnf(cluster, ReasonUpgradePolicyFailed, "The upgrade policy of namespace %s can not be read: %v", cluster.Namespace, err)
+		r.trackFailedUpgrade(upgrade, ReasonUpgradePolicyFailed, err)
+		return policy, &ctrl.Result{}, err
+	}
+	if upgrade.Announced {
+		return policy, nil, nil
+	}
+
+	err = policy.Validate(upgrade.Time, scheduledAt(cluster), scheduleBump(cluster))
+	if err != nil {
+		log.Info(fmt.Sprintf("The scheduled upgrade violates the upgrade policy: %v", err))
+		r.Recorder.Warnf(cluster, ReasonUpgradePolicyViolated, "The upgrade to release version %v scheduled at %v is refused because it violates the upgrade policy: %v",
+			upgrade.TargetVersion,
+			upgrade.Time.Format(time.RFC822),
+			err,
+		)
+		r.trackFailedUpgrade(upgrade, ReasonUpgradePolicyViolated, err)
+		// The upgrade is validated again when the schedule or the policy
+		// changes.
+		return policy, &ctrl.Result{}, nil
+	}
+	return policy, nil, nil
+}
+
+// reconcileConcurrency holds back the upgrade while the maximum number of
+// concurrent upgrades of the upgrade policy is reached. It returns nil if the
+// upgrade may be triggered.
+func (r *ClusterReconciler) reconcileConcurrency(ctx context.Context, cluster *clusterv1.Cluster, upgrade ScheduledUpgrade, policy EffectivePolicy, log logr.Logger) (*ctrl.Result, error) {
+	limit := policy.MaxConcurrentUpgrades()
+	if limit == 0 {
+		return nil, nil
+	}
+
+	clusters := &clusterv1.ClusterList{}
+	if err := r.List(ctx, clusters, client.InNamespace(cluster.Namespace)); err != nil {
+		log.Error(err, "Failed to list the clusters of the namespace.")
+		r.trackFailedUpgrade(upgrade, ReasonUpgradePolicyFailed, err)
+		return &ctrl.Result{}, err
+	}
+	inProgress := 0
+	for _, c := range clusters.Items {
+		if _, ok := c.Annotations[ClusterUpgradeInProgress]; ok && c.Name != cluster.Name {
+			inProgress++
+		}
+	}
+	if inProgress < limit {
+		return nil, nil
+	}
+
+	log.Info(fmt.Sprintf("The upgrade is held back because %d of %d concurrent upgrades are in progress.", inProgress, limit))
+	r.Recorder.Eventf(cluster, ReasonUpgradeDelayed, "The upgrade to release version %v is held back because %d of %d concurrent upgrades allowed by the upgrade policy are in progress.", upgrade.TargetVersion, inProgress, limit)
+	upgrade.Reason = ReasonUpgradeDelayed
+	upgrade.Message = fmt.Sprintf("%d of %d concurrent upgrades are in progress", inProgress, limit)
+	r.setUpgradeMetrics(upgrade, metricStateBlocked)
+	if r.Upgrades != nil {
+		r.Upgrades.Set(upgrade)
+	}
+	return &ctrl.Result{RequeueAfter: CurrentSettings().RequeueInterval}, nil
+}
+
+// scheduleBump returns the version bump of the scheduled upgrade of the
+// cluster or an empty string if a version can not be parsed.
+func scheduleBump(cluster *clusterv1.Cluster) string {
+	currentVersion, err := semver.New(getClusterReleaseVersionLabel(cluster))
+	if err != nil {
+		return ""
+	}
+	targetVersion, err := ParseTargetVersion(getClusterUpgradeVersionAnnotation(cluster))
+	if err != nil {
+		return ""
+	}
+	bump := VersionBump(*currentVersion, *targetVersion)
+	if bump == "none" {
+		return ""
+	}
+	return bump
+}
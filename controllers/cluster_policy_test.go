@@ -0,0 +1,168 @@
+package controllers
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clocktesting "k8s.io/utils/clock/testing"
+	"k8s.io/utils/ptr"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/giantswarm/upgrade-schedule-operator/api/v1alpha1"
+)
+
+func TestClusterControllerPolicy(t *testing.T) {
+	// Wednesday.
+	upgradeTime := time.Date(2025, 3, 12, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name       string
+		policy     v1alpha1.UpgradePolicySpec
+		announced  bool
+		inProgress int
+		now        time.Time
+
+		expectedState     UpgradeState
+		expectedReason    string
+		expectedRequeue   time.Duration
+		expectedTriggered bool
+		expectedEvent     string
+	}{
+		{
+			name:            "case 0: schedule within the policy",
+			policy:          v1alpha1.UpgradePolicySpec{AllowedDays: []v1alpha1.Weekday{"Wednesday"}, AllowedBumps: []v1alpha1.VersionBump{"major"}},
+			now:             upgradeTime.Add(-time.Hour),
+			expectedState:   UpgradeStatePending,
+			expectedRequeue: 45*time.Minute + time.Second,
+		},
+		{
+			name:           "case 1: schedule on a not allowed day",
+			policy:         v1alpha1.UpgradePolicySpec{AllowedDays: []v1alpha1.Weekday{"Monday"}},
+			now:            upgradeTime.Add(-time.Hour),
+			expectedState:  UpgradeStateFailed,
+			expectedReason: ReasonUpgradePolicyViolated,
+			expectedEvent:  ReasonUpgradePolicyViolated,
+		},
+		{
+			name:           "case 2: not allowed version bump",
+			policy:         v1alpha1.UpgradePolicySpec{AllowedBumps: []v1alpha1.VersionBump{"minor", "patch"}},
+			now:            upgradeTime.Add(-time.Hour),
+			expectedState:  UpgradeStateFailed,
+			expectedReason: ReasonUpgradePolicyViolated,
+			expectedEvent:  ReasonUpgradePolicyViolated,
+		},
+		{
+			name:              "case 3: announced upgrades are not validated again",
+			policy:            v1alpha1.UpgradePolicySpec{AllowedDays: []v1alpha1.Weekday{"Monday"}},
+			announced:         true,
+			now:               upgradeTime.Add(time.Second),
+			expectedState:     UpgradeStateInProgress,
+			expectedRequeue:   2*time.Hour + time.Second,
+			expectedTriggered: true,
+		},
+		{
+			name:              "case 4: below the concurrency limit",
+			policy:            v1alpha1.UpgradePolicySpec{MaxConcurrentUpgrades: ptr.To[int32](2)},
+			announced:         true,
+			inProgress:        1,
+			now:               upgradeTime.Add(time.Second),
+			expectedState:     UpgradeStateInProgress,
+			expectedRequeue:   2*time.Hour + time.Second,
+			expectedTriggered: true,
+		},
+		{
+			name:            "case 5: concurrency limit reached",
+			policy:          v1alpha1.UpgradePolicySpec{MaxConcurrentUpgrades: ptr.To[int32](2)},
+			announced:       true,
+			inProgress:      2,
+			now:             upgradeTime.Add(time.Second),
+			expectedState:   UpgradeStatePending,
+			expectedReason:  ReasonUpgradeDelayed,
+			expectedRequeue: time.Minute,
+			expectedEvent:   ReasonUpgradeDelayed,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+			drainEvents()
+
+			cluster := &capi.Cluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "policy",
+					Namespace: "org-acme",
+					Labels: map[string]string{
+						"release.giantswarm.io/version": "14.2.2",
+					},
+					Annotations: map[string]string{
+						"alpha.giantswarm.io/update-schedule-target-release": "15.2.1",
+						"alpha.giantswarm.io/update-schedule-target-time":    "12 Mar 25 12:00 UTC",
+						ClusterUpgradeScheduledAt:                            "2025-03-11T12:00:00Z",
+					},
+				},
+			}
+			if tc.announced {
+				cluster.Annotations[ClusterUpgradeAnnouncement] = upgradeTime.Add(-15 * time.Minute).Format(time.RFC3339)
+			}
+			objects := []client.Object{
+				cluster,
+				&v1alpha1.UpgradePolicy{
+					ObjectMeta: metav1.ObjectMeta{Name: "acme", Namespace: "org-acme"},
+					Spec:       tc.policy,
+				},
+			}
+			for i := 0; i < tc.inProgress; i++ {
+				objects = append(objects, &capi.Cluster{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "upgrading-" + strconv.Itoa(i),
+						Namespace: "org-acme",
+						Annotations: map[string]string{
+							ClusterUpgradeInProgress: `{"origin":"14.2.2","target":"15.2.1","scheduledAt":"2025-03-12T11:00:00Z","triggeredAt":"2025-03-12T11:00:00Z"}`,
+						},
+					},
+				})
+			}
+
+			fakeClock := clocktesting.NewFakeClock(tc.now)
+			fakeClient := fake.NewClientBuilder().WithScheme(fakeScheme).WithObjects(objects...).Build()
+			r := &ClusterReconciler{
+				Client:   fakeClient,
+				Scheme:   fakeScheme,
+				Log:      ctrl.Log.WithName("fake"),
+				Upgrades: NewUpgradeStore(fakeClock),
+				Clock:    fakeClock,
+			}
+			ctx := context.TODO()
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: cluster.GetName(), Namespace: cluster.GetNamespace()}}
+
+			result, err := r.Reconcile(ctx, req)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedRequeue, result.RequeueAfter)
+
+			upgrade, _ := r.Upgrades.Get(r.Installation, req.NamespacedName)
+			assert.Equal(t, tc.expectedState, upgrade.State)
+			assert.Equal(t, tc.expectedReason, upgrade.Reason)
+
+			obj := &capi.Cluster{}
+			assert.NoError(t, fakeClient.Get(ctx, req.NamespacedName, obj))
+			_, triggered := obj.Annotations[ClusterUpgradeInProgress]
+			assert.Equal(t, tc.expectedTriggered, triggered)
+
+			event := ""
+			for _, e := range drainEvents() {
+				event = strings.Fields(e)[1]
+			}
+			assert.Equal(t, tc.expectedEvent, event)
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// CacheOptions restricts the cache of the manager, and with it the clusters
+// the operator reconciles, to the namespaces and to the clusters matching the
+// selector. All namespaces and clusters are cached if they are empty. The
+// emergency stop ConfigMap is cached even if its namespace is not watched.
+func CacheOptions(namespaces []string, selector labels.Selector, emergencyStop types.NamespacedName) cache.Options {
+	opts := cache.Options{ByObject: map[client.Object]cache.ByObject{}}
+	if selector != nil && !selector.Empty() {
+		opts.ByObject[&clusterv1.Cluster{}] = cache.ByObject{Label: selector}
+	}
+	if len(namespaces) == 0 {
+		return opts
+	}
+
+	opts.DefaultNamespaces = map[string]cache.Config{}
+	for _, namespace := range namespaces {
+		opts.DefaultNamespaces[namespace] = cache.Config{}
+	}
+	if _, ok := opts.DefaultNamespaces[emergencyStop.Namespace]; emergencyStop.Name != "" && !ok {
+		configMapNamespaces := map[string]cache.Config{
+			emergencyStop.Namespace: {FieldSelector: fields.OneTermEqualSelector("metadata.name", emergencyStop.Name)},
+		}
+		for _, namespace := range namespaces {
+			configMapNamespaces[namespace] = cache.Config{}
+		}
+		opts.ByObject[&corev1.ConfigMap{}] = cache.ByObject{Namespaces: configMapNamespaces}
+	}
+	return opts
+}
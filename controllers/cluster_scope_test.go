@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+)
+
+func TestCacheOptions(t *testing.T) {
+	capiSelector := labels.SelectorFromSet(labels.Set{"cluster.x-k8s.io/watch-filter": "capi"})
+	stop := types.NamespacedName{Namespace: "giantswarm", Name: "upgrade-schedule-operator-emergency-stop"}
+
+	testCases := []struct {
+		name                string
+		namespaces          []string
+		selector            labels.Selector
+		emergencyStop       types.NamespacedName
+		expectedNamespaces  map[string]cache.Config
+		expectedSelector    labels.Selector
+		expectedConfigMapNs map[string]cache.Config
+	}{
+		{
+			name:          "case 0: not scoped",
+			emergencyStop: stop,
+		},
+		{
+			name:             "case 1: cluster selector",
+			selector:         capiSelector,
+			emergencyStop:    stop,
+			expectedSelector: capiSelector,
+		},
+		{
+			name:          "case 2: empty selector",
+			selector:      labels.Everything(),
+			emergencyStop: stop,
+		},
+		{
+			name:               "case 3: namespaces without emergency stop",
+			namespaces:         []string{"org-acme", "org-other"},
+			expectedNamespaces: map[string]cache.Config{"org-acme": {}, "org-other": {}},
+		},
+		{
+			name:               "case 4: namespaces and emergency stop",
+			namespaces:         []string{"org-acme"},
+			selector:           capiSelector,
+			emergencyStop:      stop,
+			expectedNamespaces: map[string]cache.Config{"org-acme": {}},
+			expectedSelector:   capiSelector,
+			expectedConfigMapNs: map[string]cache.Config{
+				"org-acme":   {},
+				"giantswarm": {FieldSelector: fields.OneTermEqualSelector("metadata.name", stop.Name)},
+			},
+		},
+		{
+			name:               "case 5: emergency stop in a watched namespace",
+			namespaces:         []string{"org-acme", "giantswarm"},
+			emergencyStop:      stop,
+			expectedNamespaces: map[string]cache.Config{"org-acme": {}, "giantswarm": {}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := CacheOptions(tc.namespaces, tc.selector, tc.emergencyStop)
+			assert.Equal(t, tc.expectedNamespaces, opts.DefaultNamespaces)
+
+			var selector labels.Selector
+			var configMapNamespaces map[string]cache.Config
+			for obj, byObject := range opts.ByObject {
+				switch obj.(type) {
+				case *clusterv1.Cluster:
+					selector = byObject.Label
+				case *corev1.ConfigMap:
+					configMapNamespaces = byObject.Namespaces
+				default:
+					t.Errorf("unexpected cache options of %T", obj)
+				}
+			}
+			assert.Equal(t, tc.expectedSelector, selector)
+			assert.Equal(t, tc.expectedConfigMapNs, configMapNamespaces)
+		})
+	}
+}
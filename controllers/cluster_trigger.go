@@ -0,0 +1,171 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/giantswarm/k8smetadata/pkg/annotation"
+	"github.com/giantswarm/k8smetadata/pkg/label"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ResumeUpgrade applies an upgrade whose intent was recorded but which was
+// not applied completely, e.g. because the operator restarted or a write
+// failed.
+func (r *ClusterReconciler) ResumeUpgrade(ctx context.Context, cluster *clusterv1.Cluster, progress *upgradeProgress, log logr.Logger) (ctrl.Result, error) {
+	ctx, span := tracer.Start(ctx, "ResumeUpgrade")
+	defer span.End()
+
+	upgrade := ScheduledUpgrade{
+		Installation:  r.Installation,
+		Cluster:       cluster.Name,
+		Namespace:     cluster.Namespace,
+		Organization:  cluster.Labels[label.Organization],
+		OriginVersion: progress.OriginVersion,
+		TargetVersion: progress.TargetVersion,
+		Time:          progress.ScheduledAt,
+		Announced:     true,
+		State:         UpgradeStateInProgress,
+	}
+	log.Info(fmt.Sprintf("Resuming the upgrade from release version %v to %v triggered at %v.", progress.OriginVersion, progress.TargetVersion, progress.TriggeredAt))
+	r.trackUpgrade(upgrade)
+	return r.applyUpgrade(ctx, cluster, *progress, upgrade, log)
+}
+
+// applyUpgrade applies the upgrade recorded in progress. Every step can be
+// repeated: the release version in the userconfig ConfigMap of CAPI clusters
+// is only replaced while it is the origin version, and the release version
+// label, the removal of the schedule annotations and the applied step are
+// written to the Cluster in a single patch. The patch is retried on conflicts
+// while the recorded intent is unchanged.
+func (r *ClusterReconciler) applyUpgrade(ctx context.Context, cluster *clusterv1.Cluster, progress upgradeProgress, upgrade ScheduledUpgrade, log logr.Logger) (ctrl.Result, error) {
+	key := client.ObjectKeyFromObject(cluster)
+	if isCAPIProvider(cluster) {
+		if err := r.applyUserConfigVersion(ctx, cluster, progress, upgrade, log); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	history := UpgradeRecord{
+		OriginVersion: progress.OriginVersion,
+		TargetVersion: progress.TargetVersion,
+		ScheduledBy:   progress.ScheduledBy,
+		UpgradeTime:   progress.ScheduledAt,
+		AnnouncedAt:   announcedAt(cluster),
+		TriggeredAt:   progress.TriggeredAt,
+		Outcome:       UpgradeStateInProgress,
+	}
+
+	progress.Step = upgradeStepApplied
+	decided := cluster.DeepCopy()
+	patched, err := r.patchClusterLocked(ctx, cluster, decided, func(cluster *clusterv1.Cluster) error {
+		if !isCAPIProvider(cluster) {
+			cluster.Labels[label.ReleaseVersion] = progress.TargetVersion
+		}
+
+		delete(cluster.Annotations, annotation.UpdateScheduleTargetTime)
+		delete(cluster.Annotations, annotation.UpdateScheduleTargetRelease)
+		delete(cluster.Annotations, ClusterUpgradeScheduledAt)
+		delete(cluster.Annotations, ClusterUpgradeAnnouncement)
+		delete(cluster.Annotations, ClusterUpgradeRequestedBy)
+		delete(cluster.Annotations, ClusterUpgradeApprovedBy)
+		delete(cluster.Annotations, ClusterUpgradeEndOfLife)
+
+		// Record the applied upgrade so it can be verified.
+		return setUpgradeProgress(cluster, progress)
+	})
+	if err != nil {
+		log.Error(err, "Failed to update release version tag and remove scheduled upgrade annotations.")
+		reason := r.warnUpdateFailed(cluster, err, "Failed to update release version tag and remove scheduled upgrade annotations")
+		r.incUpgradeCounter(FailuresTotal, key, progress.OriginVersion, progress.TargetVersion)
+		r.trackFailedUpgrade(upgrade, reason, err)
+		return ctrl.Result{}, err
+	}
+	if !patched {
+		log.Info("The cluster changed while the upgrade was applied. The change will be reconciled.")
+		return ctrl.Result{}, nil
+	}
+	log.Info(fmt.Sprintf("The cluster CR was modified, changed release version %v to %v.", progress.OriginVersion, progress.TargetVersion))
+	r.incUpgradeCounter(SuccessTotal, key, progress.OriginVersion, progress.TargetVersion)
+	provider, bump := histogramLabelValues(cluster, progress.OriginVersion, progress.TargetVersion)
+	UpgradeLateness.WithLabelValues(r.Installation, provider, bump).Observe(progress.TriggeredAt.Sub(progress.ScheduledAt).Seconds())
+	r.trackUpgrade(upgrade)
+	r.recordHistory(ctx, cluster, history, log)
+
+	return r.verificationTimeoutRequeue(cluster, progress), nil
+}
+
+// applyUserConfigVersion replaces the origin with the target release version
+// in the userconfig ConfigMap of the CAPI cluster. The ConfigMap is left
+// alone if it does not contain the origin version anymore.
+func (r *ClusterReconciler) applyUserConfigVersion(ctx context.Context, cluster *clusterv1.Cluster, progress upgradeProgress, upgrade ScheduledUpgrade, log logr.Logger) error {
+	cm := &corev1.ConfigMap{}
+	changed := false
+	var readErr error
+	// Retry the read-modify-write of the values on conflicts.
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		// Retrieve the existing ConfigMap
+		readErr = r.tracedGet(ctx, "GetUserConfig", types.NamespacedName{Name: fmt.Sprintf("%s-userconfig", cluster.GetName()), Namespace: cluster.GetNamespace()}, cm)
+		if readErr != nil {
+			return readErr
+		}
+
+		// Replace the origin with the target version in the values field
+		base := cm.DeepCopy()
+		values, ok := replaceReleaseVersion(cm.Data["values"], progress.OriginVersion, progress.TargetVersion)
+		changed = ok
+		if !changed {
+			return nil
+		}
+		cm.Data["values"] = values
+
+		return r.tracedPatch(ctx, "PatchUserConfig", cm, client.MergeFromWithOptions(base, client.MergeFromWithOptimisticLock{}))
+	})
+	if readErr != nil {
+		log.Error(err, "Failed to get userconfig configmap from cluster.")
+		reason := ReasonUserConfigFailed
+		if apierrors.IsNotFound(err) {
+			reason = ReasonUserConfigNotFound
+			r.Recorder.Warnf(cluster, reason, "The upgrade to release version %v can not be applied because the ConfigMap %s-userconfig does not exist.", progress.TargetVersion, cluster.GetName())
+		} else {
+			r.Recorder.Warnf(cluster, reason, "The upgrade to release version %v can not be applied because the ConfigMap %s-userconfig can not be read: %v", progress.TargetVersion, cluster.GetName(), err)
+		}
+		r.incUpgradeCounter(FailuresTotal, client.ObjectKeyFromObject(cluster), progress.OriginVersion, progress.TargetVersion)
+		r.trackFailedUpgrade(upgrade, reason, err)
+		return err
+	}
+	if err != nil {
+		log.Error(err, "Failed to update release version tag and remove scheduled upgrade annotations.")
+		reason := r.warnUpdateFailed(cluster, err, fmt.Sprintf("Failed to update the release version in ConfigMap %s", cm.GetName()))
+		r.incUpgradeCounter(FailuresTotal, client.ObjectKeyFromObject(cluster), progress.OriginVersion, progress.TargetVersion)
+		r.trackFailedUpgrade(upgrade, reason, err)
+		return err
+	}
+
+	if changed {
+		log.Info(fmt.Sprintf("The configmap was modified, changed release version %v to %v.", progress.OriginVersion, progress.TargetVersion))
+	} else {
+		log.Info(fmt.Sprintf("The configmap does not contain release version %v, it was not modified.", progress.OriginVersion))
+	}
+	return nil
+}
+
+// replaceReleaseVersion replaces the origin with the target version in the
+// version lines of the values. It returns false if there is no version line
+// with the origin version, e.g. because it was replaced already. Only whole
+// versions are replaced, so that 25.0.1 does not match 25.0.10.
+func replaceReleaseVersion(values string, origin string, target string) (string, bool) {
+	versionLine := regexp.MustCompile(`(?m)^([ \t]*version:[ \t]*)` + regexp.QuoteMeta(origin) + `([ \t]*)$`)
+	if !versionLine.MatchString(values) {
+		return values, false
+	}
+	return versionLine.ReplaceAllString(values, "${1}"+target+"${2}"), true
+}
@@ -0,0 +1,353 @@
+package controllers
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clocktesting "k8s.io/utils/clock/testing"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestReplaceReleaseVersion(t *testing.T) {
+	testCases := []struct {
+		name            string
+		values          string
+		expectedValues  string
+		expectedChanged bool
+	}{
+		{
+			name:            "case 0: origin version replaced",
+			values:          "global:\n  release:\n    version: 25.0.1\n",
+			expectedValues:  "global:\n  release:\n    version: 25.0.10\n",
+			expectedChanged: true,
+		},
+		{
+			name:           "case 1: target version already applied",
+			values:         "global:\n  release:\n    version: 25.0.10\n",
+			expectedValues: "global:\n  release:\n    version: 25.0.10\n",
+		},
+		{
+			name:           "case 2: other version",
+			values:         "global:\n  release:\n    version: 24.1.0\n",
+			expectedValues: "global:\n  release:\n    version: 24.1.0\n",
+		},
+		{
+			name:            "case 3: trailing whitespace",
+			values:          "release:\n\tversion: 25.0.1 \nother: true",
+			expectedValues:  "release:\n\tversion: 25.0.10 \nother: true",
+			expectedChanged: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			values, changed := replaceReleaseVersion(tc.values, "25.0.1", "25.0.10")
+			assert.Equal(t, tc.expectedValues, values)
+			assert.Equal(t, tc.expectedChanged, changed)
+		})
+	}
+}
+
+// TestClusterControllerResumeUpgrade checks that an upgrade which failed after
+// the userconfig ConfigMap was written is resumed without writing the
+// ConfigMap again.
+func TestClusterControllerResumeUpgrade(t *testing.T) {
+	upgradeTime := time.Date(2025, 3, 12, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name          string
+		capi          bool
+		failedPatches int
+
+		expectedErr     bool
+		expectedStep    string
+		expectedValues  string
+		expectedRelease string
+		expectedPatches int
+	}{
+		{
+			name:            "case 0: capi upgrade applied",
+			capi:            true,
+			expectedStep:    upgradeStepApplied,
+			expectedValues:  "release:\n  version: 25.0.10\n",
+			expectedRelease: "25.0.1",
+			expectedPatches: 1,
+		},
+		{
+			name:            "case 1: capi upgrade resumed after a failed cluster patch",
+			capi:            true,
+			failedPatches:   1,
+			expectedErr:     true,
+			expectedStep:    upgradeStepApplied,
+			expectedValues:  "release:\n  version: 25.0.10\n",
+			expectedRelease: "25.0.1",
+			expectedPatches: 1,
+		},
+		{
+			name:            "case 2: vintage upgrade resumed after a failed cluster patch",
+			failedPatches:   1,
+			expectedErr:     true,
+			expectedStep:    upgradeStepApplied,
+			expectedRelease: "25.0.10",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+			drainEvents()
+
+			cluster := &capi.Cluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "resume",
+					Namespace: "org-acme",
+					Labels: map[string]string{
+						"release.giantswarm.io/version": "25.0.1",
+					},
+					Annotations: map[string]string{
+						"alpha.giantswarm.io/update-schedule-target-release": "25.0.10",
+						"alpha.giantswarm.io/update-schedule-target-time":    "12 Mar 25 12:00 UTC",
+						ClusterUpgradeScheduledAt:                            "2025-03-11T12:00:00Z",
+						ClusterUpgradeAnnouncement:                           upgradeTime.Add(-15 * time.Minute).Format(time.RFC3339),
+						ClusterUpgradeRequestedBy:                            "jane@acme.com",
+					},
+				},
+			}
+			objects := []client.Object{cluster}
+			if tc.capi {
+				cluster.Labels["cluster.x-k8s.io/watch-filter"] = "capi"
+				objects = append(objects, &corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: "resume-userconfig", Namespace: "org-acme"},
+					Data:       map[string]string{"values": "release:\n  version: 25.0.1\n"},
+				})
+			}
+
+			// Fail the patch applying the upgrade to the cluster, the patch
+			// recording the intent is the first one. The requester is removed
+			// with the intent as the audit webhook does.
+			clusterPatches, userConfigPatches := 0, 0
+			fakeClient := fake.NewClientBuilder().WithScheme(fakeScheme).WithObjects(objects...).WithInterceptorFuncs(interceptor.Funcs{
+				Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+					switch obj.(type) {
+					case *capi.Cluster:
+						clusterPatches++
+						if clusterPatches == 1 {
+							delete(obj.GetAnnotations(), ClusterUpgradeRequestedBy)
+						}
+						if clusterPatches%2 == 0 && clusterPatches/2 <= tc.failedPatches {
+							return apierrors.NewServiceUnavailable("unavailable")
+						}
+					case *corev1.ConfigMap:
+						if obj.GetName() == "resume-userconfig" {
+							userConfigPatches++
+						}
+					}
+					return c.Patch(ctx, obj, patch, opts...)
+				},
+			}).Build()
+			fakeClock := clocktesting.NewFakeClock(upgradeTime.Add(time.Minute))
+			r := &ClusterReconciler{
+				Client:   fakeClient,
+				Scheme:   fakeScheme,
+				Log:      ctrl.Log.WithName("fake"),
+				Upgrades: NewUpgradeStore(fakeClock),
+				Clock:    fakeClock,
+			}
+			ctx := context.TODO()
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: cluster.GetName(), Namespace: cluster.GetNamespace()}}
+
+			_, err := r.Reconcile(ctx, req)
+			if tc.expectedErr {
+				assert.Error(t, err)
+
+				obj := &capi.Cluster{}
+				assert.NoError(t, fakeClient.Get(ctx, req.NamespacedName, obj))
+				intent, parseErr := getUpgradeProgress(obj)
+				assert.NoError(t, parseErr)
+				if assert.NotNil(t, intent) {
+					assert.Equal(t, upgradeStepIntent, intent.Step)
+				}
+				assert.Contains(t, obj.Annotations, "alpha.giantswarm.io/update-schedule-target-release")
+
+				// Resume the upgrade after the failed patch.
+				fakeClock.Step(time.Minute)
+				_, err = r.Reconcile(ctx, req)
+			}
+			assert.NoError(t, err)
+
+			obj := &capi.Cluster{}
+			assert.NoError(t, fakeClient.Get(ctx, req.NamespacedName, obj))
+			progress, err := getUpgradeProgress(obj)
+			assert.NoError(t, err)
+			if assert.NotNil(t, progress) {
+				assert.Equal(t, tc.expectedStep, progress.Step)
+				assert.Equal(t, "25.0.1", progress.OriginVersion)
+				assert.Equal(t, "25.0.10", progress.TargetVersion)
+				assert.Equal(t, upgradeTime.Add(time.Minute), progress.TriggeredAt)
+			}
+			assert.NotContains(t, obj.Annotations, "alpha.giantswarm.io/update-schedule-target-release")
+			assert.NotContains(t, obj.Annotations, "alpha.giantswarm.io/update-schedule-target-time")
+			assert.Equal(t, tc.expectedRelease, obj.Labels["release.giantswarm.io/version"])
+			assert.Equal(t, tc.expectedPatches, userConfigPatches)
+
+			if tc.capi {
+				cm := &corev1.ConfigMap{}
+				assert.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "resume-userconfig", Namespace: "org-acme"}, cm))
+				assert.Equal(t, tc.expectedValues, cm.Data["values"])
+			}
+
+			history := &corev1.ConfigMap{}
+			assert.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: UpgradeHistoryName("resume"), Namespace: "org-acme"}, history))
+			records, err := ParseUpgradeHistory(history)
+			assert.NoError(t, err)
+			if assert.Len(t, records, 1) {
+				assert.Equal(t, "jane@acme.com", records[0].ScheduledBy)
+			}
+
+			upgrade, _ := r.Upgrades.Get(r.Installation, req.NamespacedName)
+			assert.Equal(t, UpgradeStateInProgress, upgrade.State)
+			drainEvents()
+		})
+	}
+}
+
+// TestClusterControllerUpdateConflict checks that the patches recording the
+// intent and applying the upgrade are retried on conflicts as long as the
+// schedule is unchanged.
+func TestClusterControllerUpdateConflict(t *testing.T) {
+	upgradeTime := time.Date(2025, 3, 12, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name string
+		// conflictingPatch is the cluster patch running into a concurrent
+		// change, the patch recording the intent is the first one.
+		conflictingPatch int
+		change           func(cluster *capi.Cluster)
+
+		expectedRelease string
+		expectedStep    string
+		expectedPatches int
+	}{
+		{
+			name:             "case 0: intent retried after an unrelated change",
+			conflictingPatch: 1,
+			change: func(cluster *capi.Cluster) {
+				cluster.Annotations["giantswarm.io/other"] = "changed"
+			},
+			expectedRelease: "25.0.10",
+			expectedStep:    upgradeStepApplied,
+			expectedPatches: 3,
+		},
+		{
+			name:             "case 1: intent dropped after the schedule was cancelled",
+			conflictingPatch: 1,
+			change: func(cluster *capi.Cluster) {
+				delete(cluster.Annotations, "alpha.giantswarm.io/update-schedule-target-release")
+				delete(cluster.Annotations, "alpha.giantswarm.io/update-schedule-target-time")
+			},
+			expectedRelease: "25.0.1",
+			expectedPatches: 1,
+		},
+		{
+			name:             "case 2: apply retried after an unrelated change",
+			conflictingPatch: 2,
+			change: func(cluster *capi.Cluster) {
+				cluster.Annotations["giantswarm.io/other"] = "changed"
+			},
+			expectedRelease: "25.0.10",
+			expectedStep:    upgradeStepApplied,
+			expectedPatches: 3,
+		},
+		{
+			name:             "case 3: apply dropped after the release was changed",
+			conflictingPatch: 2,
+			change: func(cluster *capi.Cluster) {
+				cluster.Labels["release.giantswarm.io/version"] = "25.0.2"
+			},
+			expectedRelease: "25.0.2",
+			expectedStep:    upgradeStepIntent,
+			expectedPatches: 2,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+			drainEvents()
+
+			cluster := &capi.Cluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "conflict",
+					Namespace: "org-acme",
+					Labels: map[string]string{
+						"release.giantswarm.io/version": "25.0.1",
+					},
+					Annotations: map[string]string{
+						"alpha.giantswarm.io/update-schedule-target-release": "25.0.10",
+						"alpha.giantswarm.io/update-schedule-target-time":    "12 Mar 25 12:00 UTC",
+						ClusterUpgradeScheduledAt:                            "2025-03-11T12:00:00Z",
+						ClusterUpgradeAnnouncement:                           upgradeTime.Add(-15 * time.Minute).Format(time.RFC3339),
+					},
+				},
+			}
+
+			// Change the cluster concurrently before the conflicting patch is
+			// sent.
+			clusterPatches := 0
+			fakeClient := fake.NewClientBuilder().WithScheme(fakeScheme).WithObjects(cluster).WithInterceptorFuncs(interceptor.Funcs{
+				Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+					if _, ok := obj.(*capi.Cluster); ok {
+						clusterPatches++
+						if clusterPatches == tc.conflictingPatch {
+							latest := &capi.Cluster{}
+							if err := c.Get(ctx, client.ObjectKeyFromObject(obj), latest); err != nil {
+								return err
+							}
+							tc.change(latest)
+							if err := c.Update(ctx, latest); err != nil {
+								return err
+							}
+						}
+					}
+					return c.Patch(ctx, obj, patch, opts...)
+				},
+			}).Build()
+			fakeClock := clocktesting.NewFakeClock(upgradeTime.Add(time.Minute))
+			r := &ClusterReconciler{
+				Client: fakeClient,
+				Scheme: fakeScheme,
+				Log:    ctrl.Log.WithName("fake"),
+				Clock:  fakeClock,
+			}
+			ctx := context.TODO()
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: cluster.GetName(), Namespace: cluster.GetNamespace()}}
+
+			_, err := r.Reconcile(ctx, req)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedPatches, clusterPatches)
+
+			obj := &capi.Cluster{}
+			assert.NoError(t, fakeClient.Get(ctx, req.NamespacedName, obj))
+			assert.Equal(t, tc.expectedRelease, obj.Labels["release.giantswarm.io/version"])
+			progress, err := getUpgradeProgress(obj)
+			assert.NoError(t, err)
+			if tc.expectedStep == "" {
+				assert.Nil(t, progress)
+			} else if assert.NotNil(t, progress) {
+				assert.Equal(t, tc.expectedStep, progress.Step)
+			}
+			drainEvents()
+		})
+	}
+}
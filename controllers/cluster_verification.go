@@ -0,0 +1,183 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/giantswarm/k8smetadata/pkg/label"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	// ClusterUpgradeInProgress records a triggered upgrade from before it is
+	// applied until it has been verified. The value is a JSON encoded
+	// upgradeProgress.
+	ClusterUpgradeInProgress = "alpha.giantswarm.io/update-schedule-upgrade-in-progress"
+
+	// upgradeVerificationTimeout is how long a triggered upgrade may take
+	// until the cluster is healthy on the target release.
+	upgradeVerificationTimeout = 2 * time.Hour
+
+	// upgradeStepIntent is the step of an upgrade that was triggered but not
+	// applied yet. The upgrade is applied again until it reaches
+	// upgradeStepApplied.
+	upgradeStepIntent = "intent"
+	// upgradeStepApplied is the step of an upgrade that was applied and is
+	// verified. Upgrades recorded without step have been applied.
+	upgradeStepApplied = "applied"
+)
+
+// upgradeProgress is the value of the ClusterUpgradeInProgress annotation.
+type upgradeProgress struct {
+	OriginVersion string    `json:"origin"`
+	TargetVersion string    `json:"target"`
+	ScheduledAt   time.Time `json:"scheduledAt"`
+	TriggeredAt   time.Time `json:"triggeredAt"`
+	Step          string    `json:"step,omitempty"`
+	// ScheduledBy is the user who scheduled the upgrade, it is captured when
+	// the upgrade is triggered because the audit webhook removes the
+	// requester from the cluster.
+	ScheduledBy string `json:"scheduledBy,omitempty"`
+}
+
+func getUpgradeProgress(cluster *clusterv1.Cluster) (*upgradeProgress, error) {
+	value, ok := cluster.GetAnnotations()[ClusterUpgradeInProgress]
+	if !ok {
+		return nil, nil
+	}
+	progress := &upgradeProgress{}
+	if err := json.Unmarshal([]byte(value), progress); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse annotation %s", ClusterUpgradeInProgress)
+	}
+	return progress, nil
+}
+
+func setUpgradeProgress(cluster *clusterv1.Cluster, progress upgradeProgress) error {
+	value, err := json.Marshal(progress)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	cluster.Annotations[ClusterUpgradeInProgress] = string(value)
+	return nil
+}
+
+// verificationTimeoutRequeue requeues the cluster when the verification of the
+// upgrade times out. The cluster is verified earlier whenever it changes.
+func (r *ClusterReconciler) verificationTimeoutRequeue(cluster *clusterv1.Cluster, progress upgradeProgress) ctrl.Result {
+	return r.requeueAt(cluster, ActionVerificationTimeout, progress.TriggeredAt.Add(upgradeVerificationTimeout))
+}
+
+// upgradeVerified returns true if the cluster runs the target release and,
+// as far as it reports readiness, is ready.
+func upgradeVerified(cluster *clusterv1.Cluster, targetVersion string) bool {
+	if getClusterReleaseVersionLabel(cluster) != targetVersion {
+		return false
+	}
+	if conditions.Has(cluster, clusterv1.ReadyCondition) {
+		return conditions.IsTrue(cluster, clusterv1.ReadyCondition)
+	}
+	return true
+}
+
+// histogramLabelValues returns the provider and version bump labels of the
+// upgrade histograms.
+func histogramLabelValues(cluster *clusterv1.Cluster, originVersion string, targetVersion string) (string, string) {
+	origin, err := ParseTargetVersion(originVersion)
+	if err != nil {
+		return getClusterProvider(cluster), "unknown"
+	}
+	target, err := ParseTargetVersion(targetVersion)
+	if err != nil {
+		return getClusterProvider(cluster), "unknown"
+	}
+	return getClusterProvider(cluster), VersionBump(*origin, *target)
+}
+
+// ReconcileVerification follows a triggered upgrade until the cluster is
+// healthy on the target release or the verification timed out.
+func (r *ClusterReconciler) ReconcileVerification(ctx context.Context, cluster *clusterv1.Cluster, progress *upgradeProgress, log logr.Logger) (ctrl.Result, error) {
+	ctx, span := tracer.Start(ctx, "ReconcileVerification")
+	defer span.End()
+
+	upgrade := ScheduledUpgrade{
+		Installation:  r.Installation,
+		Cluster:       cluster.Name,
+		Namespace:     cluster.Namespace,
+		Organization:  cluster.Labels[label.Organization],
+		OriginVersion: progress.OriginVersion,
+		TargetVersion: progress.TargetVersion,
+		Time:          progress.ScheduledAt,
+		Announced:     true,
+		State:         UpgradeStateInProgress,
+	}
+	elapsed := r.now().Sub(progress.TriggeredAt)
+
+	verified := upgradeVerified(cluster, progress.TargetVersion)
+	if !verified {
+		if elapsed < upgradeVerificationTimeout {
+			log.Info(fmt.Sprintf("Waiting for the upgrade from release version %v to %v triggered %v ago to be rolled out.", progress.OriginVersion, progress.TargetVersion, elapsed.Round(time.Second)))
+			r.trackUpgrade(upgrade)
+			return r.verificationTimeoutRequeue(cluster, *progress), nil
+		}
+		log.Info(fmt.Sprintf("The upgrade from release version %v to %v was not verified within %v.", progress.OriginVersion, progress.TargetVersion, upgradeVerificationTimeout))
+		r.Recorder.Warnf(cluster, ReasonUpgradeVerificationTimeout, "The cluster did not become ready on release version %v within %v after the upgrade was triggered.", progress.TargetVersion, upgradeVerificationTimeout)
+	}
+
+	patched, err := r.patchClusterLocked(ctx, cluster, cluster.DeepCopy(), func(cluster *clusterv1.Cluster) error {
+		delete(cluster.Annotations, ClusterUpgradeInProgress)
+		return nil
+	})
+	if err != nil {
+		log.Error(err, "Failed to remove upgrade in progress annotation.")
+		reason := r.warnUpdateFailed(cluster, err, "Failed to remove upgrade in progress annotation")
+		r.trackFailedUpgrade(upgrade, reason, err)
+		return ctrl.Result{}, err
+	}
+	if !patched {
+		log.Info("The cluster changed while the upgrade was verified. The change will be reconciled.")
+		return ctrl.Result{}, nil
+	}
+
+	history := UpgradeRecord{
+		OriginVersion: progress.OriginVersion,
+		TargetVersion: progress.TargetVersion,
+		UpgradeTime:   progress.ScheduledAt,
+		TriggeredAt:   progress.TriggeredAt,
+		Outcome:       UpgradeStateCompleted,
+	}
+	completedAt := r.now()
+
+	if !verified {
+		r.trackFailedUpgrade(upgrade, ReasonUpgradeVerificationTimeout, errors.Errorf("upgrade not verified within %v", upgradeVerificationTimeout))
+		history.Outcome = UpgradeStateFailed
+		history.Reason = ReasonUpgradeVerificationTimeout
+		history.CompletedAt = &completedAt
+		r.recordHistory(ctx, cluster, history, log)
+		return ctrl.Result{}, nil
+	}
+
+	log.Info(fmt.Sprintf("The upgrade from release version %v to %v was verified after %v.", progress.OriginVersion, progress.TargetVersion, elapsed.Round(time.Second)))
+	r.Recorder.Eventf(cluster, ReasonUpgradeCompleted, "The cluster %s/%s in %s was upgraded from release version %v to %v in %v.",
+		cluster.Namespace,
+		cluster.Name,
+		r.Installation,
+		progress.OriginVersion,
+		progress.TargetVersion,
+		elapsed.Round(time.Minute),
+	)
+	provider, bump := histogramLabelValues(cluster, progress.OriginVersion, progress.TargetVersion)
+	UpgradeDuration.WithLabelValues(r.Installation, provider, bump).Observe(elapsed.Seconds())
+	upgrade.State = UpgradeStateCompleted
+	upgrade.CompletedAt = completedAt
+	r.trackUpgrade(upgrade)
+	history.CompletedAt = &completedAt
+	r.recordHistory(ctx, cluster, history, log)
+
+	return ctrl.Result{}, nil
+}
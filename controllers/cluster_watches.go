@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+
+	"github.com/giantswarm/k8smetadata/pkg/label"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const userConfigSuffix = "-userconfig"
+
+// appGVK is the kind of the Giant Swarm App CRs deploying the clusters and
+// their default apps.
+var appGVK = schema.GroupVersionKind{
+	Group:   "application.giantswarm.io",
+	Version: "v1alpha1",
+	Kind:    "App",
+}
+
+// releaseGVK is the kind of the Giant Swarm Release CRs.
+var releaseGVK = releaseListGVK.GroupVersion().WithKind("Release")
+
+// newUnstructured returns an empty object of the kind to watch it without
+// depending on its Go types.
+func newUnstructured(gvk schema.GroupVersionKind) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+	return obj
+}
+
+// kindInstalled returns false if the CRD of the kind is not installed, so
+// that it can not be watched.
+func kindInstalled(mapper meta.RESTMapper, gvk schema.GroupVersionKind) (bool, error) {
+	_, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// mapConfigMap enqueues all clusters when the emergency stop ConfigMap
+// changes, the cluster of a userconfig ConfigMap when it changes and the
+// deleted cluster of a history ConfigMap, so that its history is pruned.
+func (r *ClusterReconciler) mapConfigMap(ctx context.Context, obj client.Object) []reconcile.Request {
+	if requests := r.mapEmergencyStop(ctx, obj); requests != nil {
+		return requests
+	}
+	if name, ok := strings.CutSuffix(obj.GetName(), upgradeHistorySuffix); ok {
+		return r.mapDeletedCluster(ctx, obj.GetNamespace(), name)
+	}
+	name, ok := strings.CutSuffix(obj.GetName(), userConfigSuffix)
+	if !ok {
+		return nil
+	}
+	return r.mapCluster(ctx, obj.GetNamespace(), name)
+}
+
+// mapApp enqueues the cluster of an App CR. Apps of a cluster are labeled
+// with the cluster name, the app of the cluster itself is named like it.
+func (r *ClusterReconciler) mapApp(ctx context.Context, obj client.Object) []reconcile.Request {
+	name := obj.GetLabels()[label.Cluster]
+	if name == "" {
+		name = obj.GetName()
+	}
+	return r.mapCluster(ctx, obj.GetNamespace(), name)
+}
+
+// mapRelease enqueues the clusters running a release, whose end of life may
+// have changed, and the clusters of auto upgrade channels, which may upgrade
+// to the release.
+func (r *ClusterReconciler) mapRelease(ctx context.Context, obj client.Object) []reconcile.Request {
+	clusters := &clusterv1.ClusterList{}
+	if err := r.List(ctx, clusters); err != nil {
+		r.Log.Error(err, "Failed to list the clusters.", "trigger", client.ObjectKeyFromObject(obj))
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, cluster := range clusters.Items {
+		_, autoUpgrade := cluster.Annotations[ClusterAutoUpgradeChannel]
+		if autoUpgrade || releasePrefix(&cluster)+getClusterReleaseVersionLabel(&cluster) == obj.GetName() {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&cluster)})
+		}
+	}
+	return requests
+}
+
+// mapUpgradePolicy enqueues the clusters of the namespace of an upgrade
+// policy.
+func (r *ClusterReconciler) mapUpgradePolicy(ctx context.Context, obj client.Object) []reconcile.Request {
+	clusters := &clusterv1.ClusterList{}
+	if err := r.List(ctx, clusters, client.InNamespace(obj.GetNamespace())); err != nil {
+		r.Log.Error(err, "Failed to list the clusters.", "trigger", client.ObjectKeyFromObject(obj))
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(clusters.Items))
+	for _, cluster := range clusters.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&cluster)})
+	}
+	return requests
+}
+
+// mapCluster enqueues the cluster if it exists.
+func (r *ClusterReconciler) mapCluster(ctx context.Context, namespace string, name string) []reconcile.Request {
+	key := client.ObjectKey{Namespace: namespace, Name: name}
+	if err := r.Get(ctx, key, &clusterv1.Cluster{}); err != nil {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: key}}
+}
+
+// mapDeletedCluster enqueues the cluster if it does not exist.
+func (r *ClusterReconciler) mapDeletedCluster(ctx context.Context, namespace string, name string) []reconcile.Request {
+	key := client.ObjectKey{Namespace: namespace, Name: name}
+	if err := r.Get(ctx, key, &clusterv1.Cluster{}); !apierrors.IsNotFound(err) {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: key}}
+}
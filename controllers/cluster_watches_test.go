@@ -0,0 +1,143 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/giantswarm/upgrade-schedule-operator/api/v1alpha1"
+)
+
+func TestClusterWatchMappers(t *testing.T) {
+	stop := types.NamespacedName{Namespace: "giantswarm", Name: "upgrade-schedule-operator-emergency-stop"}
+	fakeClient := fake.NewClientBuilder().WithScheme(fakeScheme).WithObjects(
+		&capi.Cluster{ObjectMeta: metav1.ObjectMeta{
+			Name:      "capi",
+			Namespace: "org-acme",
+			Labels: map[string]string{
+				"release.giantswarm.io/version": "25.0.0",
+				"cluster.x-k8s.io/watch-filter": "capi",
+			},
+			Annotations: map[string]string{ClusterAutoUpgradeChannel: AutoUpgradeChannelPatch},
+		}},
+		&capi.Cluster{ObjectMeta: metav1.ObjectMeta{
+			Name:      "vintage",
+			Namespace: "org-acme",
+			Labels:    map[string]string{"release.giantswarm.io/version": "15.2.1"},
+		}},
+		&capi.Cluster{ObjectMeta: metav1.ObjectMeta{
+			Name:      "other",
+			Namespace: "org-other",
+			Labels:    map[string]string{"release.giantswarm.io/version": "16.0.0"},
+		}},
+	).Build()
+	r := &ClusterReconciler{Client: fakeClient, Log: ctrl.Log.WithName("fake"), EmergencyStop: stop}
+	ctx := context.TODO()
+
+	request := func(namespace string, name string) reconcile.Request {
+		return reconcile.Request{NamespacedName: types.NamespacedName{Namespace: namespace, Name: name}}
+	}
+	app := func(name string, labels map[string]string) client.Object {
+		obj := newUnstructured(appGVK)
+		obj.SetName(name)
+		obj.SetNamespace("org-acme")
+		obj.SetLabels(labels)
+		return obj
+	}
+	release := func(name string) client.Object {
+		obj := newUnstructured(releaseGVK)
+		obj.SetName(name)
+		return obj
+	}
+
+	testCases := []struct {
+		name             string
+		mapFunc          func(context.Context, client.Object) []reconcile.Request
+		obj              client.Object
+		expectedRequests []reconcile.Request
+	}{
+		{
+			name:             "case 0: userconfig ConfigMap",
+			mapFunc:          r.mapConfigMap,
+			obj:              &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "capi-userconfig", Namespace: "org-acme"}},
+			expectedRequests: []reconcile.Request{request("org-acme", "capi")},
+		},
+		{
+			name:    "case 1: userconfig ConfigMap without cluster",
+			mapFunc: r.mapConfigMap,
+			obj:     &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "deleted-userconfig", Namespace: "org-acme"}},
+		},
+		{
+			name:    "case 2: other ConfigMap",
+			mapFunc: r.mapConfigMap,
+			obj:     &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "capi", Namespace: "org-acme"}},
+		},
+		{
+			name:             "case 3: emergency stop ConfigMap",
+			mapFunc:          r.mapConfigMap,
+			obj:              &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: stop.Name, Namespace: stop.Namespace}},
+			expectedRequests: []reconcile.Request{request("org-acme", "capi"), request("org-acme", "vintage"), request("org-other", "other")},
+		},
+		{
+			name:             "case 4: history ConfigMap of a deleted cluster",
+			mapFunc:          r.mapConfigMap,
+			obj:              &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "deleted-upgrade-history", Namespace: "org-acme"}},
+			expectedRequests: []reconcile.Request{request("org-acme", "deleted")},
+		},
+		{
+			name:    "case 5: history ConfigMap of an existing cluster",
+			mapFunc: r.mapConfigMap,
+			obj:     &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "capi-upgrade-history", Namespace: "org-acme"}},
+		},
+		{
+			name:             "case 6: app of the cluster",
+			mapFunc:          r.mapApp,
+			obj:              app("capi", nil),
+			expectedRequests: []reconcile.Request{request("org-acme", "capi")},
+		},
+		{
+			name:             "case 7: default app of the cluster",
+			mapFunc:          r.mapApp,
+			obj:              app("capi-cilium", map[string]string{"giantswarm.io/cluster": "capi"}),
+			expectedRequests: []reconcile.Request{request("org-acme", "capi")},
+		},
+		{
+			name:    "case 8: app of no cluster",
+			mapFunc: r.mapApp,
+			obj:     app("hello-world", nil),
+		},
+		{
+			name:             "case 9: release of a vintage cluster",
+			mapFunc:          r.mapRelease,
+			obj:              release("v15.2.1"),
+			expectedRequests: []reconcile.Request{request("org-acme", "capi"), request("org-acme", "vintage")},
+		},
+		{
+			name:             "case 10: new release of an auto upgrade channel",
+			mapFunc:          r.mapRelease,
+			obj:              release("unknown-25.0.1"),
+			expectedRequests: []reconcile.Request{request("org-acme", "capi")},
+		},
+		{
+			name:             "case 11: upgrade policy",
+			mapFunc:          r.mapUpgradePolicy,
+			obj:              &v1alpha1.UpgradePolicy{ObjectMeta: metav1.ObjectMeta{Name: "acme", Namespace: "org-acme"}},
+			expectedRequests: []reconcile.Request{request("org-acme", "capi"), request("org-acme", "vintage")},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.ElementsMatch(t, tc.expectedRequests, tc.mapFunc(ctx, tc.obj))
+		})
+	}
+}
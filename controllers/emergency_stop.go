@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// EmergencyStopHaltedKey is the key of the emergency stop ConfigMap that
+	// halts all upgrades of the installation if it is true.
+	EmergencyStopHaltedKey = "halted"
+	// EmergencyStopReasonKey is the key of the emergency stop ConfigMap
+	// explaining the halt in the events of the affected clusters.
+	EmergencyStopReasonKey = "reason"
+
+	ReasonUpgradeHalted = "UpgradeHalted"
+)
+
+// emergencyStop returns true and the reason if the emergency stop ConfigMap
+// halts all upgrades.
+func (r *ClusterReconciler) emergencyStop(ctx context.Context) (bool, string, error) {
+	if r.EmergencyStop.Name == "" {
+		return false, "", nil
+	}
+	cm := &corev1.ConfigMap{}
+	err := r.Get(ctx, r.EmergencyStop, cm)
+	if apierrors.IsNotFound(err) {
+		EmergencyStopActive.WithLabelValues(r.Installation).Set(0)
+		return false, "", nil
+	}
+	if err != nil {
+		return false, "", errors.WithStack(err)
+	}
+	if cm.Data[EmergencyStopHaltedKey] != "true" {
+		EmergencyStopActive.WithLabelValues(r.Installation).Set(0)
+		return false, "", nil
+	}
+	EmergencyStopActive.WithLabelValues(r.Installation).Set(1)
+	return true, cm.Data[EmergencyStopReasonKey], nil
+}
+
+// reconcileEmergencyStop holds back the announcement and the trigger of the
+// upgrade while the emergency stop is active. Upgrades before their
+// announcement time are not affected. It returns nil if the upgrade may
+// proceed.
+func (r *ClusterReconciler) reconcileEmergencyStop(ctx context.Context, cluster *clusterv1.Cluster, upgrade ScheduledUpgrade, log logr.Logger) (*ctrl.Result, error) {
+	if !upgradeAnnouncementTimeReached(upgrade.Time, r.now()) {
+		return nil, nil
+	}
+	halted, reason, err := r.emergencyStop(ctx)
+	if err != nil {
+		log.Error(err, "Failed to read the emergency stop.")
+		r.trackFailedUpgrade(upgrade, ReasonUpgradeHalted, err)
+		return &ctrl.Result{}, err
+	}
+	if !halted {
+		return nil, nil
+	}
+
+	log.Info(fmt.Sprintf("The upgrade is halted by the emergency stop: %s", reason))
+	// Only notify once per halt, the upgrade store remembers the halt.
+	previous, ok := ScheduledUpgrade{}, false
+	if r.Upgrades != nil {
+		previous, ok = r.Upgrades.Get(r.Installation, client.ObjectKeyFromObject(cluster))
+	}
+	if !ok || previous.Reason != ReasonUpgradeHalted {
+		msg := fmt.Sprintf("The upgrade from release version %v to %v scheduled at %v is postponed because all upgrades in %s are halted.",
+			upgrade.OriginVersion,
+			upgrade.TargetVersion,
+			FormatUpgradeTime(upgrade.Time),
+			r.Installation,
+		)
+		if reason != "" {
+			msg += fmt.Sprintf(" Reason: %s.", reason)
+		}
+		msg += " The upgrade starts once the halt is lifted."
+		r.Recorder.Warn(cluster, ReasonUpgradeHalted, msg)
+	}
+	upgrade.Reason = ReasonUpgradeHalted
+	upgrade.Message = reason
+	r.setUpgradeMetrics(upgrade, metricStateBlocked)
+	if r.Upgrades != nil {
+		r.Upgrades.Set(upgrade)
+	}
+	return &ctrl.Result{RequeueAfter: CurrentSettings().RequeueInterval}, nil
+}
+
+// mapEmergencyStop enqueues all clusters when the emergency stop ConfigMap
+// changes.
+func (r *ClusterReconciler) mapEmergencyStop(ctx context.Context, obj client.Object) []reconcile.Request {
+	if obj.GetNamespace() != r.EmergencyStop.Namespace || obj.GetName() != r.EmergencyStop.Name {
+		return nil
+	}
+	return r.mapAllClusters(ctx, obj)
+}
+
+// mapAllClusters enqueues all clusters, e.g. when a resource affecting the
+// upgrades of all clusters changes.
+func (r *ClusterReconciler) mapAllClusters(ctx context.Context, obj client.Object) []reconcile.Request {
+	clusters := &clusterv1.ClusterList{}
+	if err := r.List(ctx, clusters); err != nil {
+		r.Log.Error(err, "Failed to list the clusters.", "trigger", client.ObjectKeyFromObject(obj))
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(clusters.Items))
+	for _, cluster := range clusters.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&cluster)})
+	}
+	return requests
+}
@@ -0,0 +1,190 @@
+package controllers
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clocktesting "k8s.io/utils/clock/testing"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestClusterControllerEmergencyStop(t *testing.T) {
+	upgradeTime := time.Date(2025, 3, 12, 12, 0, 0, 0, time.UTC)
+	stop := types.NamespacedName{Namespace: "giantswarm", Name: "upgrade-schedule-operator-emergency-stop"}
+
+	testCases := []struct {
+		name          string
+		halted        *string
+		announced     bool
+		alreadyHalted bool
+		now           time.Time
+
+		expectedState     UpgradeState
+		expectedReason    string
+		expectedRequeue   time.Duration
+		expectedAnnounced bool
+		expectedTriggered bool
+		expectedActive    float64
+		expectedEvent     string
+	}{
+		{
+			name:              "case 0: no emergency stop",
+			now:               upgradeTime.Add(-10 * time.Minute),
+			expectedState:     UpgradeStatePending,
+			expectedRequeue:   10*time.Minute + time.Second,
+			expectedAnnounced: true,
+			expectedEvent:     ReasonClusterUpgradeAnnouncement,
+		},
+		{
+			name:            "case 1: halted before the announcement time",
+			halted:          StringPtr("true"),
+			now:             upgradeTime.Add(-time.Hour),
+			expectedState:   UpgradeStatePending,
+			expectedRequeue: 45*time.Minute + time.Second,
+		},
+		{
+			name:            "case 2: halted announcement",
+			halted:          StringPtr("true"),
+			now:             upgradeTime.Add(-10 * time.Minute),
+			expectedState:   UpgradeStatePending,
+			expectedReason:  ReasonUpgradeHalted,
+			expectedRequeue: time.Minute,
+			expectedActive:  1,
+			expectedEvent:   ReasonUpgradeHalted,
+		},
+		{
+			name:              "case 3: halted trigger",
+			halted:            StringPtr("true"),
+			announced:         true,
+			now:               upgradeTime.Add(time.Minute),
+			expectedState:     UpgradeStatePending,
+			expectedReason:    ReasonUpgradeHalted,
+			expectedRequeue:   time.Minute,
+			expectedAnnounced: true,
+			expectedActive:    1,
+			expectedEvent:     ReasonUpgradeHalted,
+		},
+		{
+			name:              "case 4: halt notified once",
+			halted:            StringPtr("true"),
+			announced:         true,
+			alreadyHalted:     true,
+			now:               upgradeTime.Add(time.Minute),
+			expectedState:     UpgradeStatePending,
+			expectedReason:    ReasonUpgradeHalted,
+			expectedRequeue:   time.Minute,
+			expectedAnnounced: true,
+			expectedActive:    1,
+		},
+		{
+			name:              "case 5: halt lifted",
+			halted:            StringPtr("false"),
+			announced:         true,
+			alreadyHalted:     true,
+			now:               upgradeTime.Add(time.Minute),
+			expectedState:     UpgradeStateInProgress,
+			expectedRequeue:   2*time.Hour + time.Second,
+			expectedTriggered: true,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+			drainEvents()
+			EmergencyStopActive.WithLabelValues("").Set(0)
+
+			cluster := &capi.Cluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "halt",
+					Namespace: "org-acme",
+					Labels: map[string]string{
+						"release.giantswarm.io/version": "14.2.2",
+					},
+					Annotations: map[string]string{
+						"alpha.giantswarm.io/update-schedule-target-release": "15.2.1",
+						"alpha.giantswarm.io/update-schedule-target-time":    "12 Mar 25 12:00 UTC",
+						ClusterUpgradeScheduledAt:                            "2025-03-11T12:00:00Z",
+					},
+				},
+			}
+			if tc.announced {
+				cluster.Annotations[ClusterUpgradeAnnouncement] = upgradeTime.Add(-15 * time.Minute).Format(time.RFC3339)
+			}
+			objects := []client.Object{cluster}
+			if tc.halted != nil {
+				objects = append(objects, &corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: stop.Name, Namespace: stop.Namespace},
+					Data: map[string]string{
+						EmergencyStopHaltedKey: *tc.halted,
+						EmergencyStopReasonKey: "incident INC-42",
+					},
+				})
+			}
+
+			fakeClock := clocktesting.NewFakeClock(tc.now)
+			fakeClient := fake.NewClientBuilder().WithScheme(fakeScheme).WithObjects(objects...).Build()
+			r := &ClusterReconciler{
+				Client:        fakeClient,
+				Scheme:        fakeScheme,
+				Log:           ctrl.Log.WithName("fake"),
+				Upgrades:      NewUpgradeStore(fakeClock),
+				Clock:         fakeClock,
+				EmergencyStop: stop,
+			}
+			ctx := context.TODO()
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: cluster.GetName(), Namespace: cluster.GetNamespace()}}
+			if tc.alreadyHalted {
+				r.Upgrades.Set(ScheduledUpgrade{Cluster: "halt", Namespace: "org-acme", Reason: ReasonUpgradeHalted})
+			}
+
+			result, err := r.Reconcile(ctx, req)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedRequeue, result.RequeueAfter)
+			assert.Equal(t, tc.expectedActive, testutil.ToFloat64(EmergencyStopActive.WithLabelValues(r.Installation)))
+
+			upgrade, _ := r.Upgrades.Get(r.Installation, req.NamespacedName)
+			assert.Equal(t, tc.expectedState, upgrade.State)
+			assert.Equal(t, tc.expectedReason, upgrade.Reason)
+
+			obj := &capi.Cluster{}
+			assert.NoError(t, fakeClient.Get(ctx, req.NamespacedName, obj))
+			_, announced := obj.Annotations[ClusterUpgradeAnnouncement]
+			_, triggered := obj.Annotations[ClusterUpgradeInProgress]
+			assert.Equal(t, tc.expectedAnnounced, announced && !triggered)
+			assert.Equal(t, tc.expectedTriggered, triggered)
+
+			event := ""
+			for _, e := range drainEvents() {
+				event = strings.Fields(e)[1]
+			}
+			assert.Equal(t, tc.expectedEvent, event)
+		})
+	}
+}
+
+func TestMapEmergencyStop(t *testing.T) {
+	stop := types.NamespacedName{Namespace: "giantswarm", Name: "upgrade-schedule-operator-emergency-stop"}
+	fakeClient := fake.NewClientBuilder().WithScheme(fakeScheme).WithObjects(
+		&capi.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "org-acme"}},
+		&capi.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "org-other"}},
+	).Build()
+	r := &ClusterReconciler{Client: fakeClient, Log: ctrl.Log.WithName("fake"), EmergencyStop: stop}
+
+	requests := r.mapEmergencyStop(context.TODO(), &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: stop.Name, Namespace: stop.Namespace}})
+	assert.Len(t, requests, 2)
+
+	requests = r.mapEmergencyStop(context.TODO(), &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: stop.Namespace}})
+	assert.Empty(t, requests)
+}
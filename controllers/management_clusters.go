@@ -0,0 +1,338 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/client-go/rest"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
+	"sigs.k8s.io/controller-runtime/pkg/config"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+const (
+	// ManagementClusterLabel selects the kubeconfig Secrets of the remote
+	// management clusters. Its value is the installation name of the
+	// management cluster.
+	ManagementClusterLabel = "upgrade-schedule-operator.giantswarm.io/installation"
+	// ManagementClusterKubeconfigKey is the key of the kubeconfig in the
+	// Secrets of the remote management clusters.
+	ManagementClusterKubeconfigKey = "kubeconfig"
+
+	// managementClusterRetryInterval is how long to wait before a management
+	// cluster whose reconciler failed is started again.
+	managementClusterRetryInterval = time.Minute
+)
+
+// ManagementCluster is a remote management cluster whose clusters are
+// reconciled besides the clusters of the local one.
+type ManagementCluster struct {
+	Installation string
+	Config       *rest.Config
+
+	// kubeconfig is the kubeconfig the Config was loaded from.
+	kubeconfig []byte
+}
+
+// ListManagementClusters reads the remote management clusters from the
+// labeled kubeconfig Secrets in the namespace, ordered by installation. The
+// installation names have to be unique and differ from the local
+// installation.
+func ListManagementClusters(ctx context.Context, c client.Reader, namespace, localInstallation string) ([]ManagementCluster, error) {
+	secrets := &corev1.SecretList{}
+	err := c.List(ctx, secrets, client.InNamespace(namespace), client.HasLabels{ManagementClusterLabel})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list the management cluster secrets in namespace %s", namespace)
+	}
+
+	installations := map[string]string{localInstallation: ""}
+	var clusters []ManagementCluster
+	for _, secret := range secrets.Items {
+		installation := secret.Labels[ManagementClusterLabel]
+		if installation == "" {
+			return nil, errors.Errorf("secret %s/%s has no installation name", secret.Namespace, secret.Name)
+		}
+		if other, ok := installations[installation]; ok {
+			if other == "" {
+				return nil, errors.Errorf("secret %s/%s is of the local installation %s", secret.Namespace, secret.Name, installation)
+			}
+			return nil, errors.Errorf("secrets %s and %s are both of installation %s", other, secret.Name, installation)
+		}
+		installations[installation] = secret.Name
+
+		kubeconfig, ok := secret.Data[ManagementClusterKubeconfigKey]
+		if !ok {
+			return nil, errors.Errorf("secret %s/%s has no %s key", secret.Namespace, secret.Name, ManagementClusterKubeconfigKey)
+		}
+		config, err := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to load the kubeconfig of secret %s/%s", secret.Namespace, secret.Name)
+		}
+		clusters = append(clusters, ManagementCluster{Installation: installation, Config: config, kubeconfig: kubeconfig})
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		return clusters[i].Installation < clusters[j].Installation
+	})
+	return clusters, nil
+}
+
+// ManagementClusters reconciles the clusters of the remote management
+// clusters of the kubeconfig Secrets in Namespace. The Secrets are watched,
+// the reconciler of a management cluster is started when its Secret is added,
+// restarted when its kubeconfig changes and stopped when its Secret is
+// removed. Reconcilers that fail, e.g. because the management cluster is not
+// reachable, are started again after a minute. It is a manager runnable
+// running on the leader.
+type ManagementClusters struct {
+	// Manager is the manager of the local management cluster.
+	Manager manager.Manager
+	// Config connects to the local management cluster holding the Secrets.
+	Config *rest.Config
+	Scheme *runtime.Scheme
+	Log    logr.Logger
+
+	Namespace         string
+	LocalInstallation string
+	// Options are applied to the remote management clusters.
+	Options []cluster.Option
+	// Setup sets up the reconciler of the remote management cluster with the
+	// manager. The runnables added to the manager run while the clusters of
+	// the management cluster are reconciled.
+	Setup func(mgr manager.Manager, installation string, remote cluster.Cluster) error
+	// Upgrades is the store the upgrades of removed management clusters are
+	// deleted from. It is optional.
+	Upgrades *UpgradeStore
+
+	running map[string]*runningManagementCluster
+}
+
+// runningManagementCluster is a management cluster whose clusters are
+// reconciled.
+type runningManagementCluster struct {
+	kubeconfig []byte
+	cancel     context.CancelFunc
+	done       chan struct{}
+}
+
+// stop stops the reconciler of the management cluster and waits until it
+// stopped.
+func (c *runningManagementCluster) stop() {
+	c.cancel()
+	<-c.done
+}
+
+// Start watches the kubeconfig Secrets and runs the reconcilers of their
+// management clusters until the context is done.
+func (m *ManagementClusters) Start(ctx context.Context) error {
+	installation, err := labels.NewRequirement(ManagementClusterLabel, selection.Exists, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	secrets, err := cache.New(m.Config, cache.Options{
+		Scheme:            m.Scheme,
+		DefaultNamespaces: map[string]cache.Config{m.Namespace: {}},
+		ByObject: map[client.Object]cache.ByObject{
+			&corev1.Secret{}: {Label: labels.NewSelector().Add(*installation)},
+		},
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to create the cache of the management cluster secrets")
+	}
+	informer, err := secrets.GetInformer(ctx, &corev1.Secret{})
+	if err != nil {
+		return errors.Wrap(err, "failed to watch the management cluster secrets")
+	}
+	changed := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+	_, err = informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc:    func(any) { notify() },
+		UpdateFunc: func(any, any) { notify() },
+		DeleteFunc: func(any) { notify() },
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to watch the management cluster secrets")
+	}
+
+	go func() {
+		if err := secrets.Start(ctx); err != nil {
+			m.Log.Error(err, "Failed to watch the management cluster secrets.")
+		}
+	}()
+	if !secrets.WaitForCacheSync(ctx) {
+		return errors.Errorf("failed to sync the management cluster secrets in namespace %s", m.Namespace)
+	}
+
+	m.running = map[string]*runningManagementCluster{}
+	defer func() {
+		for installation := range m.running {
+			m.stop(installation)
+		}
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changed:
+			m.sync(ctx, secrets)
+		}
+	}
+}
+
+// sync starts, restarts and stops the reconcilers of the management clusters
+// to match the Secrets. The running reconcilers are kept if the Secrets are
+// invalid.
+func (m *ManagementClusters) sync(ctx context.Context, secrets client.Reader) {
+	clusters, err := ListManagementClusters(ctx, secrets, m.Namespace, m.LocalInstallation)
+	if err != nil {
+		m.Log.Error(err, "Failed to read the management clusters, the running management clusters are kept.")
+		return
+	}
+
+	installations := map[string]bool{}
+	for _, managementCluster := range clusters {
+		installations[managementCluster.Installation] = true
+		running, ok := m.running[managementCluster.Installation]
+		if ok && bytes.Equal(running.kubeconfig, managementCluster.kubeconfig) {
+			continue
+		}
+		if ok {
+			m.Log.Info("The kubeconfig of the management cluster changed, restarting its reconciler.", "installation", managementCluster.Installation)
+			running.stop()
+		} else {
+			m.Log.Info("Reconciling the clusters of a remote management cluster.", "installation", managementCluster.Installation)
+		}
+		m.running[managementCluster.Installation] = m.start(ctx, managementCluster)
+	}
+	for installation := range m.running {
+		if !installations[installation] {
+			m.Log.Info("The secret of the management cluster was removed, stopping its reconciler.", "installation", installation)
+			m.stop(installation)
+		}
+	}
+}
+
+// start runs the reconciler of the management cluster until the context is
+// done, starting it again whenever it failed.
+func (m *ManagementClusters) start(ctx context.Context, managementCluster ManagementCluster) *runningManagementCluster {
+	ctx, cancel := context.WithCancel(ctx)
+	running := &runningManagementCluster{
+		kubeconfig: managementCluster.kubeconfig,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+	}
+	go func() {
+		defer close(running.done)
+		for {
+			err := m.run(ctx, managementCluster)
+			ManagementClusterUp.WithLabelValues(managementCluster.Installation).Set(0)
+			if ctx.Err() != nil {
+				return
+			}
+			m.Log.Error(err, "Failed to reconcile the clusters of the management cluster, it is started again.", "installation", managementCluster.Installation, "after", managementClusterRetryInterval)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(managementClusterRetryInterval):
+			}
+		}
+	}()
+	return running
+}
+
+// stop stops the reconciler of the removed management cluster and forgets
+// its upgrades.
+func (m *ManagementClusters) stop(installation string) {
+	m.running[installation].stop()
+	delete(m.running, installation)
+	ManagementClusterUp.DeleteLabelValues(installation)
+	forgetInstallation(installation)
+	if m.Upgrades != nil {
+		m.Upgrades.DeleteInstallation(installation)
+	}
+}
+
+// run runs the cache and the runnables set up for the management cluster
+// until the context is done or one of them failed.
+func (m *ManagementClusters) run(ctx context.Context, managementCluster ManagementCluster) error {
+	remote, err := cluster.New(managementCluster.Config, m.Options...)
+	if err != nil {
+		return errors.Wrap(err, "failed to create the management cluster")
+	}
+	mgr := &managementClusterManager{Manager: m.Manager}
+	if err := m.Setup(mgr, managementCluster.Installation, remote); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+
+	runnables := append([]manager.Runnable{remote}, mgr.runnables...)
+	errs := make(chan error, len(runnables))
+	for _, runnable := range runnables {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- runnable.Start(ctx)
+		}()
+	}
+	// The management cluster is up once its cache synced. The controllers
+	// fail if it does not sync in time.
+	ManagementClusterUp.WithLabelValues(managementCluster.Installation).Set(0)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if remote.GetCache().WaitForCacheSync(ctx) {
+			ManagementClusterUp.WithLabelValues(managementCluster.Installation).Set(1)
+		}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-errs:
+		if err == nil {
+			err = errors.Errorf("the reconciler of management cluster %s stopped", managementCluster.Installation)
+		}
+		return err
+	}
+}
+
+// managementClusterManager collects the runnables added to the manager, so
+// that they are run with the management cluster instead. The controllers of
+// a management cluster keep their name when they are restarted.
+type managementClusterManager struct {
+	manager.Manager
+	runnables []manager.Runnable
+}
+
+func (m *managementClusterManager) Add(runnable manager.Runnable) error {
+	m.runnables = append(m.runnables, runnable)
+	return nil
+}
+
+func (m *managementClusterManager) GetControllerOptions() config.Controller {
+	options := m.Manager.GetControllerOptions()
+	options.SkipNameValidation = ptr.To(true)
+	return options
+}
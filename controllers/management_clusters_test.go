@@ -0,0 +1,208 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: remote
+  cluster:
+    server: https://remote.example.com:6443
+contexts:
+- name: remote
+  context:
+    cluster: remote
+    user: remote
+current-context: remote
+users:
+- name: remote
+  user:
+    token: secret
+`
+
+func managementClusterSecret(name, installation string, data map[string][]byte) *corev1.Secret {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "giantswarm",
+			Labels:    map[string]string{},
+		},
+		Data: data,
+	}
+	if installation != "-" {
+		secret.Labels[ManagementClusterLabel] = installation
+	}
+	return secret
+}
+
+func TestListManagementClusters(t *testing.T) {
+	kubeconfig := map[string][]byte{ManagementClusterKubeconfigKey: []byte(testKubeconfig)}
+
+	testCases := []struct {
+		name                  string
+		secrets               []client.Object
+		expectedInstallations []string
+		expectedHosts         []string
+		expectedErr           bool
+	}{
+		{
+			name: "case 0: no secrets",
+		},
+		{
+			name: "case 1: management clusters ordered by installation",
+			secrets: []client.Object{
+				managementClusterSecret("zeus", "zeus", kubeconfig),
+				managementClusterSecret("argali", "argali", kubeconfig),
+				managementClusterSecret("unrelated", "-", nil),
+			},
+			expectedInstallations: []string{"argali", "zeus"},
+			expectedHosts:         []string{"https://remote.example.com:6443", "https://remote.example.com:6443"},
+		},
+		{
+			name:        "case 2: local installation",
+			secrets:     []client.Object{managementClusterSecret("gauss", "gauss", kubeconfig)},
+			expectedErr: true,
+		},
+		{
+			name: "case 3: duplicate installation",
+			secrets: []client.Object{
+				managementClusterSecret("zeus", "zeus", kubeconfig),
+				managementClusterSecret("zeus-2", "zeus", kubeconfig),
+			},
+			expectedErr: true,
+		},
+		{
+			name:        "case 4: missing kubeconfig",
+			secrets:     []client.Object{managementClusterSecret("zeus", "zeus", map[string][]byte{"value": []byte(testKubeconfig)})},
+			expectedErr: true,
+		},
+		{
+			name:        "case 5: invalid kubeconfig",
+			secrets:     []client.Object{managementClusterSecret("zeus", "zeus", map[string][]byte{ManagementClusterKubeconfigKey: []byte("{")})},
+			expectedErr: true,
+		},
+		{
+			name:        "case 6: empty installation name",
+			secrets:     []client.Object{managementClusterSecret("zeus", "", kubeconfig)},
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fakeClient := fake.NewClientBuilder().WithScheme(fakeScheme).WithObjects(tc.secrets...).Build()
+			clusters, err := ListManagementClusters(context.TODO(), fakeClient, "giantswarm", "gauss")
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			var installations, hosts []string
+			for _, c := range clusters {
+				installations = append(installations, c.Installation)
+				hosts = append(hosts, c.Config.Host)
+			}
+			assert.Equal(t, tc.expectedInstallations, installations)
+			assert.Equal(t, tc.expectedHosts, hosts)
+		})
+	}
+}
+
+func TestManagementClustersSync(t *testing.T) {
+	kubeconfig := map[string][]byte{ManagementClusterKubeconfigKey: []byte(testKubeconfig)}
+	rotated := map[string][]byte{ManagementClusterKubeconfigKey: []byte(strings.Replace(testKubeconfig, "token: secret", "token: rotated", 1))}
+
+	// The steps are synced one after the other.
+	testCases := []struct {
+		name           string
+		secrets        []*corev1.Secret
+		expectedEvents []string
+	}{
+		{
+			name:           "case 0: management cluster added",
+			secrets:        []*corev1.Secret{managementClusterSecret("zeus", "zeus", kubeconfig)},
+			expectedEvents: []string{"start zeus"},
+		},
+		{
+			name:    "case 1: unchanged secret",
+			secrets: []*corev1.Secret{managementClusterSecret("zeus", "zeus", kubeconfig)},
+		},
+		{
+			name:           "case 2: kubeconfig rotated",
+			secrets:        []*corev1.Secret{managementClusterSecret("zeus", "zeus", rotated)},
+			expectedEvents: []string{"stop zeus", "start zeus"},
+		},
+		{
+			name: "case 3: invalid secret keeps the running management clusters",
+			secrets: []*corev1.Secret{
+				managementClusterSecret("zeus", "zeus", rotated),
+				managementClusterSecret("argali", "argali", nil),
+			},
+		},
+		{
+			name:           "case 4: management cluster removed",
+			expectedEvents: []string{"stop zeus"},
+		},
+	}
+
+	events := make(chan string, 10)
+	upgrades := NewUpgradeStore(nil)
+	m := &ManagementClusters{
+		Log:               ctrl.Log.WithName("fake"),
+		Namespace:         "giantswarm",
+		LocalInstallation: "gauss",
+		Setup: func(mgr manager.Manager, installation string, remote cluster.Cluster) error {
+			return mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+				events <- "start " + installation
+				<-ctx.Done()
+				events <- "stop " + installation
+				return nil
+			}))
+		},
+		Upgrades: upgrades,
+		running:  map[string]*runningManagementCluster{},
+	}
+	upgrades.Set(ScheduledUpgrade{Installation: "zeus", Cluster: "dh82p", Namespace: "org-acme"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			builder := fake.NewClientBuilder().WithScheme(fakeScheme)
+			for _, secret := range tc.secrets {
+				builder = builder.WithObjects(secret)
+			}
+			m.sync(ctx, builder.Build())
+
+			var received []string
+			for range tc.expectedEvents {
+				select {
+				case event := <-events:
+					received = append(received, event)
+				case <-time.After(5 * time.Second):
+				}
+			}
+			assert.Equal(t, tc.expectedEvents, received)
+		})
+	}
+
+	assert.Empty(t, m.running)
+	assert.False(t, ManagementClusterUp.DeleteLabelValues("zeus"), "the series of the removed management cluster is deleted")
+	_, ok := upgrades.Get("zeus", types.NamespacedName{Name: "dh82p", Namespace: "org-acme"})
+	assert.False(t, ok, "the upgrades of the removed management cluster are deleted")
+}
@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/blang/semver"
+	"github.com/pkg/errors"
+)
+
+const (
+	// UpgradeTimeFormat is the format of the upgrade time annotation.
+	UpgradeTimeFormat = time.RFC822
+
+	// maximumUpgradeHorizonMonths is how many months in advance an upgrade
+	// can be scheduled at most unless the upgrade policy sets another
+	// horizon.
+	maximumUpgradeHorizonMonths = 6
+)
+
+// MinimumUpgradeNotice returns the minimum time between scheduling an upgrade
+// and the upgrade time. It ensures the upgrade can be announced.
+func MinimumUpgradeNotice() time.Duration {
+	return CurrentSettings().AnnouncementOffset + time.Minute
+}
+
+// ParseUpgradeTime parses the value of the upgrade time annotation. The value
+// has to be in RFC822 format and in the UTC time zone, e.g. 30 Jan 21 15:04 UTC.
+func ParseUpgradeTime(value string) (time.Time, error) {
+	upgradeTime, err := time.Parse(UpgradeTimeFormat, value)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "upgrade time %q has to be in RFC822 format, e.g. 30 Jan 21 15:04 UTC", value)
+	}
+	if upgradeTime.Location() != time.UTC {
+		return time.Time{}, errors.Errorf("upgrade time %q has to be in the UTC time zone, e.g. 30 Jan 21 15:04 UTC", value)
+	}
+	return upgradeTime, nil
+}
+
+// FormatUpgradeTime formats a time as value of the upgrade time annotation.
+func FormatUpgradeTime(upgradeTime time.Time) string {
+	return upgradeTime.UTC().Format(UpgradeTimeFormat)
+}
+
+// ParseTargetVersion parses the value of the upgrade target release
+// annotation. The value has to be only the release version, e.g. 15.2.1.
+func ParseTargetVersion(value string) (*semver.Version, error) {
+	version, err := semver.New(value)
+	if err != nil {
+		return nil, errors.Wrapf(err, "target release version %q has to be only the desired release version, e.g. 15.2.1", value)
+	}
+	return version, nil
+}
+
+// ValidateUpgradeTime returns an error if an upgrade can not be scheduled
+// for the given time at now by the default upgrade policy. Upgrades have to
+// be scheduled at least MinimumUpgradeNotice but not more than six months in
+// advance.
+func ValidateUpgradeTime(upgradeTime time.Time, now time.Time) error {
+	return EffectivePolicy{}.Validate(upgradeTime, now, "")
+}
+
+// ValidateTargetVersion returns an error if the target release version is
+// not higher than the current release version.
+func ValidateTargetVersion(targetVersion semver.Version, currentVersion semver.Version) error {
+	if upgradeApplied(targetVersion, currentVersion) {
+		return errors.Errorf("target release version %v has to be higher than the current release version %v", targetVersion, currentVersion)
+	}
+	return nil
+}
+
+// UpgradeAnnouncementTime returns the time an upgrade scheduled at
+// upgradeTime is announced at.
+func UpgradeAnnouncementTime(upgradeTime time.Time) time.Time {
+	return upgradeTime.Add(-CurrentSettings().AnnouncementOffset)
+}
@@ -0,0 +1,249 @@
+package controllers
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/clock"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+// Action is a time based action of the upgrade of a cluster.
+type Action string
+
+const (
+	ActionEndOfLife           Action = "end_of_life"
+	ActionEndOfLifeReminder   Action = "end_of_life_reminder"
+	ActionAnnouncement        Action = "announcement"
+	ActionTrigger             Action = "trigger"
+	ActionVerificationTimeout Action = "verification_timeout"
+	ActionFreezeExpiry        Action = "freeze_expiry"
+	ActionHistoryExpiry       Action = "history_expiry"
+)
+
+// ScheduledAction is the next due action of a cluster.
+type ScheduledAction struct {
+	Cluster types.NamespacedName
+	Action  Action
+	Due     time.Time
+
+	index int
+}
+
+// actionQueue is a priority queue of scheduled actions ordered by due time.
+type actionQueue []*ScheduledAction
+
+func (q actionQueue) Len() int { return len(q) }
+
+func (q actionQueue) Less(i, j int) bool { return q[i].Due.Before(q[j].Due) }
+
+func (q actionQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *actionQueue) Push(x any) {
+	action := x.(*ScheduledAction)
+	action.index = len(*q)
+	*q = append(*q, action)
+}
+
+func (q *actionQueue) Pop() any {
+	old := *q
+	action := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return action
+}
+
+// Scheduler keeps the next due action of every cluster in a priority queue
+// and enqueues the cluster once its action is due, so that clusters are not
+// polled. It is a manager runnable.
+type Scheduler struct {
+	clock clock.PassiveClock
+
+	mu      sync.Mutex
+	queue   actionQueue
+	actions map[types.NamespacedName]*ScheduledAction
+	// wake interrupts the wait for the next due action when an earlier
+	// action is scheduled.
+	wake   chan struct{}
+	events chan event.GenericEvent
+}
+
+// NewScheduler creates a Scheduler using the clock to decide when actions
+// are due.
+func NewScheduler(c clock.PassiveClock) *Scheduler {
+	return &Scheduler{
+		clock:   c,
+		actions: map[types.NamespacedName]*ScheduledAction{},
+		wake:    make(chan struct{}, 1),
+		events:  make(chan event.GenericEvent),
+	}
+}
+
+// Events returns the channel receiving an event for every cluster whose
+// action is due.
+func (s *Scheduler) Events() <-chan event.GenericEvent {
+	return s.events
+}
+
+// Schedule sets the next due action of the cluster, replacing the action
+// scheduled before.
+func (s *Scheduler) Schedule(cluster types.NamespacedName, action Action, due time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if scheduled, ok := s.actions[cluster]; ok {
+		scheduled.Action = action
+		scheduled.Due = due
+		heap.Fix(&s.queue, scheduled.index)
+	} else {
+		scheduled := &ScheduledAction{Cluster: cluster, Action: action, Due: due}
+		heap.Push(&s.queue, scheduled)
+		s.actions[cluster] = scheduled
+	}
+	if s.queue[0].Cluster == cluster {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Cancel removes the scheduled action of the cluster.
+func (s *Scheduler) Cancel(cluster types.NamespacedName) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if scheduled, ok := s.actions[cluster]; ok {
+		heap.Remove(&s.queue, scheduled.index)
+		delete(s.actions, cluster)
+	}
+}
+
+// Expire makes all scheduled actions due now, so that their clusters are
+// reconciled and their actions are scheduled again, e.g. after the settings
+// changed.
+func (s *Scheduler) Expire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.queue) == 0 {
+		return
+	}
+	now := s.clock.Now()
+	for _, scheduled := range s.queue {
+		scheduled.Due = now
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Get returns the scheduled action of the cluster.
+func (s *Scheduler) Get(cluster types.NamespacedName) (ScheduledAction, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	scheduled, ok := s.actions[cluster]
+	if !ok {
+		return ScheduledAction{}, false
+	}
+	return *scheduled, true
+}
+
+// Len returns the number of scheduled actions.
+func (s *Scheduler) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.queue)
+}
+
+// Next returns the time the next action is due. It returns false if there
+// is no scheduled action.
+func (s *Scheduler) Next() (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.queue) == 0 {
+		return time.Time{}, false
+	}
+	return s.queue[0].Due, true
+}
+
+// PopDue removes and returns the actions due at now ordered by due time.
+func (s *Scheduler) PopDue(now time.Time) []ScheduledAction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []ScheduledAction
+	for len(s.queue) > 0 && !s.queue[0].Due.After(now) {
+		scheduled := heap.Pop(&s.queue).(*ScheduledAction)
+		delete(s.actions, scheduled.Cluster)
+		due = append(due, *scheduled)
+	}
+	return due
+}
+
+// Start sends an event for every due action until the context is done.
+func (s *Scheduler) Start(ctx context.Context) error {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		for _, scheduled := range s.PopDue(s.clock.Now()) {
+			obj := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{
+				Name:      scheduled.Cluster.Name,
+				Namespace: scheduled.Cluster.Namespace,
+			}}
+			select {
+			case s.events <- event.GenericEvent{Object: obj}:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+
+		// Wait for the next due action, new actions may be due earlier.
+		wait := time.Hour
+		if next, ok := s.Next(); ok && next.Sub(s.clock.Now()) < wait {
+			wait = next.Sub(s.clock.Now())
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// requeueAt schedules the next time based action of the cluster right after
+// it is due. Without scheduler the cluster is requeued instead.
+func (r *ClusterReconciler) requeueAt(cluster *clusterv1.Cluster, action Action, due time.Time) ctrl.Result {
+	return r.requeueKeyAt(client.ObjectKeyFromObject(cluster), action, due)
+}
+
+// requeueKeyAt is requeueAt for clusters that may not exist anymore.
+func (r *ClusterReconciler) requeueKeyAt(key client.ObjectKey, action Action, due time.Time) ctrl.Result {
+	if r.Scheduler == nil {
+		return timedRequeue(due, r.now())
+	}
+	r.Scheduler.Schedule(key, action, due.Add(time.Second))
+	return ctrl.Result{}
+}
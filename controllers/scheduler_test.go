@@ -0,0 +1,253 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/clock"
+	clocktesting "k8s.io/utils/clock/testing"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestScheduler(t *testing.T) {
+	now := time.Date(2025, 3, 12, 10, 0, 0, 0, time.UTC)
+	a := types.NamespacedName{Namespace: "org-acme", Name: "a"}
+	b := types.NamespacedName{Namespace: "org-acme", Name: "b"}
+	c := types.NamespacedName{Namespace: "org-acme", Name: "c"}
+
+	s := NewScheduler(clocktesting.NewFakeClock(now))
+	_, ok := s.Next()
+	assert.False(t, ok)
+
+	s.Schedule(a, ActionTrigger, now.Add(3*time.Hour))
+	s.Schedule(b, ActionAnnouncement, now.Add(2*time.Hour))
+	s.Schedule(c, ActionVerificationTimeout, now.Add(time.Hour))
+	assert.Equal(t, 3, s.Len())
+	next, ok := s.Next()
+	assert.True(t, ok)
+	assert.Equal(t, now.Add(time.Hour), next)
+
+	// Rescheduling replaces the action of the cluster.
+	s.Schedule(a, ActionAnnouncement, now.Add(30*time.Minute))
+	assert.Equal(t, 3, s.Len())
+	scheduled, ok := s.Get(a)
+	assert.True(t, ok)
+	assert.Equal(t, ActionAnnouncement, scheduled.Action)
+	next, _ = s.Next()
+	assert.Equal(t, now.Add(30*time.Minute), next)
+
+	s.Cancel(c)
+	_, ok = s.Get(c)
+	assert.False(t, ok)
+	assert.Empty(t, s.PopDue(now))
+
+	due := s.PopDue(now.Add(2 * time.Hour))
+	if assert.Len(t, due, 2) {
+		assert.Equal(t, a, due[0].Cluster)
+		assert.Equal(t, b, due[1].Cluster)
+	}
+	assert.Equal(t, 0, s.Len())
+	_, ok = s.Get(a)
+	assert.False(t, ok)
+
+	// Expired actions are all due now.
+	s.Schedule(a, ActionTrigger, now.Add(3*time.Hour))
+	s.Schedule(b, ActionAnnouncement, now.Add(2*time.Hour))
+	s.Expire()
+	assert.Len(t, s.PopDue(now), 2)
+}
+
+func TestSchedulerStart(t *testing.T) {
+	s := NewScheduler(clock.RealClock{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() {
+		done <- s.Start(ctx)
+	}()
+
+	// The scheduler wakes up for an action due earlier than the next one.
+	s.Schedule(types.NamespacedName{Namespace: "org-acme", Name: "later"}, ActionTrigger, time.Now().Add(time.Hour))
+	s.Schedule(types.NamespacedName{Namespace: "org-acme", Name: "soon"}, ActionTrigger, time.Now().Add(10*time.Millisecond))
+	select {
+	case e := <-s.Events():
+		assert.Equal(t, "soon", e.Object.GetName())
+		assert.Equal(t, "org-acme", e.Object.GetNamespace())
+	case <-time.After(5 * time.Second):
+		t.Fatal("the due action was not sent")
+	}
+	assert.Equal(t, 1, s.Len())
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestClusterControllerScheduler(t *testing.T) {
+	upgradeTime := time.Date(2025, 3, 12, 12, 0, 0, 0, time.UTC)
+	cluster := &capi.Cluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "scheduled",
+			Namespace: "org-acme",
+			Labels: map[string]string{
+				"release.giantswarm.io/version": "14.2.2",
+			},
+			Annotations: map[string]string{
+				"alpha.giantswarm.io/update-schedule-target-release": "15.2.1",
+				"alpha.giantswarm.io/update-schedule-target-time":    "12 Mar 25 12:00 UTC",
+				ClusterUpgradeScheduledAt:                            "2025-03-11T12:00:00Z",
+			},
+		},
+	}
+	fakeClock := clocktesting.NewFakeClock(upgradeTime.Add(-time.Hour))
+	fakeClient := fake.NewClientBuilder().WithScheme(fakeScheme).WithObjects(cluster).Build()
+	r := &ClusterReconciler{
+		Client:    fakeClient,
+		Scheme:    fakeScheme,
+		Log:       ctrl.Log.WithName("fake"),
+		Clock:     fakeClock,
+		Scheduler: NewScheduler(fakeClock),
+	}
+	ctx := context.TODO()
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(cluster)}
+
+	result, err := r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.True(t, result.IsZero())
+	scheduled, ok := r.Scheduler.Get(req.NamespacedName)
+	assert.True(t, ok)
+	assert.Equal(t, ActionAnnouncement, scheduled.Action)
+	assert.Equal(t, upgradeTime.Add(-15*time.Minute+time.Second), scheduled.Due)
+
+	fakeClock.SetTime(scheduled.Due)
+	_, err = r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	drainEvents()
+	scheduled, _ = r.Scheduler.Get(req.NamespacedName)
+	assert.Equal(t, ActionTrigger, scheduled.Action)
+	assert.Equal(t, upgradeTime.Add(time.Second), scheduled.Due)
+
+	// The action of a cluster without scheduled upgrade is cancelled.
+	obj := &capi.Cluster{}
+	assert.NoError(t, fakeClient.Get(ctx, req.NamespacedName, obj))
+	delete(obj.Annotations, "alpha.giantswarm.io/update-schedule-target-time")
+	assert.NoError(t, fakeClient.Update(ctx, obj))
+	_, err = r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	_, ok = r.Scheduler.Get(req.NamespacedName)
+	assert.False(t, ok)
+}
+
+// BenchmarkSchedulerReconcileLoad runs 5000 clusters, a tenth of them with an
+// upgrade scheduled within the day, through a simulated day and reports the
+// reconciles of the initial sync and of the due actions. Polling every
+// cluster every 5 minutes took 288 reconciles per cluster and day. Reconciles
+// caused by watch events are not simulated.
+func BenchmarkSchedulerReconcileLoad(b *testing.B) {
+	const clusters = 5000
+	start := time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)
+	ctx := context.TODO()
+
+	// Discard the events of the announcements.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-fakeRecorder.Events:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for n := 0; n < b.N; n++ {
+		b.StopTimer()
+		objects := make([]client.Object, 0, clusters)
+		for i := range clusters {
+			cluster := &capi.Cluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        fmt.Sprintf("c%04d", i),
+					Namespace:   fmt.Sprintf("org-%02d", i%50),
+					Labels:      map[string]string{"release.giantswarm.io/version": "14.2.2"},
+					Annotations: map[string]string{},
+				},
+			}
+			if i%10 == 0 {
+				upgradeTime := start.Add(time.Hour + time.Duration(i/10%22)*time.Hour)
+				cluster.Annotations["alpha.giantswarm.io/update-schedule-target-release"] = "15.2.1"
+				cluster.Annotations["alpha.giantswarm.io/update-schedule-target-time"] = FormatUpgradeTime(upgradeTime)
+				cluster.Annotations[ClusterUpgradeScheduledAt] = start.Add(-24 * time.Hour).Format(time.RFC3339)
+			}
+			objects = append(objects, cluster)
+		}
+		fakeClock := clocktesting.NewFakeClock(start)
+		r := &ClusterReconciler{
+			Client:    fake.NewClientBuilder().WithScheme(fakeScheme).WithObjects(objects...).Build(),
+			Scheme:    fakeScheme,
+			Log:       ctrl.Log.WithName("fake"),
+			Clock:     fakeClock,
+			Scheduler: NewScheduler(fakeClock),
+		}
+		b.StartTimer()
+
+		reconciles := 0
+		reconcile := func(key types.NamespacedName) {
+			if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+				b.Fatal(err)
+			}
+			reconciles++
+		}
+		for _, obj := range objects {
+			reconcile(client.ObjectKeyFromObject(obj))
+		}
+		for {
+			next, ok := r.Scheduler.Next()
+			if !ok || next.After(start.Add(24*time.Hour)) {
+				break
+			}
+			fakeClock.SetTime(next)
+			for _, scheduled := range r.Scheduler.PopDue(next) {
+				reconcile(scheduled.Cluster)
+			}
+		}
+
+		// Every scheduled upgrade was announced and triggered.
+		b.StopTimer()
+		for i, obj := range objects {
+			if i%10 != 0 {
+				continue
+			}
+			cluster := &capi.Cluster{}
+			if err := r.Get(ctx, client.ObjectKeyFromObject(obj), cluster); err != nil {
+				b.Fatal(err)
+			}
+			if version := cluster.Labels["release.giantswarm.io/version"]; version != "15.2.1" {
+				b.Fatalf("cluster %s was not upgraded, it runs release version %s", cluster.Name, version)
+			}
+			history := &corev1.ConfigMap{}
+			if err := r.Get(ctx, types.NamespacedName{Name: UpgradeHistoryName(cluster.Name), Namespace: cluster.Namespace}, history); err != nil {
+				b.Fatal(err)
+			}
+			records, err := ParseUpgradeHistory(history)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if len(records) != 1 || records[0].AnnouncedAt == nil {
+				b.Fatalf("the upgrade of cluster %s was not announced", cluster.Name)
+			}
+		}
+		b.StartTimer()
+
+		b.ReportMetric(float64(reconciles), "reconciles/day")
+		b.ReportMetric(float64(reconciles)/clusters, "reconciles/cluster/day")
+	}
+}
@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"sync"
+	"time"
+)
+
+// Settings are the operator settings of the config file. They can be changed
+// while the operator runs.
+type Settings struct {
+	// AnnouncementOffset is how long before the upgrade time the upgrade is
+	// announced.
+	AnnouncementOffset time.Duration
+	// BusinessHours are the hours of the weekdays, in UTC, the contact is
+	// not named in the announcement of upgrades during.
+	BusinessHours BusinessHours
+	// Contact is named in the announcement of upgrades outside of the
+	// business hours. It is not named if empty.
+	Contact string
+	// RequeueInterval is how often upgrades held back by the emergency stop
+	// or by the concurrency limit of their upgrade policy are retried.
+	RequeueInterval time.Duration
+}
+
+// BusinessHours are the hours from Start to End, in UTC, of the weekdays.
+type BusinessHours struct {
+	Start int
+	End   int
+}
+
+// DefaultSettings returns the settings used without config file.
+func DefaultSettings() Settings {
+	return Settings{
+		AnnouncementOffset: 15 * time.Minute,
+		BusinessHours:      BusinessHours{Start: 8, End: 16},
+		Contact:            OutOfHoursContact,
+		RequeueInterval:    time.Minute,
+	}
+}
+
+var settings = struct {
+	mu sync.RWMutex
+	Settings
+}{Settings: DefaultSettings()}
+
+// SetSettings replaces the settings of the operator. The settings have to be
+// valid.
+func SetSettings(s Settings) {
+	settings.mu.Lock()
+	defer settings.mu.Unlock()
+	settings.Settings = s
+}
+
+// CurrentSettings returns the settings of the operator.
+func CurrentSettings() Settings {
+	settings.mu.RLock()
+	defer settings.mu.RUnlock()
+	return settings.Settings
+}
+
+// outOfOffice returns true if the upgrade time is outside of the business
+// hours.
+func outOfOffice(upgradeTime time.Time) bool {
+	upgradeTime = upgradeTime.UTC()
+	if upgradeTime.Weekday() == time.Saturday || upgradeTime.Weekday() == time.Sunday {
+		return true
+	}
+	hours := CurrentSettings().BusinessHours
+	return upgradeTime.Hour() < hours.Start || upgradeTime.Hour() >= hours.End
+}
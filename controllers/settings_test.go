@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/giantswarm/upgrade-schedule-operator/util/config"
+)
+
+func Test_OutOfOffice(t *testing.T) {
+	testCases := []struct {
+		name          string
+		businessHours BusinessHours
+		upgradeTime   time.Time
+		expected      bool
+	}{
+		{
+			name:          "case 0: default business hours",
+			businessHours: DefaultSettings().BusinessHours,
+			upgradeTime:   time.Date(2025, 3, 12, 8, 0, 0, 0, time.UTC),
+			expected:      false,
+		},
+		{
+			name:          "case 1: after the default business hours",
+			businessHours: DefaultSettings().BusinessHours,
+			upgradeTime:   time.Date(2025, 3, 12, 16, 0, 0, 0, time.UTC),
+			expected:      true,
+		},
+		{
+			name:          "case 2: weekend",
+			businessHours: DefaultSettings().BusinessHours,
+			upgradeTime:   time.Date(2025, 3, 15, 10, 0, 0, 0, time.UTC),
+			expected:      true,
+		},
+		{
+			name:          "case 3: configured business hours",
+			businessHours: BusinessHours{Start: 10, End: 20},
+			upgradeTime:   time.Date(2025, 3, 12, 19, 0, 0, 0, time.UTC),
+			expected:      false,
+		},
+		{
+			name:          "case 4: before the configured business hours",
+			businessHours: BusinessHours{Start: 10, End: 20},
+			upgradeTime:   time.Date(2025, 3, 12, 9, 0, 0, 0, time.UTC),
+			expected:      true,
+		},
+	}
+
+	t.Cleanup(func() { SetSettings(DefaultSettings()) })
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+			settings := DefaultSettings()
+			settings.BusinessHours = tc.businessHours
+			SetSettings(settings)
+			assert.Equal(t, tc.expected, outOfOffice(tc.upgradeTime))
+		})
+	}
+}
+
+func TestSettingsAnnouncementOffset(t *testing.T) {
+	t.Cleanup(func() { SetSettings(DefaultSettings()) })
+	upgradeTime := time.Date(2025, 3, 12, 12, 0, 0, 0, time.UTC)
+
+	settings := DefaultSettings()
+	settings.AnnouncementOffset = time.Hour
+	SetSettings(settings)
+	assert.Equal(t, upgradeTime.Add(-time.Hour), UpgradeAnnouncementTime(upgradeTime))
+	assert.Equal(t, time.Hour+time.Minute, MinimumUpgradeNotice())
+	assert.True(t, upgradeAnnouncementTimeReached(upgradeTime, upgradeTime.Add(-30*time.Minute)))
+}
+
+func TestDefaultSettingsMatchConfig(t *testing.T) {
+	operator := config.Default().Operator
+	assert.Equal(t, DefaultSettings(), Settings{
+		AnnouncementOffset: operator.AnnouncementOffset.Duration,
+		BusinessHours:      BusinessHours{Start: operator.BusinessHours.Start, End: operator.BusinessHours.End},
+		Contact:            operator.Contact,
+		RequeueInterval:    operator.RequeueInterval.Duration,
+	})
+}
@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var tracer = otel.Tracer("github.com/giantswarm/upgrade-schedule-operator/controllers")
+
+// scheduleSpanContext returns the span context all spans of a scheduled
+// upgrade are children of. Its trace ID is derived from the cluster, the
+// target release and the upgrade time, so that every reconcile of the same
+// scheduled upgrade, including retries and the verification, ends up in the
+// same trace. It returns false if the cluster has no scheduled upgrade.
+func scheduleSpanContext(cluster *clusterv1.Cluster) (trace.SpanContext, bool) {
+	var targetVersion, upgradeTime string
+	if progress, err := getUpgradeProgress(cluster); err == nil && progress != nil {
+		targetVersion = progress.TargetVersion
+		upgradeTime = fmt.Sprint(progress.ScheduledAt.Unix())
+	} else {
+		targetVersion = getClusterUpgradeVersionAnnotation(cluster)
+		upgradeTime = getClusterUpgradeTimeAnnotation(cluster)
+		if upgradeTime == "" {
+			return trace.SpanContext{}, false
+		}
+		if t, err := ParseUpgradeTime(upgradeTime); err == nil {
+			upgradeTime = fmt.Sprint(t.Unix())
+		}
+	}
+
+	sum := sha256.Sum256(fmt.Appendf(nil, "%s/%s/%s/%s", cluster.Namespace, cluster.Name, targetVersion, upgradeTime))
+	var traceID trace.TraceID
+	var spanID trace.SpanID
+	copy(traceID[:], sum[:16])
+	copy(spanID[:], sum[16:24])
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	}), true
+}
+
+// startReconcileSpan starts the span of a reconcile of the cluster as part of
+// the trace of its scheduled upgrade.
+func startReconcileSpan(ctx context.Context, cluster *clusterv1.Cluster) (context.Context, trace.Span) {
+	if sc, ok := scheduleSpanContext(cluster); ok {
+		ctx = trace.ContextWithRemoteSpanContext(ctx, sc)
+	}
+	return tracer.Start(ctx, "Reconcile", trace.WithAttributes(
+		attribute.String("cluster.name", cluster.Name),
+		attribute.String("cluster.namespace", cluster.Namespace),
+		attribute.String("upgrade.target_release", getClusterUpgradeVersionAnnotation(cluster)),
+		attribute.String("upgrade.time", getClusterUpgradeTimeAnnotation(cluster)),
+	))
+}
+
+// endSpan records the error, if any, and ends the span.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// tracedGet reads the object within a span of the given name.
+func (r *ClusterReconciler) tracedGet(ctx context.Context, name string, key client.ObjectKey, obj client.Object) error {
+	ctx, span := tracer.Start(ctx, name, trace.WithAttributes(attribute.String("object.name", key.Name)))
+	err := r.Get(ctx, key, obj)
+	endSpan(span, err)
+	return err
+}
+
+// tracedPatch patches the object as FieldManager within a span of the given
+// name.
+func (r *ClusterReconciler) tracedPatch(ctx context.Context, name string, obj client.Object, patch client.Patch) error {
+	ctx, span := tracer.Start(ctx, name, trace.WithAttributes(attribute.String("object.name", obj.GetName())))
+	err := r.Patch(ctx, obj, patch, client.FieldOwner(FieldManager))
+	endSpan(span, err)
+	return err
+}
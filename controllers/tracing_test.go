@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clocktesting "k8s.io/utils/clock/testing"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestScheduleSpanContext(t *testing.T) {
+	newCluster := func(annotations map[string]string) *capi.Cluster {
+		return &capi.Cluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "dh82p",
+				Namespace:   "org-acme",
+				Annotations: annotations,
+			},
+		}
+	}
+
+	scheduled, ok := scheduleSpanContext(newCluster(map[string]string{
+		"alpha.giantswarm.io/update-schedule-target-release": "15.2.1",
+		"alpha.giantswarm.io/update-schedule-target-time":    "12 Mar 25 12:00 UTC",
+		ClusterUpgradeScheduledAt:                            "2025-03-11T12:00:00Z",
+	}))
+	assert.True(t, ok)
+	assert.True(t, scheduled.IsValid())
+	assert.True(t, scheduled.IsSampled())
+
+	triggered, ok := scheduleSpanContext(newCluster(map[string]string{
+		ClusterUpgradeInProgress: `{"origin":"14.2.2","target":"15.2.1","scheduledAt":"2025-03-12T12:00:00Z","triggeredAt":"2025-03-12T12:00:10Z"}`,
+	}))
+	assert.True(t, ok)
+	assert.Equal(t, scheduled.TraceID(), triggered.TraceID(), "the verification is part of the trace of the schedule")
+
+	rescheduled, ok := scheduleSpanContext(newCluster(map[string]string{
+		"alpha.giantswarm.io/update-schedule-target-release": "15.2.1",
+		"alpha.giantswarm.io/update-schedule-target-time":    "13 Mar 25 12:00 UTC",
+		ClusterUpgradeScheduledAt:                            "2025-03-12T12:00:00Z",
+	}))
+	assert.True(t, ok)
+	assert.NotEqual(t, scheduled.TraceID(), rescheduled.TraceID())
+
+	_, ok = scheduleSpanContext(newCluster(nil))
+	assert.False(t, ok)
+}
+
+func TestReconcileSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	drainEvents()
+
+	upgradeTime := time.Date(2025, 3, 12, 12, 0, 0, 0, time.UTC)
+	cluster := &capi.Cluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "traced",
+			Namespace: "org-giantswarm",
+			Labels: map[string]string{
+				"release.giantswarm.io/version": "14.2.2",
+			},
+			Annotations: map[string]string{
+				"alpha.giantswarm.io/update-schedule-target-release": "15.2.1",
+				"alpha.giantswarm.io/update-schedule-target-time":    "12 Mar 25 12:00 UTC",
+				ClusterUpgradeScheduledAt:                            "2025-03-11T12:00:00Z",
+			},
+		},
+	}
+	fakeClock := clocktesting.NewFakeClock(upgradeTime.Add(-10 * time.Minute))
+	r := &ClusterReconciler{
+		Client: fake.NewClientBuilder().WithScheme(fakeScheme).WithObjects(cluster).Build(),
+		Scheme: fakeScheme,
+		Log:    ctrl.Log.WithName("fake"),
+		Clock:  fakeClock,
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: cluster.GetName(), Namespace: cluster.GetNamespace()}}
+
+	for _, now := range []time.Time{upgradeTime.Add(-10 * time.Minute), upgradeTime.Add(time.Second), upgradeTime.Add(5 * time.Minute)} {
+		fakeClock.SetTime(now)
+		_, err := r.Reconcile(context.TODO(), req)
+		assert.NoError(t, err)
+	}
+	drainEvents()
+
+	names := []string{}
+	for _, span := range recorder.Ended() {
+		names = append(names, span.Name())
+		assert.Equal(t, recorder.Ended()[0].SpanContext().TraceID(), span.SpanContext().TraceID(), span.Name())
+	}
+	assert.Equal(t, []string{
+		"ListReleases", "GetUpgradePolicy", "PatchCluster", "SendAnnouncement", "ReconcileUpgrade", "Reconcile",
+		"ListReleases", "GetUpgradePolicy", "PatchCluster", "PatchCluster", "RecordUpgradeHistory", "ReconcileUpgrade", "Reconcile",
+		"PatchCluster", "RecordUpgradeHistory", "ReconcileVerification", "Reconcile",
+	}, names)
+}
@@ -0,0 +1,284 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/giantswarm/k8smetadata/pkg/annotation"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// UpgradeAuditKey is the key of the audit trail of the schedule in the
+	// history ConfigMap of a cluster.
+	UpgradeAuditKey = "audit.json"
+
+	// ClusterUpgradeChangedBy is set by the audit webhook to the user who
+	// last scheduled, changed, cancelled, triggered or approved the upgrade.
+	ClusterUpgradeChangedBy = "alpha.giantswarm.io/update-schedule-changed-by"
+
+	// DefaultAuditLimit is the default maximum number of audit records kept
+	// per cluster.
+	DefaultAuditLimit = 200
+)
+
+// Actions of the audit records.
+const (
+	AuditActionScheduled = "scheduled"
+	AuditActionChanged   = "changed"
+	AuditActionCancelled = "cancelled"
+	AuditActionTriggered = "triggered"
+	AuditActionApproved  = "approved"
+)
+
+// AuditRecord is an entry of the audit trail of the upgrade schedule of a
+// cluster.
+type AuditRecord struct {
+	Time      string `json:"time"`
+	Cluster   string `json:"cluster"`
+	Namespace string `json:"namespace"`
+	Action    string `json:"action"`
+	// User is the user or service account that made the change.
+	User   string   `json:"user"`
+	Groups []string `json:"groups,omitempty"`
+	// TargetVersion and UpgradeTime are the values of the schedule
+	// annotations after the change.
+	TargetVersion string `json:"targetVersion,omitempty"`
+	UpgradeTime   string `json:"upgradeTime,omitempty"`
+	// PreviousTargetVersion and PreviousUpgradeTime are the values of the
+	// schedule annotations before the change.
+	PreviousTargetVersion string `json:"previousTargetVersion,omitempty"`
+	PreviousUpgradeTime   string `json:"previousUpgradeTime,omitempty"`
+	// ApprovedBy are the identities that approved the upgrade after the
+	// change.
+	ApprovedBy []string `json:"approvedBy,omitempty"`
+	// Attempt is true for the records of the audit webhook, which are
+	// written before the change is persisted and may still be rejected. The
+	// operator records the changes persisted on the cluster without attempt.
+	Attempt bool `json:"attempt,omitempty"`
+}
+
+// AuditSchedule is the audited state of the upgrade schedule of a cluster.
+type AuditSchedule struct {
+	TargetVersion string
+	UpgradeTime   string
+	InProgress    bool
+	ApprovedBy    []string
+}
+
+// AuditScheduleOf returns the state of the upgrade schedule of the cluster.
+func AuditScheduleOf(cluster *clusterv1.Cluster) AuditSchedule {
+	_, inProgress := cluster.Annotations[ClusterUpgradeInProgress]
+	return AuditSchedule{
+		TargetVersion: cluster.Annotations[annotation.UpdateScheduleTargetRelease],
+		UpgradeTime:   cluster.Annotations[annotation.UpdateScheduleTargetTime],
+		InProgress:    inProgress,
+		ApprovedBy:    ParseApprovers(cluster.Annotations[ClusterUpgradeApprovedBy]),
+	}
+}
+
+// Empty returns true if no upgrade is scheduled.
+func (s AuditSchedule) Empty() bool {
+	return s.TargetVersion == "" && s.UpgradeTime == ""
+}
+
+// AddedApprovers returns the approvers of after that are not approvers of
+// before.
+func AddedApprovers(before AuditSchedule, after AuditSchedule) []string {
+	added := []string{}
+	for _, approver := range after.ApprovedBy {
+		if !slices.Contains(before.ApprovedBy, approver) {
+			added = append(added, approver)
+		}
+	}
+	return added
+}
+
+// AuditAction returns the action of a change of the schedule or an empty
+// string if the schedule did not change.
+func AuditAction(before AuditSchedule, after AuditSchedule) string {
+	switch {
+	case after.InProgress && !before.InProgress:
+		return AuditActionTriggered
+	case before.Empty() && !after.Empty():
+		return AuditActionScheduled
+	case !before.Empty() && after.Empty():
+		return AuditActionCancelled
+	case before.TargetVersion != after.TargetVersion || before.UpgradeTime != after.UpgradeTime:
+		return AuditActionChanged
+	case len(AddedApprovers(before, after)) > 0:
+		return AuditActionApproved
+	}
+	return ""
+}
+
+// AuditSink writes audit records as lines of JSON. It is safe for concurrent
+// use.
+type AuditSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewAuditSink returns a sink writing to w.
+func NewAuditSink(w io.Writer) *AuditSink {
+	return &AuditSink{w: w}
+}
+
+// Write writes the record as a line of JSON.
+func (s *AuditSink) Write(record AuditRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return errors.WithStack(json.NewEncoder(s.w).Encode(record))
+}
+
+// ParseUpgradeAudit decodes the audit trail of a history ConfigMap.
+func ParseUpgradeAudit(cm *corev1.ConfigMap) ([]AuditRecord, error) {
+	records := []AuditRecord{}
+	value, ok := cm.Data[UpgradeAuditKey]
+	if !ok || value == "" {
+		return records, nil
+	}
+	if err := json.Unmarshal([]byte(value), &records); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse upgrade audit trail of ConfigMap %s", cm.Name)
+	}
+	return records, nil
+}
+
+// recordedSchedule returns the state of the schedule after the last record
+// of the audit trail.
+func recordedSchedule(records []AuditRecord) AuditSchedule {
+	if len(records) == 0 {
+		return AuditSchedule{}
+	}
+	last := records[len(records)-1]
+	switch last.Action {
+	case AuditActionTriggered:
+		return AuditSchedule{InProgress: true}
+	case AuditActionCancelled:
+		return AuditSchedule{}
+	}
+	return AuditSchedule{
+		TargetVersion: last.TargetVersion,
+		UpgradeTime:   last.UpgradeTime,
+		ApprovedBy:    last.ApprovedBy,
+	}
+}
+
+// changedBy returns the user who made the change of the schedule of the
+// cluster as recorded by the audit webhook.
+func changedBy(cluster *clusterv1.Cluster, action string) string {
+	if user := cluster.Annotations[ClusterUpgradeChangedBy]; user != "" {
+		return user
+	}
+	switch action {
+	case AuditActionTriggered:
+		return FieldManager
+	case AuditActionScheduled, AuditActionChanged:
+		return scheduledBy(cluster)
+	}
+	return ""
+}
+
+// committedAuditRecord returns the record of the change of the schedule of
+// the cluster since the last record of the audit trail. It returns false if
+// the schedule did not change.
+func (r *ClusterReconciler) committedAuditRecord(cluster *clusterv1.Cluster, records []AuditRecord) (AuditRecord, bool) {
+	before, after := recordedSchedule(records), AuditScheduleOf(cluster)
+	action := AuditAction(before, after)
+	if action == "" {
+		return AuditRecord{}, false
+	}
+	return AuditRecord{
+		Time:                  r.now().Format(time.RFC3339),
+		Cluster:               cluster.Name,
+		Namespace:             cluster.Namespace,
+		Action:                action,
+		User:                  changedBy(cluster, action),
+		TargetVersion:         after.TargetVersion,
+		UpgradeTime:           after.UpgradeTime,
+		PreviousTargetVersion: before.TargetVersion,
+		PreviousUpgradeTime:   before.UpgradeTime,
+		ApprovedBy:            after.ApprovedBy,
+	}, true
+}
+
+// reconcileAudit records the change of the schedule of the cluster since the
+// last record of its audit trail in the history ConfigMap and the audit sink.
+// Only changes persisted on the cluster are recorded, several changes between
+// two reconciles are recorded as one. A failure is reported but does not
+// block the upgrade.
+func (r *ClusterReconciler) reconcileAudit(ctx context.Context, cluster *clusterv1.Cluster, log logr.Logger) {
+	if r.AuditSink == nil {
+		return
+	}
+
+	// Read the audit trail from the cache first, so that unchanged schedules
+	// are not written.
+	cm := &corev1.ConfigMap{}
+	err := r.Get(ctx, client.ObjectKey{Name: UpgradeHistoryName(cluster.Name), Namespace: cluster.Namespace}, cm)
+	if err != nil && !apierrors.IsNotFound(err) {
+		r.warnAuditFailed(cluster, err, log)
+		return
+	}
+	records, err := ParseUpgradeAudit(cm)
+	if err != nil {
+		r.warnAuditFailed(cluster, err, log)
+		return
+	}
+	if _, changed := r.committedAuditRecord(cluster, records); !changed {
+		return
+	}
+
+	limit := r.AuditLimit
+	if limit == 0 {
+		limit = DefaultAuditLimit
+	}
+	var record AuditRecord
+	changed := false
+	ctx, span := tracer.Start(ctx, "RecordUpgradeAudit")
+	err = UpdateUpgradeHistory(ctx, r.Client, cluster, func(cm *corev1.ConfigMap) error {
+		records, err := ParseUpgradeAudit(cm)
+		if err != nil {
+			return err
+		}
+		record, changed = r.committedAuditRecord(cluster, records)
+		if !changed {
+			return nil
+		}
+		records = append(records, record)
+		if len(records) > limit {
+			records = records[len(records)-limit:]
+		}
+		value, err := json.Marshal(records)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		cm.Data[UpgradeAuditKey] = string(value)
+		return nil
+	})
+	endSpan(span, err)
+	if err != nil {
+		r.warnAuditFailed(cluster, err, log)
+		return
+	}
+	if changed {
+		if err := r.AuditSink.Write(record); err != nil {
+			log.Error(err, "Failed to write audit record.")
+		}
+	}
+}
+
+// warnAuditFailed reports a failure to record the change of the schedule.
+func (r *ClusterReconciler) warnAuditFailed(cluster *clusterv1.Cluster, err error, log logr.Logger) {
+	log.Error(err, "Failed to record the change of the upgrade schedule.")
+	r.Recorder.Warnf(cluster, ReasonUpgradeHistoryFailed, "The change of the upgrade schedule can not be recorded in ConfigMap %s: %v", UpgradeHistoryName(cluster.Name), err)
+}
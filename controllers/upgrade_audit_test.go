@@ -0,0 +1,155 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clocktesting "k8s.io/utils/clock/testing"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestReconcileAudit(t *testing.T) {
+	scheduled := map[string]string{
+		"alpha.giantswarm.io/update-schedule-target-release": "15.2.1",
+		"alpha.giantswarm.io/update-schedule-target-time":    "12 Mar 25 12:00 UTC",
+		ClusterUpgradeRequestedBy:                            "jane@acme.com",
+		ClusterUpgradeChangedBy:                              "jane@acme.com",
+	}
+	approved := map[string]string{
+		"alpha.giantswarm.io/update-schedule-target-release": "15.2.1",
+		"alpha.giantswarm.io/update-schedule-target-time":    "12 Mar 25 12:00 UTC",
+		ClusterUpgradeRequestedBy:                            "jane@acme.com",
+		ClusterUpgradeApprovedBy:                             "john@acme.com",
+		ClusterUpgradeChangedBy:                              "john@acme.com",
+	}
+	triggered := map[string]string{
+		ClusterUpgradeInProgress: `{"origin":"14.2.2","target":"15.2.1"}`,
+		ClusterUpgradeChangedBy:  "john@acme.com",
+	}
+	rescheduled := map[string]string{
+		"alpha.giantswarm.io/update-schedule-target-release": "16.0.0",
+		"alpha.giantswarm.io/update-schedule-target-time":    "13 Mar 25 12:00 UTC",
+		ClusterUpgradeRequestedBy:                            "jim@acme.com",
+		ClusterUpgradeChangedBy:                              "jim@acme.com",
+	}
+	cancelled := map[string]string{
+		ClusterUpgradeChangedBy: "jane@acme.com",
+	}
+
+	// The steps are reconciled one after the other on the same cluster.
+	testCases := []struct {
+		name           string
+		annotations    map[string]string
+		expectedAction string
+		expectedUser   string
+	}{
+		{
+			name: "case 0: no schedule",
+		},
+		{
+			name:           "case 1: schedule",
+			annotations:    scheduled,
+			expectedAction: AuditActionScheduled,
+			expectedUser:   "jane@acme.com",
+		},
+		{
+			name:        "case 2: unchanged schedule",
+			annotations: scheduled,
+		},
+		{
+			name:           "case 3: approve",
+			annotations:    approved,
+			expectedAction: AuditActionApproved,
+			expectedUser:   "john@acme.com",
+		},
+		{
+			name:           "case 4: trigger",
+			annotations:    triggered,
+			expectedAction: AuditActionTriggered,
+			expectedUser:   "john@acme.com",
+		},
+		{
+			name: "case 5: verified upgrade",
+			annotations: map[string]string{
+				ClusterUpgradeChangedBy: "john@acme.com",
+			},
+		},
+		{
+			name:           "case 6: schedule again",
+			annotations:    rescheduled,
+			expectedAction: AuditActionScheduled,
+			expectedUser:   "jim@acme.com",
+		},
+		{
+			name:           "case 7: cancel",
+			annotations:    cancelled,
+			expectedAction: AuditActionCancelled,
+			expectedUser:   "jane@acme.com",
+		},
+	}
+
+	cluster := &capi.Cluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: "default",
+		},
+	}
+	fakeClient := fake.NewClientBuilder().WithScheme(fakeScheme).WithObjects(cluster).Build()
+	sink := &bytes.Buffer{}
+	r := &ClusterReconciler{
+		Client:    fakeClient,
+		Log:       ctrl.Log.WithName("fake"),
+		Scheme:    fakeScheme,
+		Clock:     clocktesting.NewFakePassiveClock(time.Date(2025, 3, 11, 12, 0, 0, 0, time.UTC)),
+		AuditSink: NewAuditSink(sink),
+	}
+
+	var expected []AuditRecord
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cluster.Annotations = tc.annotations
+			sink.Reset()
+			r.reconcileAudit(context.TODO(), cluster, r.Log)
+			assert.Empty(t, drainEvents())
+
+			cm := &corev1.ConfigMap{}
+			err := fakeClient.Get(context.TODO(), client.ObjectKey{Name: "test-upgrade-history", Namespace: "default"}, cm)
+			if len(expected) == 0 && tc.expectedAction == "" {
+				assert.Error(t, err, "the ConfigMap is not created without changes")
+				return
+			}
+			assert.NoError(t, err)
+			records, err := ParseUpgradeAudit(cm)
+			assert.NoError(t, err)
+
+			if tc.expectedAction == "" {
+				assert.Empty(t, sink.String())
+				assert.Equal(t, expected, records)
+				return
+			}
+
+			assert.Len(t, records, len(expected)+1)
+			record := records[len(records)-1]
+			assert.Equal(t, tc.expectedAction, record.Action)
+			assert.Equal(t, tc.expectedUser, record.User)
+			assert.False(t, record.Attempt)
+			expected = records
+
+			lines := strings.Split(strings.TrimSpace(sink.String()), "\n")
+			assert.Len(t, lines, 1)
+			written := AuditRecord{}
+			assert.NoError(t, json.Unmarshal([]byte(lines[0]), &written))
+			assert.Equal(t, record, written)
+		})
+	}
+}
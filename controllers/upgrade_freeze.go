@@ -0,0 +1,186 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/blang/semver"
+	"github.com/giantswarm/k8smetadata/pkg/annotation"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/giantswarm/upgrade-schedule-operator/api/v1alpha1"
+)
+
+const (
+	ReasonUpgradeFrozen     = "UpgradeFrozen"
+	ReasonUpgradeRetargeted = "UpgradeRetargeted"
+)
+
+// GetActiveFreezes returns the UpgradeFreezes that are not lifted at now
+// sorted by name. There are none if the UpgradeFreeze CRD is not installed.
+func GetActiveFreezes(ctx context.Context, c client.Reader, now time.Time) ([]v1alpha1.UpgradeFreeze, error) {
+	list := &v1alpha1.UpgradeFreezeList{}
+	err := c.List(ctx, list)
+	if meta.IsNoMatchError(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var freezes []v1alpha1.UpgradeFreeze
+	for _, freeze := range list.Items {
+		if freeze.Spec.Until == nil || now.Before(freeze.Spec.Until.Time) {
+			freezes = append(freezes, freeze)
+		}
+	}
+	sort.Slice(freezes, func(i, j int) bool {
+		return freezes[i].Name < freezes[j].Name
+	})
+	return freezes, nil
+}
+
+// FreezeMatches returns true if the freeze applies to the upgrade of the
+// cluster to the target release version.
+func FreezeMatches(freeze v1alpha1.UpgradeFreeze, cluster *clusterv1.Cluster, target semver.Version) (bool, error) {
+	spec := freeze.Spec
+	if len(spec.TargetReleases) > 0 && !slices.ContainsFunc(spec.TargetReleases, func(release string) bool {
+		version, err := ParseTargetVersion(release)
+		return err == nil && version.Equals(target)
+	}) {
+		return false, nil
+	}
+	if len(spec.Providers) > 0 && !slices.Contains(spec.Providers, getClusterProvider(cluster)) {
+		return false, nil
+	}
+	if spec.ClusterSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(spec.ClusterSelector)
+		if err != nil {
+			return false, errors.Wrapf(err, "invalid cluster selector of upgrade freeze %s", freeze.Name)
+		}
+		if !selector.Matches(labels.Set(cluster.Labels)) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// reconcileFreeze retargets upgrades frozen by an UpgradeFreeze with a
+// replacement release and blocks all other frozen upgrades until the freeze
+// is lifted. It returns nil if the upgrade may proceed.
+func (r *ClusterReconciler) reconcileFreeze(ctx context.Context, cluster *clusterv1.Cluster, upgrade ScheduledUpgrade, log logr.Logger) (*ctrl.Result, error) {
+	target, err := ParseTargetVersion(upgrade.TargetVersion)
+	if err != nil {
+		// The target release is validated later on.
+		return nil, nil
+	}
+	freezes, err := GetActiveFreezes(ctx, r.Client, r.now())
+	if err != nil {
+		log.Error(err, "Failed to list the upgrade freezes.")
+		r.trackFailedUpgrade(upgrade, ReasonUpgradeFrozen, err)
+		return &ctrl.Result{}, err
+	}
+	var freeze *v1alpha1.UpgradeFreeze
+	for i := range freezes {
+		matches, err := FreezeMatches(freezes[i], cluster, *target)
+		if err != nil {
+			log.Error(err, "Failed to match the upgrade freeze.")
+			continue
+		}
+		if matches {
+			freeze = &freezes[i]
+			break
+		}
+	}
+	if freeze == nil {
+		return nil, nil
+	}
+
+	if replacement, ok := r.freezeReplacement(cluster, freeze, *target); ok {
+		patched, err := r.patchClusterLocked(ctx, cluster, cluster.DeepCopy(), func(cluster *clusterv1.Cluster) error {
+			cluster.Annotations[annotation.UpdateScheduleTargetRelease] = replacement.String()
+			return nil
+		})
+		if err != nil {
+			log.Error(err, "Failed to retarget the frozen upgrade.")
+			reason := r.warnUpdateFailed(cluster, err, "Failed to retarget the frozen upgrade")
+			r.trackFailedUpgrade(upgrade, reason, err)
+			return &ctrl.Result{}, err
+		}
+		if !patched {
+			log.Info("The schedule changed while the frozen upgrade was retargeted. The change will be reconciled.")
+			return &ctrl.Result{}, nil
+		}
+		log.Info(fmt.Sprintf("Retargeted the frozen upgrade to release version %v.", replacement))
+		r.Recorder.Eventf(cluster, ReasonUpgradeRetargeted, "The upgrade to release version %v scheduled at %v was retargeted to release version %v by upgrade freeze %s%s",
+			target,
+			FormatUpgradeTime(upgrade.Time),
+			replacement,
+			freeze.Name,
+			freezeReason(freeze),
+		)
+		return &ctrl.Result{}, nil
+	}
+
+	log.Info(fmt.Sprintf("The upgrade is blocked by upgrade freeze %s.", freeze.Name))
+	// Only notify once per freeze, the upgrade store remembers the freeze.
+	previous, ok := ScheduledUpgrade{}, false
+	if r.Upgrades != nil {
+		previous, ok = r.Upgrades.Get(r.Installation, client.ObjectKeyFromObject(cluster))
+	}
+	if !ok || previous.Reason != ReasonUpgradeFrozen {
+		r.Recorder.Warnf(cluster, ReasonUpgradeFrozen, "The upgrade to release version %v scheduled at %v is blocked by upgrade freeze %s%s It proceeds once the freeze is lifted.",
+			target,
+			FormatUpgradeTime(upgrade.Time),
+			freeze.Name,
+			freezeReason(freeze),
+		)
+	}
+	upgrade.Reason = ReasonUpgradeFrozen
+	upgrade.Message = fmt.Sprintf("upgrade freeze %s", freeze.Name)
+	r.setUpgradeMetrics(upgrade, metricStateBlocked)
+	if r.Upgrades != nil {
+		r.Upgrades.Set(upgrade)
+	}
+	// Changes of the freezes are watched, only the expiry has to be waited
+	// for.
+	if freeze.Spec.Until != nil {
+		result := r.requeueAt(cluster, ActionFreezeExpiry, freeze.Spec.Until.Time)
+		return &result, nil
+	}
+	return &ctrl.Result{}, nil
+}
+
+// freezeReplacement returns the replacement release of the freeze if the
+// cluster can be upgraded to it.
+func (r *ClusterReconciler) freezeReplacement(cluster *clusterv1.Cluster, freeze *v1alpha1.UpgradeFreeze, target semver.Version) (semver.Version, bool) {
+	if freeze.Spec.ReplacementRelease == "" {
+		return semver.Version{}, false
+	}
+	replacement, err := ParseTargetVersion(freeze.Spec.ReplacementRelease)
+	if err != nil || replacement.Equals(target) {
+		return semver.Version{}, false
+	}
+	currentVersion, err := semver.New(getClusterReleaseVersionLabel(cluster))
+	if err != nil || ValidateTargetVersion(*replacement, *currentVersion) != nil {
+		return semver.Version{}, false
+	}
+	return *replacement, true
+}
+
+// freezeReason returns the end of the event sentences naming the freeze.
+func freezeReason(freeze *v1alpha1.UpgradeFreeze) string {
+	if freeze.Spec.Reason == "" {
+		return "."
+	}
+	return fmt.Sprintf(": %s.", freeze.Spec.Reason)
+}
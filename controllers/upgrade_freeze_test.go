@@ -0,0 +1,224 @@
+package controllers
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blang/semver"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clocktesting "k8s.io/utils/clock/testing"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/giantswarm/upgrade-schedule-operator/api/v1alpha1"
+)
+
+func TestFreezeMatches(t *testing.T) {
+	cluster := &capi.Cluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "freeze",
+			Labels: map[string]string{"topology.kubernetes.io/region": "eu-west-1"},
+		},
+		Spec: capi.ClusterSpec{
+			InfrastructureRef: &corev1.ObjectReference{Kind: "AWSCluster"},
+		},
+	}
+
+	testCases := []struct {
+		name          string
+		spec          v1alpha1.UpgradeFreezeSpec
+		expectedMatch bool
+		expectedErr   bool
+	}{
+		{
+			name:          "case 0: all upgrades",
+			expectedMatch: true,
+		},
+		{
+			name:          "case 1: frozen target release",
+			spec:          v1alpha1.UpgradeFreezeSpec{TargetReleases: []string{"15.2.0", "15.2.1"}},
+			expectedMatch: true,
+		},
+		{
+			name: "case 2: other target release",
+			spec: v1alpha1.UpgradeFreezeSpec{TargetReleases: []string{"15.2.0"}},
+		},
+		{
+			name:          "case 3: frozen provider",
+			spec:          v1alpha1.UpgradeFreezeSpec{Providers: []string{"aws"}},
+			expectedMatch: true,
+		},
+		{
+			name: "case 4: other provider",
+			spec: v1alpha1.UpgradeFreezeSpec{TargetReleases: []string{"15.2.1"}, Providers: []string{"azure"}},
+		},
+		{
+			name:          "case 5: frozen region",
+			spec:          v1alpha1.UpgradeFreezeSpec{ClusterSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"topology.kubernetes.io/region": "eu-west-1"}}},
+			expectedMatch: true,
+		},
+		{
+			name: "case 6: other region",
+			spec: v1alpha1.UpgradeFreezeSpec{ClusterSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"topology.kubernetes.io/region": "us-east-1"}}},
+		},
+		{
+			name: "case 7: invalid selector",
+			spec: v1alpha1.UpgradeFreezeSpec{ClusterSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "topology.kubernetes.io/region", Operator: "Near"},
+			}}},
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			freeze := v1alpha1.UpgradeFreeze{ObjectMeta: metav1.ObjectMeta{Name: "freeze"}, Spec: tc.spec}
+			match, err := FreezeMatches(freeze, cluster, semver.MustParse("15.2.1"))
+			if tc.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedMatch, match)
+		})
+	}
+}
+
+func TestClusterControllerFreeze(t *testing.T) {
+	upgradeTime := time.Date(2025, 3, 12, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name          string
+		freeze        *v1alpha1.UpgradeFreezeSpec
+		alreadyFrozen bool
+		now           time.Time
+
+		expectedState     UpgradeState
+		expectedReason    string
+		expectedTarget    string
+		expectedTriggered bool
+		expectedEvent     string
+	}{
+		{
+			name:           "case 0: no freeze",
+			now:            upgradeTime.Add(-time.Hour),
+			expectedState:  UpgradeStatePending,
+			expectedTarget: "15.2.1",
+		},
+		{
+			name:           "case 1: frozen target release",
+			freeze:         &v1alpha1.UpgradeFreezeSpec{TargetReleases: []string{"15.2.1"}, Reason: "etcd regression"},
+			now:            upgradeTime.Add(-time.Hour),
+			expectedState:  UpgradeStatePending,
+			expectedReason: ReasonUpgradeFrozen,
+			expectedTarget: "15.2.1",
+			expectedEvent:  ReasonUpgradeFrozen,
+		},
+		{
+			name:           "case 2: frozen upgrade is not triggered",
+			freeze:         &v1alpha1.UpgradeFreezeSpec{Providers: []string{"unknown"}},
+			alreadyFrozen:  true,
+			now:            upgradeTime.Add(time.Minute),
+			expectedState:  UpgradeStatePending,
+			expectedReason: ReasonUpgradeFrozen,
+			expectedTarget: "15.2.1",
+		},
+		{
+			name:           "case 3: retarget to the replacement release",
+			freeze:         &v1alpha1.UpgradeFreezeSpec{TargetReleases: []string{"15.2.1"}, ReplacementRelease: "15.2.2"},
+			now:            upgradeTime.Add(-time.Hour),
+			expectedTarget: "15.2.2",
+			expectedEvent:  ReasonUpgradeRetargeted,
+		},
+		{
+			name:           "case 4: replacement release is not an upgrade",
+			freeze:         &v1alpha1.UpgradeFreezeSpec{TargetReleases: []string{"15.2.1"}, ReplacementRelease: "14.2.2"},
+			now:            upgradeTime.Add(-time.Hour),
+			expectedState:  UpgradeStatePending,
+			expectedReason: ReasonUpgradeFrozen,
+			expectedTarget: "15.2.1",
+			expectedEvent:  ReasonUpgradeFrozen,
+		},
+		{
+			name:              "case 5: freeze lifted",
+			freeze:            &v1alpha1.UpgradeFreezeSpec{TargetReleases: []string{"15.2.1"}, Until: &metav1.Time{Time: upgradeTime}},
+			alreadyFrozen:     true,
+			now:               upgradeTime.Add(time.Minute),
+			expectedState:     UpgradeStateInProgress,
+			expectedTarget:    "",
+			expectedTriggered: true,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+			drainEvents()
+
+			cluster := &capi.Cluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "freeze",
+					Namespace: "org-acme",
+					Labels: map[string]string{
+						"release.giantswarm.io/version": "14.2.2",
+					},
+					Annotations: map[string]string{
+						"alpha.giantswarm.io/update-schedule-target-release": "15.2.1",
+						"alpha.giantswarm.io/update-schedule-target-time":    "12 Mar 25 12:00 UTC",
+						ClusterUpgradeScheduledAt:                            "2025-03-11T12:00:00Z",
+						ClusterUpgradeAnnouncement:                           upgradeTime.Add(-15 * time.Minute).Format(time.RFC3339),
+					},
+				},
+			}
+			objects := []client.Object{cluster}
+			if tc.freeze != nil {
+				objects = append(objects, &v1alpha1.UpgradeFreeze{
+					ObjectMeta: metav1.ObjectMeta{Name: "freeze"},
+					Spec:       *tc.freeze,
+				})
+			}
+
+			fakeClock := clocktesting.NewFakeClock(tc.now)
+			fakeClient := fake.NewClientBuilder().WithScheme(fakeScheme).WithObjects(objects...).Build()
+			r := &ClusterReconciler{
+				Client:   fakeClient,
+				Scheme:   fakeScheme,
+				Log:      ctrl.Log.WithName("fake"),
+				Upgrades: NewUpgradeStore(fakeClock),
+				Clock:    fakeClock,
+			}
+			ctx := context.TODO()
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: cluster.GetName(), Namespace: cluster.GetNamespace()}}
+			if tc.alreadyFrozen {
+				r.Upgrades.Set(ScheduledUpgrade{Cluster: "freeze", Namespace: "org-acme", Reason: ReasonUpgradeFrozen})
+			}
+
+			_, err := r.Reconcile(ctx, req)
+			assert.NoError(t, err)
+
+			upgrade, _ := r.Upgrades.Get(r.Installation, req.NamespacedName)
+			assert.Equal(t, tc.expectedState, upgrade.State)
+			assert.Equal(t, tc.expectedReason, upgrade.Reason)
+
+			obj := &capi.Cluster{}
+			assert.NoError(t, fakeClient.Get(ctx, req.NamespacedName, obj))
+			assert.Equal(t, tc.expectedTarget, obj.Annotations["alpha.giantswarm.io/update-schedule-target-release"])
+			_, triggered := obj.Annotations[ClusterUpgradeInProgress]
+			assert.Equal(t, tc.expectedTriggered, triggered)
+
+			event := ""
+			for _, e := range drainEvents() {
+				event = strings.Fields(e)[1]
+			}
+			assert.Equal(t, tc.expectedEvent, event)
+		})
+	}
+}
@@ -0,0 +1,324 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/giantswarm/k8smetadata/pkg/annotation"
+	"github.com/giantswarm/k8smetadata/pkg/label"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// UpgradeHistoryKey is the key of the upgrade history in the history
+	// ConfigMap of a cluster.
+	UpgradeHistoryKey = "history.json"
+
+	// DefaultHistoryRetention is how long upgrade records are kept by
+	// default.
+	DefaultHistoryRetention = 365 * 24 * time.Hour
+	// DefaultHistoryLimit is the default maximum number of upgrade records
+	// kept per cluster.
+	DefaultHistoryLimit = 50
+
+	upgradeHistorySuffix = "-upgrade-history"
+)
+
+// UpgradeRecord is the history entry of a triggered upgrade.
+type UpgradeRecord struct {
+	OriginVersion string `json:"originVersion"`
+	TargetVersion string `json:"targetVersion"`
+	// ScheduledBy is the user or field manager who scheduled the upgrade.
+	ScheduledBy string `json:"scheduledBy,omitempty"`
+	// UpgradeTime is the scheduled upgrade time.
+	UpgradeTime time.Time  `json:"upgradeTime"`
+	AnnouncedAt *time.Time `json:"announcedAt,omitempty"`
+	TriggeredAt time.Time  `json:"triggeredAt"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+	// Outcome is in_progress until the upgrade was verified or failed.
+	Outcome UpgradeState `json:"outcome"`
+	Reason  string       `json:"reason,omitempty"`
+}
+
+// UpgradeHistoryName returns the name of the history ConfigMap of a cluster.
+func UpgradeHistoryName(cluster string) string {
+	return cluster + upgradeHistorySuffix
+}
+
+// ParseUpgradeHistory decodes the history of a history ConfigMap.
+func ParseUpgradeHistory(cm *corev1.ConfigMap) ([]UpgradeRecord, error) {
+	records := []UpgradeRecord{}
+	value, ok := cm.Data[UpgradeHistoryKey]
+	if !ok || value == "" {
+		return records, nil
+	}
+	if err := json.Unmarshal([]byte(value), &records); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse upgrade history of ConfigMap %s", cm.Name)
+	}
+	return records, nil
+}
+
+// addUpgradeRecord adds the record to the history, replacing the record of the
+// same trigger, and returns the history sorted from newest to oldest trigger
+// without the records past retention or limit.
+func addUpgradeRecord(records []UpgradeRecord, record UpgradeRecord, now time.Time, retention time.Duration, limit int) []UpgradeRecord {
+	history := []UpgradeRecord{record}
+	for _, r := range records {
+		if r.TriggeredAt.Equal(record.TriggeredAt) {
+			if record.ScheduledBy == "" {
+				history[0].ScheduledBy = r.ScheduledBy
+			}
+			if record.AnnouncedAt == nil {
+				history[0].AnnouncedAt = r.AnnouncedAt
+			}
+			continue
+		}
+		history = append(history, r)
+	}
+	return pruneUpgradeRecords(history, now, retention, limit)
+}
+
+// pruneUpgradeRecords returns the history sorted from newest to oldest
+// trigger without the records past retention or limit.
+func pruneUpgradeRecords(records []UpgradeRecord, now time.Time, retention time.Duration, limit int) []UpgradeRecord {
+	history := []UpgradeRecord{}
+	for _, r := range records {
+		if now.Sub(r.TriggeredAt) > retention {
+			continue
+		}
+		history = append(history, r)
+	}
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].TriggeredAt.After(history[j].TriggeredAt)
+	})
+	if len(history) > limit {
+		history = history[:limit]
+	}
+	return history
+}
+
+// scheduledBy returns the user who scheduled the upgrade of the cluster as
+// recorded by the audit webhook or, without the webhook, the field manager who
+// last set the upgrade time annotation.
+func scheduledBy(cluster *clusterv1.Cluster) string {
+	if user := cluster.Annotations[ClusterUpgradeRequestedBy]; user != "" {
+		return user
+	}
+	if entry := scheduleFieldsEntry(cluster); entry != nil {
+		return entry.Manager
+	}
+	return ""
+}
+
+// scheduledAt returns when the upgrade time of the cluster was set as
+// recorded in the scheduled at annotation or, without it, by the managed
+// fields of the upgrade time annotation. It returns the zero time if it is not
+// known.
+func scheduledAt(cluster *clusterv1.Cluster) time.Time {
+	if t, err := time.Parse(time.RFC3339, cluster.Annotations[ClusterUpgradeScheduledAt]); err == nil {
+		return t
+	}
+	if entry := scheduleFieldsEntry(cluster); entry != nil && entry.Time != nil {
+		return entry.Time.UTC()
+	}
+	return time.Time{}
+}
+
+// scheduleFieldsEntry returns the latest managed fields entry of the upgrade
+// time annotation.
+func scheduleFieldsEntry(cluster *clusterv1.Cluster) *metav1.ManagedFieldsEntry {
+	field := fmt.Sprintf(`"f:%s"`, annotation.UpdateScheduleTargetTime)
+	var latest *metav1.ManagedFieldsEntry
+	for i, entry := range cluster.ManagedFields {
+		if entry.FieldsV1 == nil || !strings.Contains(string(entry.FieldsV1.Raw), field) {
+			continue
+		}
+		if latest != nil && latest.Time != nil && entry.Time != nil && entry.Time.Time.Before(latest.Time.Time) {
+			continue
+		}
+		latest = &cluster.ManagedFields[i]
+	}
+	return latest
+}
+
+// announcedAt returns the time the upgrade of the cluster was announced, if
+// it is known.
+func announcedAt(cluster *clusterv1.Cluster) *time.Time {
+	t, err := time.Parse(time.RFC3339, cluster.Annotations[ClusterUpgradeAnnouncement])
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// historyBounds returns the retention and the limit of the upgrade history.
+func (r *ClusterReconciler) historyBounds() (time.Duration, int) {
+	retention := r.HistoryRetention
+	if retention == 0 {
+		retention = DefaultHistoryRetention
+	}
+	limit := r.HistoryLimit
+	if limit == 0 {
+		limit = DefaultHistoryLimit
+	}
+	return retention, limit
+}
+
+// recordUpgrade adds the record to the history ConfigMap of the cluster.
+func (r *ClusterReconciler) recordUpgrade(ctx context.Context, cluster *clusterv1.Cluster, record UpgradeRecord) error {
+	retention, limit := r.historyBounds()
+
+	ctx, span := tracer.Start(ctx, "RecordUpgradeHistory")
+	err := UpdateUpgradeHistory(ctx, r.Client, cluster, func(cm *corev1.ConfigMap) error {
+		records, err := ParseUpgradeHistory(cm)
+		if err != nil {
+			return err
+		}
+		value, err := json.Marshal(addUpgradeRecord(records, record, r.now(), retention, limit))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		cm.Data[UpgradeHistoryKey] = string(value)
+		return nil
+	})
+	endSpan(span, err)
+	return err
+}
+
+// UpdateUpgradeHistory applies update to the history ConfigMap of the
+// cluster, creating it if it does not exist yet. The ConfigMap is not owned
+// by the cluster, so the history is kept after the cluster was deleted. The
+// ConfigMap is patched with an optimistic lock and update is applied again to
+// the latest ConfigMap if it was modified or created concurrently.
+func UpdateUpgradeHistory(ctx context.Context, c client.Client, cluster *clusterv1.Cluster, update func(cm *corev1.ConfigMap) error) error {
+	key := client.ObjectKey{Name: UpgradeHistoryName(cluster.Name), Namespace: cluster.Namespace}
+	err := retry.OnError(retry.DefaultRetry, func(err error) bool {
+		return apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err)
+	}, func() error {
+		cm := &corev1.ConfigMap{}
+		err := c.Get(ctx, key, cm)
+		create := apierrors.IsNotFound(err)
+		if err != nil && !create {
+			return err
+		}
+		if create {
+			cm = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      key.Name,
+					Namespace: key.Namespace,
+					Labels: map[string]string{
+						label.Cluster:                  cluster.Name,
+						"app.kubernetes.io/managed-by": "upgrade-schedule-operator",
+					},
+				},
+			}
+		}
+		base := cm.DeepCopy()
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+
+		if err := update(cm); err != nil {
+			return err
+		}
+
+		if create {
+			return c.Create(ctx, cm, client.FieldOwner(FieldManager))
+		}
+		return c.Patch(ctx, cm, client.MergeFromWithOptions(base, client.MergeFromWithOptimisticLock{}), client.FieldOwner(FieldManager))
+	})
+	return errors.WithStack(err)
+}
+
+// pruneUpgradeHistory removes the records past retention or limit from the
+// history ConfigMap of a deleted cluster, which are otherwise only removed
+// when an upgrade is recorded, and deletes the ConfigMap once all its records
+// expired. It requeues the deleted cluster when the next record expires.
+func (r *ClusterReconciler) pruneUpgradeHistory(ctx context.Context, key client.ObjectKey) (ctrl.Result, error) {
+	retention, limit := r.historyBounds()
+	now := r.now()
+
+	reader := r.APIReader
+	if reader == nil {
+		reader = r.Client
+	}
+	if err := reader.Get(ctx, key, &clusterv1.Cluster{}); !apierrors.IsNotFound(err) {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	cm := &corev1.ConfigMap{}
+	err := r.tracedGet(ctx, "GetUpgradeHistory", client.ObjectKey{Name: UpgradeHistoryName(key.Name), Namespace: key.Namespace}, cm)
+	if apierrors.IsNotFound(err) {
+		return ctrl.Result{}, nil
+	} else if err != nil {
+		return ctrl.Result{}, err
+	}
+	records, err := ParseUpgradeHistory(cm)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	audit, err := ParseUpgradeAudit(cm)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	history := pruneUpgradeRecords(records, now, retention, limit)
+	trail := slices.DeleteFunc(slices.Clone(audit), func(record AuditRecord) bool {
+		t, err := time.Parse(time.RFC3339, record.Time)
+		return err == nil && now.Sub(t) > retention
+	})
+	if len(history) == 0 && len(trail) == 0 {
+		err := r.Delete(ctx, cm, client.Preconditions{ResourceVersion: &cm.ResourceVersion})
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	base := cm.DeepCopy()
+	if len(history) < len(records) {
+		value, err := json.Marshal(history)
+		if err != nil {
+			return ctrl.Result{}, errors.WithStack(err)
+		}
+		cm.Data[UpgradeHistoryKey] = string(value)
+	}
+	if len(trail) < len(audit) {
+		value, err := json.Marshal(trail)
+		if err != nil {
+			return ctrl.Result{}, errors.WithStack(err)
+		}
+		cm.Data[UpgradeAuditKey] = string(value)
+	}
+	if len(history) < len(records) || len(trail) < len(audit) {
+		err := r.tracedPatch(ctx, "PatchUpgradeHistory", cm, client.MergeFromWithOptions(base, client.MergeFromWithOptimisticLock{}))
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// The oldest record expires first.
+	var expiry time.Time
+	if len(history) > 0 {
+		expiry = history[len(history)-1].TriggeredAt.Add(retention)
+	}
+	for _, record := range trail {
+		t, err := time.Parse(time.RFC3339, record.Time)
+		if err == nil && (expiry.IsZero() || t.Add(retention).Before(expiry)) {
+			expiry = t.Add(retention)
+		}
+	}
+	if expiry.IsZero() {
+		return ctrl.Result{}, nil
+	}
+	return r.requeueKeyAt(key, ActionHistoryExpiry, expiry), nil
+}
@@ -0,0 +1,261 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clocktesting "k8s.io/utils/clock/testing"
+	"k8s.io/utils/ptr"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestAddUpgradeRecord(t *testing.T) {
+	now := time.Date(2025, 3, 12, 12, 0, 0, 0, time.UTC)
+	announced := now.Add(-15 * time.Minute)
+	completed := now.Add(30 * time.Minute)
+	triggered := func(ago time.Duration) UpgradeRecord {
+		return UpgradeRecord{TriggeredAt: now.Add(-ago), Outcome: UpgradeStateCompleted}
+	}
+
+	testCases := []struct {
+		name      string
+		records   []UpgradeRecord
+		record    UpgradeRecord
+		limit     int
+		retention time.Duration
+		expected  []UpgradeRecord
+	}{
+		{
+			name:      "case 0: add to empty history",
+			record:    triggered(0),
+			limit:     10,
+			retention: time.Hour,
+			expected:  []UpgradeRecord{triggered(0)},
+		},
+		{
+			name:      "case 1: newest first",
+			records:   []UpgradeRecord{triggered(time.Minute)},
+			record:    triggered(0),
+			limit:     10,
+			retention: time.Hour,
+			expected:  []UpgradeRecord{triggered(0), triggered(time.Minute)},
+		},
+		{
+			name:      "case 2: drop records past retention",
+			records:   []UpgradeRecord{triggered(time.Minute), triggered(2 * time.Hour)},
+			record:    triggered(0),
+			limit:     10,
+			retention: time.Hour,
+			expected:  []UpgradeRecord{triggered(0), triggered(time.Minute)},
+		},
+		{
+			name:      "case 3: drop records over limit",
+			records:   []UpgradeRecord{triggered(time.Minute), triggered(2 * time.Minute)},
+			record:    triggered(0),
+			limit:     2,
+			retention: time.Hour,
+			expected:  []UpgradeRecord{triggered(0), triggered(time.Minute)},
+		},
+		{
+			name: "case 4: complete record of the same trigger",
+			records: []UpgradeRecord{{
+				TriggeredAt: now,
+				ScheduledBy: "kubectl-upgrade-schedule",
+				AnnouncedAt: &announced,
+				Outcome:     UpgradeStateInProgress,
+			}},
+			record: UpgradeRecord{
+				TriggeredAt: now,
+				CompletedAt: &completed,
+				Outcome:     UpgradeStateCompleted,
+			},
+			limit:     10,
+			retention: time.Hour,
+			expected: []UpgradeRecord{{
+				TriggeredAt: now,
+				ScheduledBy: "kubectl-upgrade-schedule",
+				AnnouncedAt: &announced,
+				CompletedAt: &completed,
+				Outcome:     UpgradeStateCompleted,
+			}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, addUpgradeRecord(tc.records, tc.record, now, tc.retention, tc.limit))
+		})
+	}
+}
+
+func TestScheduledBy(t *testing.T) {
+	earlier := metav1.NewTime(time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC))
+	later := metav1.NewTime(time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC))
+	fields := &metav1.FieldsV1{Raw: []byte(`{"f:metadata":{"f:annotations":{"f:alpha.giantswarm.io/update-schedule-target-time":{}}}}`)}
+	cluster := &capi.Cluster{
+		ObjectMeta: metav1.ObjectMeta{
+			ManagedFields: []metav1.ManagedFieldsEntry{
+				{Manager: "kubectl-upgrade-schedule", Time: &later, FieldsV1: fields},
+				{Manager: "kubectl-edit", Time: &earlier, FieldsV1: fields},
+				{Manager: "cluster-operator", Time: &later, FieldsV1: &metav1.FieldsV1{Raw: []byte(`{"f:metadata":{"f:labels":{}}}`)}},
+			},
+		},
+	}
+
+	assert.Equal(t, "kubectl-upgrade-schedule", scheduledBy(cluster))
+	assert.Equal(t, "", scheduledBy(&capi.Cluster{}))
+}
+
+func TestScheduledAt(t *testing.T) {
+	later := time.Date(2025, 3, 5, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name          string
+		value         *string
+		managedFields bool
+		expected      time.Time
+	}{
+		{
+			name:          "case 0: scheduled at annotation",
+			value:         ptr.To("2025-03-02T10:30:00Z"),
+			managedFields: true,
+			expected:      time.Date(2025, 3, 2, 10, 30, 0, 0, time.UTC),
+		},
+		{
+			name:          "case 1: managed fields without annotation",
+			managedFields: true,
+			expected:      later,
+		},
+		{
+			name:          "case 2: managed fields with invalid annotation",
+			value:         ptr.To("02 Mar 25 10:30 UTC"),
+			managedFields: true,
+			expected:      later,
+		},
+		{
+			name: "case 3: unknown",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cluster := &capi.Cluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{},
+				},
+			}
+			if tc.managedFields {
+				cluster.ManagedFields = []metav1.ManagedFieldsEntry{
+					{Manager: "kubectl-edit", Time: ptr.To(metav1.NewTime(later)), FieldsV1: &metav1.FieldsV1{Raw: []byte(`{"f:metadata":{"f:annotations":{"f:alpha.giantswarm.io/update-schedule-target-time":{}}}}`)}},
+				}
+			}
+			if tc.value != nil {
+				cluster.Annotations[ClusterUpgradeScheduledAt] = *tc.value
+			}
+			assert.Equal(t, tc.expected, scheduledAt(cluster))
+		})
+	}
+}
+
+func TestPruneUpgradeHistory(t *testing.T) {
+	now := time.Date(2025, 3, 12, 12, 0, 0, 0, time.UTC)
+	history := func(triggered ...time.Duration) string {
+		records := []UpgradeRecord{}
+		for _, ago := range triggered {
+			records = append(records, UpgradeRecord{TriggeredAt: now.Add(-ago), Outcome: UpgradeStateCompleted})
+		}
+		value, _ := json.Marshal(records)
+		return string(value)
+	}
+	audit := func(ago time.Duration) string {
+		value, _ := json.Marshal([]AuditRecord{{Time: now.Add(-ago).Format(time.RFC3339), Action: AuditActionScheduled}})
+		return string(value)
+	}
+
+	testCases := []struct {
+		name    string
+		cluster bool
+		data    map[string]string
+
+		expectedDeleted bool
+		expectedHistory string
+		expectedAudit   string
+		expectedRequeue time.Duration
+	}{
+		{
+			name:            "case 0: all records expired",
+			data:            map[string]string{UpgradeHistoryKey: history(3 * time.Hour), UpgradeAuditKey: audit(3 * time.Hour)},
+			expectedDeleted: true,
+		},
+		{
+			name:            "case 1: expired records removed",
+			data:            map[string]string{UpgradeHistoryKey: history(time.Hour, 3*time.Hour), UpgradeAuditKey: audit(3 * time.Hour)},
+			expectedHistory: history(time.Hour),
+			expectedAudit:   "[]",
+			expectedRequeue: time.Hour + time.Second,
+		},
+		{
+			name:            "case 2: audit trail expires first",
+			data:            map[string]string{UpgradeHistoryKey: history(time.Minute), UpgradeAuditKey: audit(time.Hour)},
+			expectedHistory: history(time.Minute),
+			expectedAudit:   audit(time.Hour),
+			expectedRequeue: time.Hour + time.Second,
+		},
+		{
+			name:            "case 3: history of an existing cluster kept",
+			cluster:         true,
+			data:            map[string]string{UpgradeHistoryKey: history(3 * time.Hour)},
+			expectedHistory: history(3 * time.Hour),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cm := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: UpgradeHistoryName("dh82p"), Namespace: "org-acme"},
+				Data:       tc.data,
+			}
+			objects := []client.Object{cm}
+			if tc.cluster {
+				objects = append(objects, &capi.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "dh82p", Namespace: "org-acme"}})
+			}
+			fakeClient := fake.NewClientBuilder().WithScheme(fakeScheme).WithObjects(objects...).Build()
+			r := &ClusterReconciler{
+				Client:           fakeClient,
+				Log:              ctrl.Log.WithName("fake"),
+				Clock:            clocktesting.NewFakeClock(now),
+				HistoryRetention: 2 * time.Hour,
+			}
+			ctx := context.TODO()
+
+			result, err := r.pruneUpgradeHistory(ctx, client.ObjectKey{Name: "dh82p", Namespace: "org-acme"})
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedRequeue, result.RequeueAfter)
+
+			obj := &corev1.ConfigMap{}
+			err = fakeClient.Get(ctx, client.ObjectKeyFromObject(cm), obj)
+			if tc.expectedDeleted {
+				assert.True(t, apierrors.IsNotFound(err))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedHistory, obj.Data[UpgradeHistoryKey])
+			assert.Equal(t, tc.expectedAudit, obj.Data[UpgradeAuditKey])
+		})
+	}
+
+	// A missing history is nothing to prune.
+	r := &ClusterReconciler{Client: fake.NewClientBuilder().WithScheme(fakeScheme).Build(), Clock: clocktesting.NewFakeClock(now)}
+	result, err := r.pruneUpgradeHistory(context.TODO(), client.ObjectKey{Name: "dh82p", Namespace: "org-acme"})
+	assert.NoError(t, err)
+	assert.Equal(t, ctrl.Result{}, result)
+}
@@ -0,0 +1,214 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/giantswarm/upgrade-schedule-operator/api/v1alpha1"
+)
+
+// EffectivePolicy is the upgrade policy of the clusters in a namespace. It
+// combines all UpgradePolicies of the namespace, an upgrade has to satisfy
+// every one of them. Without UpgradePolicy the default policy applies.
+type EffectivePolicy struct {
+	Policies []v1alpha1.UpgradePolicy
+	// AnnouncementOffset is the announcement offset of the operator the
+	// minimum notice is derived from. The offset of the current settings is
+	// used if it is zero.
+	AnnouncementOffset time.Duration
+}
+
+// GetEffectivePolicy returns the effective upgrade policy of the namespace.
+// The default policy applies if the UpgradePolicy CRD is not installed.
+func GetEffectivePolicy(ctx context.Context, c client.Reader, namespace string) (EffectivePolicy, error) {
+	list := &v1alpha1.UpgradePolicyList{}
+	err := c.List(ctx, list, client.InNamespace(namespace))
+	if meta.IsNoMatchError(err) {
+		return EffectivePolicy{}, nil
+	}
+	if err != nil {
+		return EffectivePolicy{}, errors.WithStack(err)
+	}
+	sort.Slice(list.Items, func(i, j int) bool {
+		return list.Items[i].Name < list.Items[j].Name
+	})
+	return EffectivePolicy{Policies: list.Items}, nil
+}
+
+// Validate returns an error listing all violations of the policy by an
+// upgrade to upgradeTime making the version bump, scheduled at scheduledAt.
+// Notice and horizon are not checked if scheduledAt is zero and the bump is
+// not checked if it is empty.
+func (p EffectivePolicy) Validate(upgradeTime time.Time, scheduledAt time.Time, bump string) error {
+	if len(p.Policies) == 0 {
+		return joinViolations(validatePolicySpec(v1alpha1.UpgradePolicySpec{}, upgradeTime, scheduledAt, bump, p.minimumUpgradeNotice()))
+	}
+	var violations []string
+	for _, policy := range p.Policies {
+		for _, v := range validatePolicySpec(policy.Spec, upgradeTime, scheduledAt, bump, p.minimumUpgradeNotice()) {
+			violations = append(violations, fmt.Sprintf("upgrade policy %s: %s", policy.Name, v))
+		}
+	}
+	return joinViolations(violations)
+}
+
+// RequiredApprovals returns the number of approvals required for upgrades of
+// production clusters.
+func (p EffectivePolicy) RequiredApprovals() int {
+	required := -1
+	for _, policy := range p.Policies {
+		if policy.Spec.RequiredApprovals != nil && int(*policy.Spec.RequiredApprovals) > required {
+			required = int(*policy.Spec.RequiredApprovals)
+		}
+	}
+	if required < 0 {
+		return DefaultRequiredApprovals
+	}
+	return required
+}
+
+// MaxConcurrentUpgrades returns the maximum number of clusters upgraded at
+// the same time or 0 if it is not limited.
+func (p EffectivePolicy) MaxConcurrentUpgrades() int {
+	limit := 0
+	for _, policy := range p.Policies {
+		if policy.Spec.MaxConcurrentUpgrades != nil && (limit == 0 || int(*policy.Spec.MaxConcurrentUpgrades) < limit) {
+			limit = int(*policy.Spec.MaxConcurrentUpgrades)
+		}
+	}
+	return limit
+}
+
+// EndOfLifeUpgrades returns true if a policy allows upgrades of clusters
+// running an end of life release and no policy forbids them.
+func (p EffectivePolicy) EndOfLifeUpgrades() bool {
+	allowed := false
+	for _, policy := range p.Policies {
+		if policy.Spec.EndOfLifeUpgrades != nil {
+			if !*policy.Spec.EndOfLifeUpgrades {
+				return false
+			}
+			allowed = true
+		}
+	}
+	return allowed
+}
+
+// MinimumNotice returns the minimum time between scheduling an upgrade and
+// the upgrade time.
+func (p EffectivePolicy) MinimumNotice() time.Duration {
+	notice := p.minimumUpgradeNotice()
+	for _, policy := range p.Policies {
+		if policy.Spec.MinimumNotice != nil && policy.Spec.MinimumNotice.Duration > notice {
+			notice = policy.Spec.MinimumNotice.Duration
+		}
+	}
+	return notice
+}
+
+// minimumUpgradeNotice returns the minimum notice of upgrades ensuring they
+// can be announced.
+func (p EffectivePolicy) minimumUpgradeNotice() time.Duration {
+	if p.AnnouncementOffset > 0 {
+		return p.AnnouncementOffset + time.Minute
+	}
+	return MinimumUpgradeNotice()
+}
+
+// NextMaintenanceWindow returns the first full hour at or after earliest that
+// is on an allowed day and within the allowed hours of every policy. It
+// returns false if there is none within a week.
+func (p EffectivePolicy) NextMaintenanceWindow(earliest time.Time) (time.Time, bool) {
+	t := earliest.UTC().Truncate(time.Hour)
+	if t.Before(earliest) {
+		t = t.Add(time.Hour)
+	}
+	for end := t.AddDate(0, 0, 7); !t.After(end); t = t.Add(time.Hour) {
+		allowed := true
+		for _, policy := range p.Policies {
+			if !allowedDay(policy.Spec, t) || !allowedHour(policy.Spec, t) {
+				allowed = false
+				break
+			}
+		}
+		if allowed {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func validatePolicySpec(spec v1alpha1.UpgradePolicySpec, upgradeTime time.Time, scheduledAt time.Time, bump string, notice time.Duration) []string {
+	var violations []string
+	upgradeTime = upgradeTime.UTC()
+
+	if !scheduledAt.IsZero() {
+		if spec.MinimumNotice != nil && spec.MinimumNotice.Duration > notice {
+			notice = spec.MinimumNotice.Duration
+		}
+		if upgradeTime.Before(scheduledAt.Add(notice)) {
+			violations = append(violations, fmt.Sprintf("upgrade time %s has to be at least %v in the future", FormatUpgradeTime(upgradeTime), notice))
+		}
+
+		if spec.MaximumHorizon != nil {
+			if upgradeTime.After(scheduledAt.Add(spec.MaximumHorizon.Duration)) {
+				violations = append(violations, fmt.Sprintf("upgrade time %s must not be more than %v in the future", FormatUpgradeTime(upgradeTime), spec.MaximumHorizon.Duration))
+			}
+		} else if upgradeTime.After(scheduledAt.AddDate(0, maximumUpgradeHorizonMonths, 0)) {
+			violations = append(violations, fmt.Sprintf("upgrade time %s must not be more than %d months in the future", FormatUpgradeTime(upgradeTime), maximumUpgradeHorizonMonths))
+		}
+	}
+
+	if !allowedDay(spec, upgradeTime) {
+		violations = append(violations, fmt.Sprintf("upgrade time %s is on a %s, upgrades are allowed on %s", FormatUpgradeTime(upgradeTime), upgradeTime.Weekday(), joinValues(spec.AllowedDays)))
+	}
+	if !allowedHour(spec, upgradeTime) {
+		violations = append(violations, fmt.Sprintf("upgrade time %s is outside of the allowed hours %02d:00 to %02d:00 UTC", FormatUpgradeTime(upgradeTime), spec.AllowedHours.Start, spec.AllowedHours.End))
+	}
+	if bump != "" && len(spec.AllowedBumps) > 0 && !slices.Contains(spec.AllowedBumps, v1alpha1.VersionBump(bump)) {
+		violations = append(violations, fmt.Sprintf("%s upgrades are not allowed, allowed are %s upgrades", bump, joinValues(spec.AllowedBumps)))
+	}
+	return violations
+}
+
+// allowedDay returns true if the policy allows upgrades on the day of t.
+func allowedDay(spec v1alpha1.UpgradePolicySpec, t time.Time) bool {
+	return len(spec.AllowedDays) == 0 || slices.Contains(spec.AllowedDays, v1alpha1.Weekday(t.UTC().Weekday().String()))
+}
+
+// allowedHour returns true if the policy allows upgrades in the hour of t.
+func allowedHour(spec v1alpha1.UpgradePolicySpec, t time.Time) bool {
+	return spec.AllowedHours == nil || inHourWindow(*spec.AllowedHours, t.UTC().Hour())
+}
+
+// inHourWindow returns true if the hour of the day is within the window.
+func inHourWindow(w v1alpha1.HourWindow, hour int) bool {
+	start, end := int(w.Start), int(w.End)
+	if start < end {
+		return hour >= start && hour < end
+	}
+	return hour >= start || hour < end
+}
+
+func joinValues[T ~string](values []T) string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = string(v)
+	}
+	return strings.Join(s, ", ")
+}
+
+func joinViolations(violations []string) error {
+	if len(violations) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(violations, "; "))
+}
@@ -0,0 +1,176 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	"github.com/giantswarm/upgrade-schedule-operator/api/v1alpha1"
+)
+
+func TestEffectivePolicyValidate(t *testing.T) {
+	// Wednesday.
+	upgradeTime := time.Date(2025, 3, 12, 12, 0, 0, 0, time.UTC)
+
+	policy := func(spec v1alpha1.UpgradePolicySpec) []v1alpha1.UpgradePolicy {
+		return []v1alpha1.UpgradePolicy{{ObjectMeta: metav1.ObjectMeta{Name: "acme"}, Spec: spec}}
+	}
+
+	testCases := []struct {
+		name        string
+		policies    []v1alpha1.UpgradePolicy
+		scheduledAt time.Time
+		bump        string
+		expectedErr string
+	}{
+		{
+			name:        "case 0: default policy",
+			scheduledAt: upgradeTime.Add(-24 * time.Hour),
+		},
+		{
+			name:        "case 1: default minimum notice",
+			scheduledAt: upgradeTime.Add(-10 * time.Minute),
+			expectedErr: "upgrade time 12 Mar 25 12:00 UTC has to be at least 16m0s in the future",
+		},
+		{
+			name:        "case 2: default maximum horizon",
+			scheduledAt: upgradeTime.AddDate(0, -7, 0),
+			expectedErr: "must not be more than 6 months in the future",
+		},
+		{
+			name:        "case 3: unknown scheduling time",
+			scheduledAt: time.Time{},
+		},
+		{
+			name:        "case 4: minimum notice of the policy",
+			policies:    policy(v1alpha1.UpgradePolicySpec{MinimumNotice: &metav1.Duration{Duration: 72 * time.Hour}}),
+			scheduledAt: upgradeTime.Add(-48 * time.Hour),
+			expectedErr: "upgrade policy acme: upgrade time 12 Mar 25 12:00 UTC has to be at least 72h0m0s in the future",
+		},
+		{
+			name:        "case 5: minimum notice below the default",
+			policies:    policy(v1alpha1.UpgradePolicySpec{MinimumNotice: &metav1.Duration{Duration: time.Minute}}),
+			scheduledAt: upgradeTime.Add(-10 * time.Minute),
+			expectedErr: "has to be at least 16m0s in the future",
+		},
+		{
+			name:        "case 6: maximum horizon of the policy",
+			policies:    policy(v1alpha1.UpgradePolicySpec{MaximumHorizon: &metav1.Duration{Duration: 24 * time.Hour}}),
+			scheduledAt: upgradeTime.Add(-48 * time.Hour),
+			expectedErr: "must not be more than 24h0m0s in the future",
+		},
+		{
+			name:        "case 7: maximum horizon beyond the default",
+			policies:    policy(v1alpha1.UpgradePolicySpec{MaximumHorizon: &metav1.Duration{Duration: 365 * 24 * time.Hour}}),
+			scheduledAt: upgradeTime.AddDate(0, -7, 0),
+		},
+		{
+			name:        "case 8: allowed day",
+			policies:    policy(v1alpha1.UpgradePolicySpec{AllowedDays: []v1alpha1.Weekday{"Tuesday", "Wednesday"}}),
+			scheduledAt: upgradeTime.Add(-24 * time.Hour),
+		},
+		{
+			name:        "case 9: not allowed day",
+			policies:    policy(v1alpha1.UpgradePolicySpec{AllowedDays: []v1alpha1.Weekday{"Monday", "Tuesday"}}),
+			scheduledAt: upgradeTime.Add(-24 * time.Hour),
+			expectedErr: "upgrade time 12 Mar 25 12:00 UTC is on a Wednesday, upgrades are allowed on Monday, Tuesday",
+		},
+		{
+			name:        "case 10: allowed hours",
+			policies:    policy(v1alpha1.UpgradePolicySpec{AllowedHours: &v1alpha1.HourWindow{Start: 8, End: 16}}),
+			scheduledAt: upgradeTime.Add(-24 * time.Hour),
+		},
+		{
+			name:        "case 11: outside of allowed hours",
+			policies:    policy(v1alpha1.UpgradePolicySpec{AllowedHours: &v1alpha1.HourWindow{Start: 6, End: 12}}),
+			scheduledAt: upgradeTime.Add(-24 * time.Hour),
+			expectedErr: "outside of the allowed hours 06:00 to 12:00 UTC",
+		},
+		{
+			name:        "case 12: allowed hours spanning midnight",
+			policies:    policy(v1alpha1.UpgradePolicySpec{AllowedHours: &v1alpha1.HourWindow{Start: 22, End: 4}}),
+			scheduledAt: upgradeTime.Add(-24 * time.Hour),
+			expectedErr: "outside of the allowed hours 22:00 to 04:00 UTC",
+		},
+		{
+			name:        "case 13: not allowed bump",
+			policies:    policy(v1alpha1.UpgradePolicySpec{AllowedBumps: []v1alpha1.VersionBump{"minor", "patch"}}),
+			scheduledAt: upgradeTime.Add(-24 * time.Hour),
+			bump:        "major",
+			expectedErr: "major upgrades are not allowed, allowed are minor, patch upgrades",
+		},
+		{
+			name:        "case 14: unknown bump",
+			policies:    policy(v1alpha1.UpgradePolicySpec{AllowedBumps: []v1alpha1.VersionBump{"patch"}}),
+			scheduledAt: upgradeTime.Add(-24 * time.Hour),
+		},
+		{
+			name: "case 15: all policies apply",
+			policies: []v1alpha1.UpgradePolicy{
+				{ObjectMeta: metav1.ObjectMeta{Name: "days"}, Spec: v1alpha1.UpgradePolicySpec{AllowedDays: []v1alpha1.Weekday{"Monday"}}},
+				{ObjectMeta: metav1.ObjectMeta{Name: "bumps"}, Spec: v1alpha1.UpgradePolicySpec{AllowedBumps: []v1alpha1.VersionBump{"patch"}}},
+			},
+			scheduledAt: upgradeTime.Add(-24 * time.Hour),
+			bump:        "minor",
+			expectedErr: "upgrade policy days: upgrade time 12 Mar 25 12:00 UTC is on a Wednesday, upgrades are allowed on Monday; upgrade policy bumps: minor upgrades are not allowed, allowed are patch upgrades",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := EffectivePolicy{Policies: tc.policies}.Validate(upgradeTime, tc.scheduledAt, tc.bump)
+			if tc.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestEffectivePolicyLimits(t *testing.T) {
+	testCases := []struct {
+		name                string
+		specs               []v1alpha1.UpgradePolicySpec
+		expectedApprovals   int
+		expectedConcurrency int
+	}{
+		{
+			name:                "case 0: default policy",
+			expectedApprovals:   DefaultRequiredApprovals,
+			expectedConcurrency: 0,
+		},
+		{
+			name: "case 1: single policy",
+			specs: []v1alpha1.UpgradePolicySpec{
+				{RequiredApprovals: ptr.To[int32](0), MaxConcurrentUpgrades: ptr.To[int32](3)},
+			},
+			expectedApprovals:   0,
+			expectedConcurrency: 3,
+		},
+		{
+			name: "case 2: strictest policy",
+			specs: []v1alpha1.UpgradePolicySpec{
+				{RequiredApprovals: ptr.To[int32](2), MaxConcurrentUpgrades: ptr.To[int32](3)},
+				{RequiredApprovals: ptr.To[int32](1)},
+				{MaxConcurrentUpgrades: ptr.To[int32](1)},
+			},
+			expectedApprovals:   2,
+			expectedConcurrency: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			policy := EffectivePolicy{}
+			for _, spec := range tc.specs {
+				policy.Policies = append(policy.Policies, v1alpha1.UpgradePolicy{Spec: spec})
+			}
+			assert.Equal(t, tc.expectedApprovals, policy.RequiredApprovals())
+			assert.Equal(t, tc.expectedConcurrency, policy.MaxConcurrentUpgrades())
+		})
+	}
+}
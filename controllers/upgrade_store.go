@@ -0,0 +1,160 @@
+package controllers
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/clock"
+)
+
+const (
+	// UpgradeWindowDuration is the time span reserved for a scheduled
+	// upgrade starting at the upgrade time.
+	UpgradeWindowDuration = time.Hour
+
+	// completedUpgradeRetention is how long completed upgrades are kept in
+	// the UpgradeStore after they have been applied.
+	completedUpgradeRetention = 24 * time.Hour
+)
+
+// UpgradeState is the state of a scheduled upgrade.
+type UpgradeState string
+
+const (
+	UpgradeStatePending UpgradeState = "pending"
+	// UpgradeStatePendingApproval is the state of upgrades of production
+	// clusters that have not been approved yet.
+	UpgradeStatePendingApproval UpgradeState = "pending_approval"
+	UpgradeStateInProgress      UpgradeState = "in_progress"
+	UpgradeStateFailed          UpgradeState = "failed"
+	UpgradeStateCompleted       UpgradeState = "completed"
+)
+
+// ScheduledUpgrade describes the upgrade scheduled for a single cluster as
+// computed by the reconciler.
+type ScheduledUpgrade struct {
+	// Installation is the name of the management cluster of the cluster.
+	Installation  string
+	Cluster       string
+	Namespace     string
+	Organization  string
+	OriginVersion string
+	TargetVersion string
+	Time          time.Time
+	Announced     bool
+
+	State UpgradeState
+	// Reason is the reason of the last Warning event if the upgrade failed.
+	Reason string
+	// Message describes the failure if the upgrade failed.
+	Message     string
+	CompletedAt time.Time
+}
+
+func (u ScheduledUpgrade) key() clusterKey {
+	return clusterKey{Installation: u.Installation, NamespacedName: types.NamespacedName{Name: u.Cluster, Namespace: u.Namespace}}
+}
+
+// AnnouncementTime returns the time the upgrade is announced at.
+func (u ScheduledUpgrade) AnnouncementTime() time.Time {
+	return UpgradeAnnouncementTime(u.Time)
+}
+
+// WindowEnd returns the end of the time span reserved for the upgrade.
+func (u ScheduledUpgrade) WindowEnd() time.Time {
+	return u.Time.Add(UpgradeWindowDuration)
+}
+
+// UpgradeStore keeps the scheduled upgrades of all reconciled clusters in
+// memory so they can be served by other components of the operator.
+type UpgradeStore struct {
+	clock    clock.PassiveClock
+	mutex    sync.RWMutex
+	upgrades map[clusterKey]ScheduledUpgrade
+}
+
+// NewUpgradeStore creates an UpgradeStore expiring completed upgrades
+// according to the given clock.
+func NewUpgradeStore(clock clock.PassiveClock) *UpgradeStore {
+	return &UpgradeStore{
+		clock:    clock,
+		upgrades: map[clusterKey]ScheduledUpgrade{},
+	}
+}
+
+// Set adds or replaces the scheduled upgrade of a cluster.
+func (s *UpgradeStore) Set(upgrade ScheduledUpgrade) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.upgrades[upgrade.key()] = upgrade
+}
+
+// Get returns the scheduled upgrade of a cluster of the installation.
+func (s *UpgradeStore) Get(installation string, cluster types.NamespacedName) (ScheduledUpgrade, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	upgrade, ok := s.upgrades[clusterKey{Installation: installation, NamespacedName: cluster}]
+	return upgrade, ok
+}
+
+// Delete removes the scheduled upgrade of a cluster of the installation.
+func (s *UpgradeStore) Delete(installation string, cluster types.NamespacedName) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.upgrades, clusterKey{Installation: installation, NamespacedName: cluster})
+}
+
+// DeleteInstallation removes the upgrades of all clusters of the
+// installation.
+func (s *UpgradeStore) DeleteInstallation(installation string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for key := range s.upgrades {
+		if key.Installation == installation {
+			delete(s.upgrades, key)
+		}
+	}
+}
+
+// DeletePending removes the scheduled upgrade of a cluster of the
+// installation unless it has completed. Completed upgrades are kept until
+// their retention expired.
+func (s *UpgradeStore) DeletePending(installation string, cluster types.NamespacedName) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	key := clusterKey{Installation: installation, NamespacedName: cluster}
+	if s.upgrades[key].State != UpgradeStateCompleted {
+		delete(s.upgrades, key)
+	}
+}
+
+// List returns all scheduled upgrades ordered by upgrade time. Completed
+// upgrades whose retention expired are dropped.
+func (s *UpgradeStore) List() []ScheduledUpgrade {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	upgrades := make([]ScheduledUpgrade, 0, len(s.upgrades))
+	for key, upgrade := range s.upgrades {
+		if upgrade.State == UpgradeStateCompleted && s.clock.Since(upgrade.CompletedAt) > completedUpgradeRetention {
+			delete(s.upgrades, key)
+			continue
+		}
+		upgrades = append(upgrades, upgrade)
+	}
+	sort.Slice(upgrades, func(i, j int) bool {
+		if upgrades[i].Time.Equal(upgrades[j].Time) {
+			if upgrades[i].Installation != upgrades[j].Installation {
+				return upgrades[i].Installation < upgrades[j].Installation
+			}
+			if upgrades[i].Namespace == upgrades[j].Namespace {
+				return upgrades[i].Cluster < upgrades[j].Cluster
+			}
+			return upgrades[i].Namespace < upgrades[j].Namespace
+		}
+		return upgrades[i].Time.Before(upgrades[j].Time)
+	})
+	return upgrades
+}
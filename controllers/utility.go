@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"strings"
 	"time"
 
 	"github.com/blang/semver"
@@ -12,25 +13,49 @@ import (
 )
 
 const (
+	// FieldManager is the field manager of all writes of the operator.
+	FieldManager = "upgrade-schedule-operator"
+
 	ClusterUpgradeAnnouncement = "alpha.giantswarm.io/update-schedule-upgrade-announcement"
-	OutOfHoursContact          = "kaascloud@giantswarm.io"
+	// OutOfHoursContact is the default contact named in the announcement of
+	// upgrades outside of the business hours.
+	OutOfHoursContact = "kaascloud@giantswarm.io"
+	// ClusterUpgradeRequestedBy is set by the audit webhook to the user who
+	// scheduled the upgrade.
+	ClusterUpgradeRequestedBy = "alpha.giantswarm.io/update-schedule-requested-by"
+	// ClusterUpgradeScheduledAt is the time the upgrade time was set at in
+	// RFC3339 format. The minimum notice and the maximum horizon of the
+	// upgrade policy are checked against it. It is set by the audit webhook,
+	// the kubectl plugin and the operator when they set the upgrade time.
+	ClusterUpgradeScheduledAt = "alpha.giantswarm.io/update-schedule-scheduled-at"
 )
 
-func defaultRequeue() reconcile.Result {
+// timedRequeue requeues the cluster right after due, the time of its next
+// time based action. Changes of the cluster and of the objects affecting it
+// are watched, so the cluster does not have to be requeued before.
+func timedRequeue(due time.Time, now time.Time) reconcile.Result {
+	after := due.Sub(now) + time.Second
+	if after < time.Second {
+		after = time.Second
+	}
 	return ctrl.Result{
-		Requeue:      true,
-		RequeueAfter: time.Minute * 5,
+		RequeueAfter: after,
 	}
 }
 
-func timedRequeue(upgradeTime time.Time) reconcile.Result {
-	if upgradeTime.Sub(time.Now().UTC()) > 5*time.Minute {
-		return defaultRequeue()
+// nextUpgradeAction returns the next time based action of the pending
+// upgrade and when it is due: an end of life reminder, the announcement or
+// the trigger.
+func nextUpgradeAction(cluster *clusterv1.Cluster, upgrade ScheduledUpgrade, now time.Time) (Action, time.Time) {
+	if upgrade.Announced {
+		return ActionTrigger, upgrade.Time
 	}
-	return ctrl.Result{
-		Requeue:      true,
-		RequeueAfter: upgradeTime.Sub(time.Now().UTC()) + time.Second,
+	if _, ok := cluster.Annotations[ClusterUpgradeEndOfLife]; ok {
+		if reminder, ok := nextEndOfLifeReminder(upgrade.Time, now); ok && reminder.Before(upgrade.AnnouncementTime()) {
+			return ActionEndOfLifeReminder, reminder
+		}
 	}
+	return ActionAnnouncement, upgrade.AnnouncementTime()
 }
 
 func getClusterReleaseVersionLabel(cluster *clusterv1.Cluster) string {
@@ -50,6 +75,15 @@ func isCAPIProvider(cluster *clusterv1.Cluster) bool {
 	return false
 }
 
+// getClusterProvider returns the infrastructure provider of the cluster
+// derived from its infrastructure reference, e.g. aws for an AWSCluster.
+func getClusterProvider(cluster *clusterv1.Cluster) string {
+	if cluster.Spec.InfrastructureRef == nil || cluster.Spec.InfrastructureRef.Kind == "" {
+		return "unknown"
+	}
+	return strings.ToLower(strings.TrimSuffix(cluster.Spec.InfrastructureRef.Kind, "Cluster"))
+}
+
 func getClusterUpgradeTimeAnnotation(cluster *clusterv1.Cluster) string {
 	annotations := cluster.GetAnnotations()
 	return annotations[annotation.UpdateScheduleTargetTime]
@@ -64,20 +98,25 @@ func upgradeApplied(targetVersion semver.Version, currentVersion semver.Version)
 	return currentVersion.GE(targetVersion)
 }
 
-func upgradeTimeReached(upgradeTime time.Time) bool {
-	return upgradeTime.Before(time.Now().UTC())
+// VersionBump returns the most significant version part changed by an
+// upgrade from origin to target.
+func VersionBump(originVersion semver.Version, targetVersion semver.Version) string {
+	switch {
+	case originVersion.Major != targetVersion.Major:
+		return "major"
+	case originVersion.Minor != targetVersion.Minor:
+		return "minor"
+	case originVersion.Patch != targetVersion.Patch:
+		return "patch"
+	default:
+		return "none"
+	}
 }
 
-func upgradeAnnouncementTimeReached(upgradeTime time.Time) bool {
-	return upgradeTime.Add(-15 * time.Minute).Before(time.Now().UTC())
+func upgradeTimeReached(upgradeTime time.Time, now time.Time) bool {
+	return upgradeTime.Before(now)
 }
 
-func outOfOffice(upgradeTime time.Time) bool {
-	if upgradeTime.Weekday() == time.Saturday || upgradeTime.Weekday() == time.Sunday {
-		return true
-	}
-	if upgradeTime.UTC().Hour() <= 7 || upgradeTime.UTC().Hour() >= 16 {
-		return true
-	}
-	return false
+func upgradeAnnouncementTimeReached(upgradeTime time.Time, now time.Time) bool {
+	return UpgradeAnnouncementTime(upgradeTime).Before(now)
 }
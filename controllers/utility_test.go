@@ -4,8 +4,13 @@ import (
 	"strconv"
 	"testing"
 	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
 )
 
+var testNow = time.Date(2025, 3, 12, 10, 0, 0, 0, time.UTC)
+
 func Test_UpgradeTimeReached(t *testing.T) {
 	testCases := []struct {
 		name    string
@@ -14,19 +19,53 @@ func Test_UpgradeTimeReached(t *testing.T) {
 	}{
 		{
 			name:    "case 0",
-			time:    time.Date(2030, 0, 0, 0, 0, 0, 0, time.UTC),
+			time:    testNow.Add(time.Minute),
+			reached: false,
+		},
+		{
+			name:    "case 1",
+			time:    testNow.Add(-time.Minute),
+			reached: true,
+		},
+		{
+			name:    "case 2",
+			time:    testNow,
+			reached: false,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			result := upgradeTimeReached(tc.time, testNow)
+
+			if result != tc.reached {
+				t.Fatalf("%s -  expected '%t' got '%t'\n", tc.name, tc.reached, result)
+			}
+		})
+	}
+}
+
+func Test_UpgradeAnnouncementTimeReached(t *testing.T) {
+	testCases := []struct {
+		name    string
+		time    time.Time
+		reached bool
+	}{
+		{
+			name:    "case 0",
+			time:    testNow.Add(16 * time.Minute),
 			reached: false,
 		},
 		{
 			name:    "case 1",
-			time:    time.Date(2020, 0, 0, 0, 0, 0, 0, time.UTC),
+			time:    testNow.Add(14 * time.Minute),
 			reached: true,
 		},
 	}
 
 	for i, tc := range testCases {
 		t.Run(strconv.Itoa(i), func(t *testing.T) {
-			result := upgradeTimeReached(tc.time)
+			result := upgradeAnnouncementTimeReached(tc.time, testNow)
 
 			if result != tc.reached {
 				t.Fatalf("%s -  expected '%t' got '%t'\n", tc.name, tc.reached, result)
@@ -34,3 +73,100 @@ func Test_UpgradeTimeReached(t *testing.T) {
 		})
 	}
 }
+
+func Test_TimedRequeue(t *testing.T) {
+	testCases := []struct {
+		name         string
+		time         time.Time
+		requeueAfter time.Duration
+	}{
+		{
+			name:         "case 0",
+			time:         testNow.Add(time.Hour),
+			requeueAfter: time.Hour + time.Second,
+		},
+		{
+			name:         "case 1",
+			time:         testNow.Add(2 * time.Minute),
+			requeueAfter: 2*time.Minute + time.Second,
+		},
+		{
+			name:         "case 2",
+			time:         testNow.Add(-time.Minute),
+			requeueAfter: time.Second,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			result := timedRequeue(tc.time, testNow)
+
+			if result.RequeueAfter != tc.requeueAfter {
+				t.Fatalf("%s -  expected '%v' got '%v'\n", tc.name, tc.requeueAfter, result.RequeueAfter)
+			}
+		})
+	}
+}
+
+func Test_NextUpgradeAction(t *testing.T) {
+	upgradeTime := testNow.Add(48 * time.Hour)
+
+	testCases := []struct {
+		name           string
+		announced      bool
+		endOfLife      bool
+		now            time.Time
+		expectedAction Action
+		expectedDue    time.Time
+	}{
+		{
+			name:           "case 0: announcement",
+			now:            testNow,
+			expectedAction: ActionAnnouncement,
+			expectedDue:    upgradeTime.Add(-15 * time.Minute),
+		},
+		{
+			name:           "case 1: trigger of an announced upgrade",
+			announced:      true,
+			now:            upgradeTime.Add(-10 * time.Minute),
+			expectedAction: ActionTrigger,
+			expectedDue:    upgradeTime,
+		},
+		{
+			name:           "case 2: end of life reminder",
+			endOfLife:      true,
+			now:            testNow,
+			expectedAction: ActionEndOfLifeReminder,
+			expectedDue:    upgradeTime.Add(-24 * time.Hour),
+		},
+		{
+			name:           "case 3: last end of life reminder",
+			endOfLife:      true,
+			now:            upgradeTime.Add(-2 * time.Hour),
+			expectedAction: ActionEndOfLifeReminder,
+			expectedDue:    upgradeTime.Add(-time.Hour),
+		},
+		{
+			name:           "case 4: announcement after the reminders",
+			endOfLife:      true,
+			now:            upgradeTime.Add(-30 * time.Minute),
+			expectedAction: ActionAnnouncement,
+			expectedDue:    upgradeTime.Add(-15 * time.Minute),
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			cluster := &capi.Cluster{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{}}}
+			if tc.endOfLife {
+				cluster.Annotations[ClusterUpgradeEndOfLife] = "1"
+			}
+			upgrade := ScheduledUpgrade{Time: upgradeTime, Announced: tc.announced}
+
+			action, due := nextUpgradeAction(cluster, upgrade, tc.now)
+			if action != tc.expectedAction || !due.Equal(tc.expectedDue) {
+				t.Fatalf("%s -  expected '%v at %v' got '%v at %v'\n", tc.name, tc.expectedAction, tc.expectedDue, action, due)
+			}
+		})
+	}
+}
@@ -34,3 +34,42 @@ Selector labels
 app.kubernetes.io/name: {{ include "name" . | quote }}
 app.kubernetes.io/instance: {{ .Release.Name | quote }}
 {{- end -}}
+
+{{/*
+The production label of approval.productionSelector as key and value. The
+audit webhook is scoped to production clusters by the label, so only a single
+key=value label is supported.
+*/}}
+{{- define "approval.productionLabel" -}}
+{{- $parts := splitList "=" .Values.approval.productionSelector -}}
+{{- if or (ne (len $parts) 2) (contains "," .Values.approval.productionSelector) (contains "!" .Values.approval.productionSelector) (not (first $parts)) (not (last $parts)) -}}
+{{- fail "approval.productionSelector must be a single key=value label" -}}
+{{- end -}}
+key: {{ first $parts | trim }}
+value: {{ last $parts | trim | quote }}
+{{- end -}}
+
+{{/*
+The audit webhook rules shared by the production and the other clusters.
+*/}}
+{{- define "audit.webhook" -}}
+admissionReviewVersions:
+- v1
+clientConfig:
+  service:
+    name: {{ include "resource.default.name" . }}
+    namespace: {{ include "resource.default.namespace" . }}
+    path: /mutate-cluster-x-k8s-io-v1beta1-cluster-audit
+sideEffects: NoneOnDryRun
+timeoutSeconds: 5
+rules:
+- apiGroups:
+  - cluster.x-k8s.io
+  apiVersions:
+  - v1beta1
+  operations:
+  - CREATE
+  - UPDATE
+  resources:
+  - clusters
+{{- end -}}
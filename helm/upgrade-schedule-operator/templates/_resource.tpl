@@ -14,6 +14,18 @@ room for such suffix.
 {{- include "resource.default.name" . -}}-network-policy
 {{- end -}}
 
+{{- define "resource.api.name" -}}
+{{- include "resource.default.name" . -}}-api
+{{- end -}}
+
+{{- define "resource.config.name" -}}
+{{- include "resource.default.name" . -}}-config
+{{- end -}}
+
+{{- define "resource.webhook.name" -}}
+{{- include "resource.default.name" . -}}-audit-webhook
+{{- end -}}
+
 {{- define "resource.psp.name" -}}
 {{- include "resource.default.name" . -}}-psp
 {{- end -}}
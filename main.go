@@ -17,24 +17,41 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
+	"io"
 	"os"
+	"strings"
+	"sync"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	capi "sigs.k8s.io/cluster-api/api/v1beta1"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
+	upgradev1alpha1 "github.com/giantswarm/upgrade-schedule-operator/api/v1alpha1"
 	"github.com/giantswarm/upgrade-schedule-operator/controllers"
+	"github.com/giantswarm/upgrade-schedule-operator/server"
+	"github.com/giantswarm/upgrade-schedule-operator/util/clock"
+	"github.com/giantswarm/upgrade-schedule-operator/util/config"
+	"github.com/giantswarm/upgrade-schedule-operator/util/record"
+	"github.com/giantswarm/upgrade-schedule-operator/util/tracing"
+	"github.com/giantswarm/upgrade-schedule-operator/webhooks"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -46,21 +63,60 @@ var (
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 	_ = capi.AddToScheme(scheme)
+	utilruntime.Must(upgradev1alpha1.AddToScheme(scheme))
 	// +kubebuilder:scaffold:scheme
 }
 
 func main() {
+	var configFile string
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
 	var installation string
+	var apiAddr string
+	var calendarAddr string
+	var apiTokenFile string
+	var debugTimeOffset time.Duration
+	var metricVersionLabels bool
+	var otlpEndpoint string
+	var historyRetention time.Duration
+	var historyLimit int
+	var enableAuditWebhook bool
+	var auditLogPath string
+	var productionSelector string
+	var autoUpgradeLeadTime time.Duration
+	var emergencyStop string
+	var watchNamespaces string
+	var watchSelector string
+	var webhookPort int
+	var leaderElectionID string
+	var managementClustersNamespace string
 
+	flag.StringVar(&configFile, "config", "", "The versioned config file of the operator. Flags set on the command line take precedence over the file.")
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.StringVar(&installation, "installation", "", "The name of the installation.")
+	flag.StringVar(&apiAddr, "api-bind-address", "0", "The address the upgrades API binds to. Use 0 to disable the API.")
+	flag.StringVar(&calendarAddr, "calendar-bind-address", "0", "The address the iCalendar feed of the scheduled upgrades binds to. Use 0 to disable the feed.")
+	flag.StringVar(&apiTokenFile, "api-token-file", "", "The file containing the bearer token required by the upgrades API and the iCalendar feed.")
+	flag.BoolVar(&metricVersionLabels, "metrics-version-labels", true, "Label the per cluster metrics by origin and target version. Disable to reduce the number of series.")
+	flag.StringVar(&otlpEndpoint, "otlp-endpoint", "", "The OTLP/HTTP endpoint traces are exported to, e.g. http://tempo.monitoring:4318. Tracing is disabled if empty.")
+	flag.DurationVar(&historyRetention, "history-retention", controllers.DefaultHistoryRetention, "How long triggered upgrades are kept in the upgrade history of a cluster.")
+	flag.IntVar(&historyLimit, "history-limit", controllers.DefaultHistoryLimit, "The maximum number of triggered upgrades kept in the upgrade history of a cluster.")
+	flag.BoolVar(&enableAuditWebhook, "enable-audit-webhook", false, "Serve the mutating webhook recording who scheduled, changed or cancelled upgrades.")
+	flag.StringVar(&auditLogPath, "audit-log-path", "-", "The file audit records are appended to as JSON lines. Use - for stdout.")
+	flag.StringVar(&productionSelector, "production-selector", "", "The label selector of the clusters whose upgrades require approval, e.g. "+controllers.DefaultProductionSelector+". Approval is disabled if empty. Approvals require the audit webhook.")
+	flag.DurationVar(&autoUpgradeLeadTime, "auto-upgrade-lead-time", controllers.DefaultAutoUpgradeLeadTime, "How long in advance upgrades of the auto upgrade channels are scheduled at least.")
+	flag.StringVar(&emergencyStop, "emergency-stop-configmap", "", "The namespace/name of the ConfigMap halting all upgrades while its halted key is true. The emergency stop is disabled if empty.")
+	flag.StringVar(&watchNamespaces, "watch-namespaces", "", "The comma separated namespaces of the clusters the operator reconciles. All namespaces are watched if empty.")
+	flag.StringVar(&watchSelector, "watch-selector", "", "The label selector of the clusters the operator reconciles, e.g. cluster.x-k8s.io/watch-filter=capi. All clusters are reconciled if empty.")
+	flag.StringVar(&managementClustersNamespace, "management-clusters-namespace", "", "The namespace of the kubeconfig Secrets of the remote management clusters whose clusters are reconciled as well. Only the local management cluster is reconciled if empty.")
+	flag.DurationVar(&debugTimeOffset, "debug-time-offset", 0, "Debug only. Shifts the clock of the operator by the given duration to simulate scheduled upgrades. Never use this in production.")
+	flag.IntVar(&webhookPort, "webhook-port", 9443, "The port the webhook server listens on.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&leaderElectionID, "leader-election-id", "190fff4f.giantswarm", "The name of the leader election lease. Instances reconciling different clusters in the same namespace need different names.")
 	opts := zap.Options{
 		Development: false,
 	}
@@ -69,36 +125,259 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	operatorConfig := config.Default()
+	if configFile != "" {
+		var err error
+		operatorConfig, err = config.Load(configFile)
+		if err != nil {
+			setupLog.Error(err, "invalid config file")
+			os.Exit(1)
+		}
+
+		// The config file replaces the defaults of the flags not set on the
+		// command line.
+		set := map[string]bool{}
+		flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+		if !set["health-probe-bind-address"] {
+			probeAddr = operatorConfig.Health.HealthProbeBindAddress
+		}
+		if !set["metrics-bind-address"] {
+			metricsAddr = operatorConfig.Metrics.BindAddress
+		}
+		if !set["webhook-port"] {
+			webhookPort = operatorConfig.Webhook.Port
+		}
+		if !set["leader-elect"] {
+			enableLeaderElection = operatorConfig.LeaderElection.LeaderElect
+		}
+		if !set["leader-election-id"] {
+			leaderElectionID = operatorConfig.LeaderElection.ResourceName
+		}
+	}
+	controllers.SetSettings(operatorSettings(operatorConfig.Operator))
+
+	shutdownTracing, err := tracing.Setup(context.Background(), otlpEndpoint, installation)
+	if err != nil {
+		setupLog.Error(err, "unable to set up tracing")
+		os.Exit(1)
+	}
+
+	var emergencyStopKey types.NamespacedName
+	if emergencyStop != "" {
+		namespace, name, found := strings.Cut(emergencyStop, "/")
+		if !found || namespace == "" || name == "" {
+			setupLog.Error(nil, "invalid emergency stop ConfigMap, it has to be namespace/name", "configmap", emergencyStop)
+			os.Exit(1)
+		}
+		emergencyStopKey = types.NamespacedName{Namespace: namespace, Name: name}
+	}
+
+	var namespaces []string
+	for _, namespace := range strings.Split(watchNamespaces, ",") {
+		if namespace = strings.TrimSpace(namespace); namespace != "" {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	clusterSelector, err := labels.Parse(watchSelector)
+	if err != nil {
+		setupLog.Error(err, "invalid watch selector")
+		os.Exit(1)
+	}
+	if len(namespaces) > 0 || !clusterSelector.Empty() {
+		setupLog.Info("restricting the reconciled clusters", "namespaces", namespaces, "selector", clusterSelector.String())
+	}
+
+	// Cache the Release CRs read by the auto upgrade channels.
+	clientOptions := client.Options{Cache: &client.CacheOptions{Unstructured: true}}
+	restConfig := ctrl.GetConfigOrDie()
+	mgr, err := ctrl.NewManager(restConfig, ctrl.Options{
 		Scheme: scheme,
+		Cache:  controllers.CacheOptions(namespaces, clusterSelector, emergencyStopKey),
+		Client: clientOptions,
 		Metrics: metricsserver.Options{
 			BindAddress: metricsAddr,
 		},
 		WebhookServer: webhook.NewServer(
 			webhook.Options{
-				Port: 9443,
+				Port: webhookPort,
 			},
 		),
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "190fff4f.giantswarm",
+		LeaderElectionID:       leaderElectionID,
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
-	if err = (&controllers.ClusterReconciler{
-		Client:       mgr.GetClient(),
-		Log:          ctrl.Log.WithName("controllers").WithName("Cluster"),
-		Scheme:       mgr.GetScheme(),
-		Installation: installation,
-	}).SetupWithManager(mgr); err != nil {
+	record.InitFromRecorder(mgr.GetEventRecorderFor("cluster-controller"))
+	controllers.SetMetricVersionLabels(metricVersionLabels)
+
+	if debugTimeOffset != 0 {
+		setupLog.Info("WARNING: the clock of the operator is shifted for debugging, scheduled upgrades will be triggered at the wrong time", "offset", debugTimeOffset)
+	}
+	operatorClock := clock.New(debugTimeOffset)
+
+	var production labels.Selector
+	if productionSelector != "" {
+		production, err = labels.Parse(productionSelector)
+		if err != nil {
+			setupLog.Error(err, "invalid production selector")
+			os.Exit(1)
+		}
+		// Without the webhook the requester and approvers could be set by
+		// anyone.
+		if !enableAuditWebhook {
+			setupLog.Error(nil, "approvals require the audit webhook, enable it with --enable-audit-webhook or disable approvals with an empty --production-selector")
+			os.Exit(1)
+		}
+		// The webhook only runs on the local management cluster, the
+		// identities on the clusters of remote ones are not verified.
+		if managementClustersNamespace != "" {
+			setupLog.Error(nil, "approvals are not supported with remote management clusters, disable approvals with an empty --production-selector or remote management clusters with an empty --management-clusters-namespace")
+			os.Exit(1)
+		}
+	}
+
+	upgrades := controllers.NewUpgradeStore(operatorClock)
+
+	// The webhook records the attempted and the reconcilers the persisted
+	// changes of the schedules.
+	var auditSink *controllers.AuditSink
+	if enableAuditWebhook {
+		var sink io.Writer = os.Stdout
+		if auditLogPath != "-" {
+			sink, err = os.OpenFile(auditLogPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+			if err != nil {
+				setupLog.Error(err, "unable to open audit log")
+				os.Exit(1)
+			}
+		}
+		auditSink = controllers.NewAuditSink(sink)
+	}
+
+	// The scheduler of a remote management cluster is replaced when its
+	// reconciler is restarted.
+	var schedulersMu sync.Mutex
+	schedulers := map[string]*controllers.Scheduler{}
+	setupReconciler := func(mgr manager.Manager, installation string, c cluster.Cluster, remote bool) error {
+		scheduler := controllers.NewScheduler(operatorClock)
+		if err := mgr.Add(scheduler); err != nil {
+			return err
+		}
+		schedulersMu.Lock()
+		schedulers[installation] = scheduler
+		schedulersMu.Unlock()
+
+		reconciler := &controllers.ClusterReconciler{
+			Client:       c.GetClient(),
+			APIReader:    c.GetAPIReader(),
+			Log:          ctrl.Log.WithName("controllers").WithName("Cluster"),
+			Scheme:       c.GetScheme(),
+			Installation: installation,
+			Upgrades:     upgrades,
+			Clock:        operatorClock,
+
+			HistoryRetention: historyRetention,
+			HistoryLimit:     historyLimit,
+			AuditSink:        auditSink,
+
+			ProductionSelector:  production,
+			AutoUpgradeLeadTime: autoUpgradeLeadTime,
+			EmergencyStop:       emergencyStopKey,
+			Scheduler:           scheduler,
+		}
+		if !remote {
+			return reconciler.SetupWithManager(mgr)
+		}
+		// Events are emitted on the Clusters of the remote management cluster.
+		reconciler.Log = reconciler.Log.WithValues("installation", installation)
+		reconciler.Recorder = record.Recorder{EventRecorder: c.GetEventRecorderFor("cluster-controller")}
+		return reconciler.SetupWithCluster(mgr, c)
+	}
+
+	if err = setupReconciler(mgr, installation, mgr, false); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Cluster")
 		os.Exit(1)
 	}
+
+	if managementClustersNamespace != "" {
+		// The kubeconfig Secrets are watched, the reconciler of a remote
+		// management cluster is restarted when its Secret changes.
+		managementClusters := &controllers.ManagementClusters{
+			Manager:           mgr,
+			Config:            restConfig,
+			Scheme:            scheme,
+			Log:               ctrl.Log.WithName("management-clusters"),
+			Namespace:         managementClustersNamespace,
+			LocalInstallation: installation,
+			Options: []cluster.Option{func(o *cluster.Options) {
+				o.Scheme = scheme
+				o.Cache = controllers.CacheOptions(namespaces, clusterSelector, emergencyStopKey)
+				o.Client = clientOptions
+			}},
+			Setup: func(mgr manager.Manager, installation string, remote cluster.Cluster) error {
+				return setupReconciler(mgr, installation, remote, true)
+			},
+			Upgrades: upgrades,
+		}
+		if err := mgr.Add(managementClusters); err != nil {
+			setupLog.Error(err, "unable to set up management clusters")
+			os.Exit(1)
+		}
+	}
+
+	if configFile != "" {
+		watcher := config.NewWatcher(configFile, operatorConfig, func(operator config.Operator) {
+			controllers.SetSettings(operatorSettings(operator))
+			// Schedule the pending actions again with the new settings.
+			schedulersMu.Lock()
+			defer schedulersMu.Unlock()
+			for _, scheduler := range schedulers {
+				scheduler.Expire()
+			}
+		}, ctrl.Log.WithName("config"))
+		if err := mgr.Add(watcher); err != nil {
+			setupLog.Error(err, "unable to set up config watcher")
+			os.Exit(1)
+		}
+	}
+
 	// +kubebuilder:scaffold:builder
 
+	if calendarAddr != "0" {
+		calendarServer, err := server.NewCalendarServer(calendarAddr, apiTokenFile, upgrades, installation)
+		if err != nil {
+			setupLog.Error(err, "unable to create calendar feed")
+			os.Exit(1)
+		}
+		if err := mgr.Add(calendarServer); err != nil {
+			setupLog.Error(err, "unable to set up calendar feed")
+			os.Exit(1)
+		}
+	}
+
+	if enableAuditWebhook {
+		mgr.GetWebhookServer().Register(webhooks.AuditPath, &webhook.Admission{Handler: &webhooks.ClusterAuditor{
+			Log:   ctrl.Log.WithName("webhooks").WithName("ClusterAuditor"),
+			Sink:  auditSink,
+			Clock: operatorClock,
+		}})
+	}
+
+	if apiAddr != "0" {
+		apiServer, err := server.NewAPIServer(apiAddr, apiTokenFile, upgrades, installation)
+		if err != nil {
+			setupLog.Error(err, "unable to create upgrades api")
+			os.Exit(1)
+		}
+		if err := mgr.Add(apiServer); err != nil {
+			setupLog.Error(err, "unable to set up upgrades api")
+			os.Exit(1)
+		}
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -109,8 +388,30 @@ func main() {
 	}
 
 	setupLog.Info("starting manager")
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+	err = mgr.Start(ctrl.SetupSignalHandler())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := shutdownTracing(ctx); err != nil {
+		setupLog.Error(err, "problem flushing traces")
+	}
+	cancel()
+
+	if err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
 }
+
+// operatorSettings maps the operator settings of the config file onto the
+// settings of the controllers.
+func operatorSettings(operator config.Operator) controllers.Settings {
+	return controllers.Settings{
+		AnnouncementOffset: operator.AnnouncementOffset.Duration,
+		BusinessHours: controllers.BusinessHours{
+			Start: operator.BusinessHours.Start,
+			End:   operator.BusinessHours.End,
+		},
+		Contact:         operator.Contact,
+		RequeueInterval: operator.RequeueInterval.Duration,
+	}
+}
@@ -0,0 +1,229 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/giantswarm/upgrade-schedule-operator/controllers"
+)
+
+const (
+	// APIPath is the path prefix of the JSON API.
+	APIPath = "/api/v1/upgrades"
+
+	apiShutdownTimeout = 10 * time.Second
+)
+
+// Upgrade is the JSON representation of a scheduled upgrade.
+type Upgrade struct {
+	Cluster          string                   `json:"cluster"`
+	Namespace        string                   `json:"namespace"`
+	Organization     string                   `json:"organization,omitempty"`
+	Installation     string                   `json:"installation"`
+	OriginVersion    string                   `json:"originVersion"`
+	TargetVersion    string                   `json:"targetVersion"`
+	State            controllers.UpgradeState `json:"state"`
+	Announced        bool                     `json:"announced"`
+	AnnouncementTime *time.Time               `json:"announcementTime,omitempty"`
+	UpgradeTime      *time.Time               `json:"upgradeTime,omitempty"`
+	WindowEnd        *time.Time               `json:"windowEnd,omitempty"`
+	CompletedAt      *time.Time               `json:"completedAt,omitempty"`
+	Reason           string                   `json:"reason,omitempty"`
+	Message          string                   `json:"message,omitempty"`
+}
+
+// UpgradeList is the JSON representation of a list of scheduled upgrades.
+type UpgradeList struct {
+	Items []Upgrade `json:"items"`
+}
+
+// APIServer serves the scheduled upgrades as a read-only JSON API. Every
+// request has to be authenticated with the configured bearer token.
+//
+//	GET /api/v1/upgrades[?installation=gauss&namespace=org-acme&state=pending]
+//	GET /api/v1/upgrades/{namespace}/{cluster}[?installation=gauss]
+//
+// Clusters of other management clusters are selected by the installation
+// query parameter, it defaults to the installation of the operator.
+type APIServer struct {
+	Addr         string
+	Token        string
+	Upgrades     *controllers.UpgradeStore
+	Installation string
+}
+
+// NewAPIServer creates an APIServer reading the bearer token from tokenFile.
+func NewAPIServer(addr, tokenFile string, upgrades *controllers.UpgradeStore, installation string) (*APIServer, error) {
+	token, err := readToken(tokenFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &APIServer{
+		Addr:         addr,
+		Token:        token,
+		Upgrades:     upgrades,
+		Installation: installation,
+	}, nil
+}
+
+// Handler returns the authenticated handler of the API.
+func (s *APIServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+APIPath, s.list)
+	mux.HandleFunc("GET "+APIPath+"/{namespace}/{cluster}", s.get)
+	return authenticate(s.Token, mux)
+}
+
+// Start runs the API server until the context is cancelled. It implements
+// the manager.Runnable interface.
+func (s *APIServer) Start(ctx context.Context) error {
+	return errors.Wrap(serve(ctx, s.Addr, s.Handler()), "failed serving api")
+}
+
+// serve runs an HTTP server until the context is cancelled.
+func serve(ctx context.Context, addr string, handler http.Handler) error {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), apiShutdownTimeout)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// NeedLeaderElection makes the API run on the leader only because only the
+// leader reconciles clusters and knows about their scheduled upgrades.
+func (s *APIServer) NeedLeaderElection() bool {
+	return true
+}
+
+// readToken returns the bearer token of tokenFile.
+func readToken(tokenFile string) (string, error) {
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return "", errors.Wrap(err, "failed reading api token file")
+	}
+	if strings.TrimSpace(string(token)) == "" {
+		return "", errors.Errorf("api token file %s is empty", tokenFile)
+	}
+	return strings.TrimSpace(string(token)), nil
+}
+
+// authenticate only passes requests with the bearer token on to next.
+func authenticate(expected string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="upgrade-schedule-operator"`)
+			writeError(w, http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+func (s *APIServer) list(w http.ResponseWriter, req *http.Request) {
+	installations := req.URL.Query()["installation"]
+	namespaces := req.URL.Query()["namespace"]
+	states := req.URL.Query()["state"]
+
+	list := UpgradeList{Items: []Upgrade{}}
+	for _, upgrade := range s.Upgrades.List() {
+		if len(installations) > 0 && !slices.Contains(installations, s.installation(upgrade)) {
+			continue
+		}
+		if len(namespaces) > 0 && !slices.Contains(namespaces, upgrade.Namespace) {
+			continue
+		}
+		if len(states) > 0 && !slices.Contains(states, string(upgrade.State)) {
+			continue
+		}
+		list.Items = append(list.Items, s.toUpgrade(upgrade))
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *APIServer) get(w http.ResponseWriter, req *http.Request) {
+	installation := req.URL.Query().Get("installation")
+	if installation == "" {
+		installation = s.Installation
+	}
+	upgrade, ok := s.Upgrades.Get(installation, types.NamespacedName{Namespace: req.PathValue("namespace"), Name: req.PathValue("cluster")})
+	if !ok {
+		writeError(w, http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.toUpgrade(upgrade))
+}
+
+// installation returns the installation of the management cluster of the
+// upgrade.
+func (s *APIServer) installation(upgrade controllers.ScheduledUpgrade) string {
+	if upgrade.Installation == "" {
+		return s.Installation
+	}
+	return upgrade.Installation
+}
+
+func (s *APIServer) toUpgrade(upgrade controllers.ScheduledUpgrade) Upgrade {
+	u := Upgrade{
+		Cluster:       upgrade.Cluster,
+		Namespace:     upgrade.Namespace,
+		Organization:  upgrade.Organization,
+		Installation:  s.installation(upgrade),
+		OriginVersion: upgrade.OriginVersion,
+		TargetVersion: upgrade.TargetVersion,
+		State:         upgrade.State,
+		Announced:     upgrade.Announced,
+		Reason:        upgrade.Reason,
+		Message:       upgrade.Message,
+	}
+	if !upgrade.Time.IsZero() {
+		u.AnnouncementTime = timePtr(upgrade.AnnouncementTime())
+		u.UpgradeTime = timePtr(upgrade.Time)
+		u.WindowEnd = timePtr(upgrade.WindowEnd())
+	}
+	if !upgrade.CompletedAt.IsZero() {
+		u.CompletedAt = timePtr(upgrade.CompletedAt)
+	}
+	return u
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int) {
+	writeJSON(w, code, map[string]string{"error": http.StatusText(code)})
+}
+
+func timePtr(t time.Time) *time.Time {
+	t = t.UTC()
+	return &t
+}
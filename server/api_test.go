@@ -0,0 +1,178 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/giantswarm/upgrade-schedule-operator/controllers"
+)
+
+func TestAPIServer(t *testing.T) {
+	upgrades := controllers.NewUpgradeStore(clocktesting.NewFakeClock(time.Date(2021, 9, 1, 0, 0, 0, 0, time.UTC)))
+	upgrades.Set(controllers.ScheduledUpgrade{
+		Installation:  "gauss",
+		Cluster:       "dh82p",
+		Namespace:     "org-acme",
+		Organization:  "acme",
+		OriginVersion: "14.2.2",
+		TargetVersion: "15.2.1",
+		Time:          time.Date(2021, 9, 10, 12, 0, 0, 0, time.UTC),
+		Announced:     true,
+		State:         controllers.UpgradeStatePending,
+	})
+	upgrades.Set(controllers.ScheduledUpgrade{
+		Installation:  "gauss",
+		Cluster:       "ga83x",
+		Namespace:     "org-giantswarm",
+		Organization:  "giantswarm",
+		OriginVersion: "25.0.0",
+		TargetVersion: "26.0.0",
+		Time:          time.Date(2021, 9, 11, 8, 0, 0, 0, time.UTC),
+		State:         controllers.UpgradeStateFailed,
+		Reason:        controllers.ReasonUserConfigNotFound,
+		Message:       "configmaps \"ga83x-userconfig\" not found",
+	})
+	upgrades.Set(controllers.ScheduledUpgrade{
+		Installation:  "other",
+		Cluster:       "ga83x",
+		Namespace:     "org-giantswarm",
+		Organization:  "giantswarm",
+		OriginVersion: "25.0.0",
+		TargetVersion: "25.1.0",
+		Time:          time.Date(2021, 9, 12, 8, 0, 0, 0, time.UTC),
+		State:         controllers.UpgradeStatePending,
+	})
+
+	s := &APIServer{
+		Token:        "secret",
+		Upgrades:     upgrades,
+		Installation: "gauss",
+	}
+	handler := s.Handler()
+
+	testCases := []struct {
+		name         string
+		target       string
+		token        string
+		expectedCode int
+		expected     []string
+	}{
+		{
+			name:         "missing token",
+			target:       APIPath,
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "wrong token",
+			target:       APIPath,
+			token:        "guess",
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "list all",
+			target:       APIPath,
+			token:        "secret",
+			expectedCode: http.StatusOK,
+			expected:     []string{"gauss/dh82p", "gauss/ga83x", "other/ga83x"},
+		},
+		{
+			name:         "list by installation",
+			target:       APIPath + "?installation=gauss",
+			token:        "secret",
+			expectedCode: http.StatusOK,
+			expected:     []string{"gauss/dh82p", "gauss/ga83x"},
+		},
+		{
+			name:         "list by namespace",
+			target:       APIPath + "?namespace=org-giantswarm",
+			token:        "secret",
+			expectedCode: http.StatusOK,
+			expected:     []string{"gauss/ga83x", "other/ga83x"},
+		},
+		{
+			name:         "list by state",
+			target:       APIPath + "?state=pending&state=in_progress",
+			token:        "secret",
+			expectedCode: http.StatusOK,
+			expected:     []string{"gauss/dh82p", "other/ga83x"},
+		},
+		{
+			name:         "list by unknown state",
+			target:       APIPath + "?state=completed",
+			token:        "secret",
+			expectedCode: http.StatusOK,
+			expected:     []string{},
+		},
+		{
+			name:         "get",
+			target:       APIPath + "/org-giantswarm/ga83x",
+			token:        "secret",
+			expectedCode: http.StatusOK,
+			expected:     []string{"gauss/ga83x"},
+		},
+		{
+			name:         "get of another installation",
+			target:       APIPath + "/org-giantswarm/ga83x?installation=other",
+			token:        "secret",
+			expectedCode: http.StatusOK,
+			expected:     []string{"other/ga83x"},
+		},
+		{
+			name:         "get unknown cluster",
+			target:       APIPath + "/org-giantswarm/unknown",
+			token:        "secret",
+			expectedCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.target, nil)
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.expectedCode, rec.Code)
+			if tc.expected == nil {
+				return
+			}
+
+			var items []Upgrade
+			if len(tc.target) > len(APIPath) && tc.target[len(APIPath)] == '/' {
+				var upgrade Upgrade
+				assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &upgrade))
+				items = append(items, upgrade)
+			} else {
+				var list UpgradeList
+				assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+				items = list.Items
+			}
+
+			clusters := []string{}
+			for _, item := range items {
+				clusters = append(clusters, item.Installation+"/"+item.Cluster)
+			}
+			assert.Equal(t, tc.expected, clusters)
+		})
+	}
+}
+
+func TestAPIServerUpgradeWindow(t *testing.T) {
+	s := &APIServer{Installation: "gauss"}
+	upgrade := s.toUpgrade(controllers.ScheduledUpgrade{
+		Cluster: "dh82p",
+		Time:    time.Date(2021, 9, 10, 12, 0, 0, 0, time.UTC),
+	})
+
+	assert.Equal(t, time.Date(2021, 9, 10, 11, 45, 0, 0, time.UTC), *upgrade.AnnouncementTime)
+	assert.Equal(t, time.Date(2021, 9, 10, 13, 0, 0, 0, time.UTC), *upgrade.WindowEnd)
+	assert.Nil(t, upgrade.CompletedAt)
+}
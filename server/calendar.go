@@ -0,0 +1,203 @@
+// Package server implements the HTTP endpoints serving the scheduled upgrades
+// known to the operator.
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/giantswarm/upgrade-schedule-operator/controllers"
+)
+
+const (
+	// CalendarPath is the path the iCalendar feed is served on.
+	CalendarPath = "/calendar.ics"
+	// calendarTimeFormat is the iCalendar UTC date-time format.
+	calendarTimeFormat = "20060102T150405Z"
+	// calendarLineLength is the maximum length of a content line in octets.
+	calendarLineLength = 75
+)
+
+// CalendarHandler serves the scheduled upgrades as an iCalendar feed. The feed
+// can be limited to one or more organization namespaces using the namespace
+// query parameter, e.g. /calendar.ics?namespace=org-acme.
+type CalendarHandler struct {
+	Upgrades     *controllers.UpgradeStore
+	Installation string
+
+	// now is used for the DTSTAMP property and can be replaced in tests.
+	now func() time.Time
+}
+
+func NewCalendarHandler(upgrades *controllers.UpgradeStore, installation string) *CalendarHandler {
+	return &CalendarHandler{
+		Upgrades:     upgrades,
+		Installation: installation,
+		now:          time.Now,
+	}
+}
+
+// CalendarServer serves the iCalendar feed on its own address. The feed lists
+// the upgrades of all organizations, so every request has to be authenticated
+// with the bearer token of the upgrades API.
+type CalendarServer struct {
+	Addr    string
+	Token   string
+	Handler *CalendarHandler
+}
+
+// NewCalendarServer creates a CalendarServer reading the bearer token from
+// tokenFile.
+func NewCalendarServer(addr, tokenFile string, upgrades *controllers.UpgradeStore, installation string) (*CalendarServer, error) {
+	token, err := readToken(tokenFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CalendarServer{
+		Addr:    addr,
+		Token:   token,
+		Handler: NewCalendarHandler(upgrades, installation),
+	}, nil
+}
+
+// Start runs the calendar server until the context is cancelled. It
+// implements the manager.Runnable interface.
+func (s *CalendarServer) Start(ctx context.Context) error {
+	return errors.Wrap(serve(ctx, s.Addr, s.handler()), "failed serving calendar")
+}
+
+// handler returns the authenticated handler of the feed.
+func (s *CalendarServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(CalendarPath, authenticate(s.Token, s.Handler))
+	return mux
+}
+
+// NeedLeaderElection makes the calendar run on the leader only because only
+// the leader knows about the scheduled upgrades. Other replicas would serve
+// an empty calendar.
+func (s *CalendarServer) NeedLeaderElection() bool {
+	return true
+}
+
+func (h *CalendarHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	namespaces := req.URL.Query()["namespace"]
+
+	var upgrades []controllers.ScheduledUpgrade
+	for _, upgrade := range h.Upgrades.List() {
+		if upgrade.Time.IsZero() {
+			continue
+		}
+		if len(namespaces) > 0 && !slices.Contains(namespaces, upgrade.Namespace) {
+			continue
+		}
+		upgrades = append(upgrades, upgrade)
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="upgrades.ics"`)
+	if req.Method == http.MethodHead {
+		return
+	}
+	_ = h.writeCalendar(w, upgrades)
+}
+
+func (h *CalendarHandler) writeCalendar(w io.Writer, upgrades []controllers.ScheduledUpgrade) error {
+	cw := &calendarWriter{w: w}
+	stamp := h.now().UTC().Format(calendarTimeFormat)
+
+	cw.line("BEGIN:VCALENDAR")
+	cw.line("VERSION:2.0")
+	cw.line("PRODID:-//Giant Swarm//upgrade-schedule-operator//EN")
+	cw.line("CALSCALE:GREGORIAN")
+	cw.line("METHOD:PUBLISH")
+	cw.property("X-WR-CALNAME", fmt.Sprintf("Scheduled cluster upgrades in %s", h.Installation))
+	for _, upgrade := range upgrades {
+		installation := upgrade.Installation
+		if installation == "" {
+			installation = h.Installation
+		}
+		cw.line("BEGIN:VEVENT")
+		cw.property("UID", fmt.Sprintf("%s-%s-%s-%d@%s.upgrade-schedule-operator", upgrade.Namespace, upgrade.Cluster, upgrade.TargetVersion, upgrade.Time.Unix(), installation))
+		cw.line("DTSTAMP:" + stamp)
+		cw.line("DTSTART:" + upgrade.Time.UTC().Format(calendarTimeFormat))
+		cw.line("DTEND:" + upgrade.WindowEnd().UTC().Format(calendarTimeFormat))
+		cw.property("SUMMARY", fmt.Sprintf("Upgrade of cluster %s/%s to %s", upgrade.Namespace, upgrade.Cluster, upgrade.TargetVersion))
+		cw.property("DESCRIPTION", fmt.Sprintf("The cluster %s/%s in %s is scheduled to be upgraded from release version %s to %s.\nOrganization: %s",
+			upgrade.Namespace,
+			upgrade.Cluster,
+			installation,
+			upgrade.OriginVersion,
+			upgrade.TargetVersion,
+			upgrade.Organization,
+		))
+		cw.property("LOCATION", installation)
+		cw.property("CATEGORIES", "Cluster upgrade")
+		cw.line("BEGIN:VALARM")
+		cw.line("ACTION:DISPLAY")
+		cw.line(fmt.Sprintf("TRIGGER:-PT%dM", int(upgrade.Time.Sub(upgrade.AnnouncementTime()).Minutes())))
+		cw.property("DESCRIPTION", fmt.Sprintf("Upgrade of cluster %s/%s starts in %v", upgrade.Namespace, upgrade.Cluster, upgrade.Time.Sub(upgrade.AnnouncementTime())))
+		cw.line("END:VALARM")
+		cw.line("END:VEVENT")
+	}
+	cw.line("END:VCALENDAR")
+
+	return cw.err
+}
+
+// calendarWriter writes iCalendar content lines as defined in RFC 5545.
+type calendarWriter struct {
+	w   io.Writer
+	err error
+}
+
+// property writes a property with an escaped text value.
+func (cw *calendarWriter) property(name, value string) {
+	cw.line(name + ":" + escapeText(value))
+}
+
+// line writes a content line terminated by CRLF and folded after
+// calendarLineLength octets without splitting multi-byte characters.
+func (cw *calendarWriter) line(content string) {
+	if cw.err != nil {
+		return
+	}
+
+	var b strings.Builder
+	length := 0
+	for _, r := range content {
+		size := len(string(r))
+		if length+size > calendarLineLength {
+			b.WriteString("\r\n ")
+			length = 1
+		}
+		b.WriteRune(r)
+		length += size
+	}
+	b.WriteString("\r\n")
+
+	_, cw.err = io.WriteString(cw.w, b.String())
+}
+
+func escapeText(value string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(value)
+}
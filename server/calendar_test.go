@@ -0,0 +1,136 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/giantswarm/upgrade-schedule-operator/controllers"
+)
+
+func TestCalendarHandler(t *testing.T) {
+	upgrades := controllers.NewUpgradeStore(clocktesting.NewFakeClock(time.Date(2021, 9, 1, 0, 0, 0, 0, time.UTC)))
+	upgrades.Set(controllers.ScheduledUpgrade{
+		Cluster:       "dh82p",
+		Namespace:     "org-acme",
+		Organization:  "acme",
+		OriginVersion: "14.2.2",
+		TargetVersion: "15.2.1",
+		Time:          time.Date(2021, 9, 10, 12, 0, 0, 0, time.UTC),
+	})
+	upgrades.Set(controllers.ScheduledUpgrade{
+		Cluster:       "ga83x",
+		Namespace:     "org-giantswarm",
+		Organization:  "giantswarm",
+		OriginVersion: "25.0.0",
+		TargetVersion: "26.0.0",
+		Time:          time.Date(2021, 9, 11, 8, 0, 0, 0, time.UTC),
+	})
+
+	h := NewCalendarHandler(upgrades, "gauss")
+	h.now = func() time.Time { return time.Date(2021, 9, 1, 0, 0, 0, 0, time.UTC) }
+
+	testCases := []struct {
+		name     string
+		target   string
+		clusters []string
+	}{
+		{
+			name:     "all namespaces",
+			target:   CalendarPath,
+			clusters: []string{"dh82p", "ga83x"},
+		},
+		{
+			name:     "filtered by namespace",
+			target:   CalendarPath + "?namespace=org-acme",
+			clusters: []string{"dh82p"},
+		},
+		{
+			name:     "unknown namespace",
+			target:   CalendarPath + "?namespace=org-unknown",
+			clusters: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.target, nil))
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, "text/calendar; charset=utf-8", rec.Header().Get("Content-Type"))
+
+			body := rec.Body.String()
+			assert.True(t, strings.HasPrefix(body, "BEGIN:VCALENDAR\r\n"))
+			assert.True(t, strings.HasSuffix(body, "END:VCALENDAR\r\n"))
+			assert.Equal(t, len(tc.clusters), strings.Count(body, "BEGIN:VEVENT\r\n"))
+			for _, cluster := range tc.clusters {
+				assert.Contains(t, body, "SUMMARY:Upgrade of cluster ")
+				assert.Contains(t, body, "/"+cluster+" to ")
+			}
+			for _, line := range strings.Split(body, "\r\n") {
+				assert.LessOrEqual(t, len(line), calendarLineLength)
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, CalendarPath+"?namespace=org-acme", nil))
+	assert.Contains(t, rec.Body.String(), "DTSTART:20210910T120000Z\r\n")
+	assert.Contains(t, rec.Body.String(), "DTEND:20210910T130000Z\r\n")
+	assert.Contains(t, rec.Body.String(), "DTSTAMP:20210901T000000Z\r\n")
+
+	// Only the leader fills the upgrade store.
+	assert.True(t, (&CalendarServer{Handler: h}).NeedLeaderElection())
+}
+
+func TestCalendarServerAuthentication(t *testing.T) {
+	upgrades := controllers.NewUpgradeStore(clocktesting.NewFakeClock(time.Date(2021, 9, 1, 0, 0, 0, 0, time.UTC)))
+	s := &CalendarServer{
+		Token:   "secret",
+		Handler: NewCalendarHandler(upgrades, "gauss"),
+	}
+	handler := s.handler()
+
+	testCases := []struct {
+		name          string
+		authorization string
+		expectedCode  int
+	}{
+		{
+			name:         "unauthenticated",
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:          "wrong token",
+			authorization: "Bearer wrong",
+			expectedCode:  http.StatusUnauthorized,
+		},
+		{
+			name:          "token",
+			authorization: "Bearer secret",
+			expectedCode:  http.StatusOK,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, CalendarPath, nil)
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			assert.Equal(t, tc.expectedCode, rec.Code)
+		})
+	}
+}
+
+func TestEscapeText(t *testing.T) {
+	assert.Equal(t, `a\, b\; c\\d\ne`, escapeText("a, b; c\\d\ne"))
+}
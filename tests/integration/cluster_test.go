@@ -0,0 +1,279 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clocktesting "k8s.io/utils/clock/testing"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/giantswarm/upgrade-schedule-operator/controllers"
+)
+
+const (
+	releaseLabel       = "release.giantswarm.io/version"
+	targetReleaseKey   = "alpha.giantswarm.io/update-schedule-target-release"
+	targetTimeKey      = "alpha.giantswarm.io/update-schedule-target-time"
+	announcementKey    = "alpha.giantswarm.io/update-schedule-upgrade-announcement"
+	upgradeTimeValue   = "12 Mar 25 12:00 UTC"
+	rescheduledTimeVal = "13 Mar 25 12:00 UTC"
+
+	// versions are the version labels of the per cluster series.
+	versions = "origin_version=14.2.2,target_version=15.2.1"
+)
+
+var upgradeTime = time.Date(2025, 3, 12, 12, 0, 0, 0, time.UTC)
+
+func newCluster(t *testing.T, namespace string, capiProvider bool) *capi.Cluster {
+	t.Helper()
+
+	createNamespace(t, namespace)
+	cluster := &capi.Cluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: namespace,
+			Labels: map[string]string{
+				"giantswarm.io/organization": "giantswarm",
+				releaseLabel:                 "14.2.2",
+			},
+			Annotations: map[string]string{
+				targetReleaseKey:                      "15.2.1",
+				targetTimeKey:                         upgradeTimeValue,
+				controllers.ClusterUpgradeScheduledAt: "2025-03-01T12:00:00Z",
+			},
+		},
+	}
+	if capiProvider {
+		cluster.Labels["cluster.x-k8s.io/watch-filter"] = "capi"
+	}
+	return cluster
+}
+
+func newUserConfig(cluster *capi.Cluster) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cluster.Name + "-userconfig",
+			Namespace: cluster.Namespace,
+		},
+		Data: map[string]string{
+			"values": "global:\n  release:\n    version: 14.2.2\n",
+		},
+	}
+}
+
+func create(t *testing.T, obj client.Object) {
+	t.Helper()
+
+	if err := k8sClient.Create(context.Background(), obj); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = k8sClient.Delete(context.Background(), obj)
+	})
+}
+
+func upgradeState(cluster *capi.Cluster) controllers.UpgradeState {
+	upgrade, ok := upgrades.Get("envtest", client.ObjectKeyFromObject(cluster))
+	if !ok {
+		return ""
+	}
+	return upgrade.State
+}
+
+func TestReschedule(t *testing.T) {
+	fakeClock.SetTime(upgradeTime.Add(-2 * time.Hour))
+	cluster := newCluster(t, "org-reschedule", false)
+	create(t, cluster)
+
+	eventually(t, func() bool {
+		return clusterSeries(t, controllers.UpgradesInfo, cluster)[versions] == float64(upgradeTime.Unix())
+	}, "upgrade time gauge is set")
+	assert.Equal(t, map[string]float64{versions: float64(upgradeTime.Unix())}, clusterSeries(t, controllers.UpgradesInfo, cluster))
+	assert.Equal(t, map[string]float64{"state=scheduled": 1}, activeSeries(clusterSeries(t, controllers.UpgradeStateInfo, cluster)))
+	assert.Equal(t, controllers.UpgradeStatePending, upgradeState(cluster))
+	assert.NotContains(t, events(t, cluster), controllers.ReasonClusterUpgradeAnnouncement)
+
+	// Announce the upgrade.
+	fakeClock.SetTime(upgradeTime.Add(-10 * time.Minute))
+	touch(t, cluster)
+	eventually(t, func() bool {
+		_, ok := getCluster(t, cluster).Annotations[announcementKey]
+		return ok
+	}, "announcement annotation is set")
+	eventually(t, func() bool {
+		event, ok := events(t, cluster)[controllers.ReasonClusterUpgradeAnnouncement]
+		return ok && event.Type == corev1.EventTypeNormal && strings.Contains(event.Message, "is scheduled to start in 10m0s")
+	}, "announcement event is emitted")
+	eventually(t, func() bool {
+		return activeSeries(clusterSeries(t, controllers.UpgradeStateInfo, cluster))["state=announced"] == 1
+	}, "upgrade state is announced")
+
+	// Move the upgrade to the next day.
+	obj := getCluster(t, cluster)
+	patch := client.MergeFrom(obj.DeepCopy())
+	obj.Annotations[targetTimeKey] = rescheduledTimeVal
+	if err := k8sClient.Patch(context.Background(), obj, patch); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, func() bool {
+		upgrade, ok := upgrades.Get("envtest", client.ObjectKeyFromObject(cluster))
+		return ok && upgrade.Time.Equal(upgradeTime.AddDate(0, 0, 1))
+	}, "rescheduled upgrade time is known")
+	eventually(t, func() bool {
+		return clusterSeries(t, controllers.UpgradesInfo, cluster)[versions] == float64(upgradeTime.AddDate(0, 0, 1).Unix())
+	}, "upgrade time gauge is updated")
+	assert.Len(t, clusterSeries(t, controllers.UpgradesInfo, cluster), 1, "there is a single upgrade time series")
+
+	// The original upgrade time passes without an upgrade.
+	fakeClock.SetTime(upgradeTime.Add(time.Minute))
+	touch(t, cluster)
+	consistently(t, 2*time.Second, func() bool {
+		return getCluster(t, cluster).Labels[releaseLabel] == "14.2.2"
+	}, "cluster is not upgraded at the original time")
+}
+
+func TestCancel(t *testing.T) {
+	fakeClock.SetTime(upgradeTime.Add(-2 * time.Hour))
+	cluster := newCluster(t, "org-cancel", false)
+	create(t, cluster)
+
+	eventually(t, func() bool {
+		return upgradeState(cluster) == controllers.UpgradeStatePending
+	}, "upgrade is pending")
+
+	obj := getCluster(t, cluster)
+	patch := client.MergeFrom(obj.DeepCopy())
+	delete(obj.Annotations, targetTimeKey)
+	delete(obj.Annotations, targetReleaseKey)
+	if err := k8sClient.Patch(context.Background(), obj, patch); err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, func() bool {
+		return upgradeState(cluster) == ""
+	}, "upgrade is forgotten")
+	assert.Equal(t, map[string]float64{"state=none": 1}, activeSeries(clusterSeries(t, controllers.UpgradeStateInfo, cluster)))
+	assert.Empty(t, clusterSeries(t, controllers.UpgradesInfo, cluster), "the upgrade time series is removed")
+
+	fakeClock.SetTime(upgradeTime.Add(time.Minute))
+	touch(t, cluster)
+	consistently(t, 2*time.Second, func() bool {
+		return getCluster(t, cluster).Labels[releaseLabel] == "14.2.2"
+	}, "cancelled upgrade is not applied")
+}
+
+func TestPausedCluster(t *testing.T) {
+	fakeClock.SetTime(upgradeTime.Add(time.Minute))
+	cluster := newCluster(t, "org-paused", false)
+	cluster.Spec.Paused = true
+	create(t, cluster)
+
+	consistently(t, 2*time.Second, func() bool {
+		return getCluster(t, cluster).Labels[releaseLabel] == "14.2.2"
+	}, "paused cluster is not upgraded")
+
+	obj := getCluster(t, cluster)
+	patch := client.MergeFrom(obj.DeepCopy())
+	obj.Spec.Paused = false
+	if err := k8sClient.Patch(context.Background(), obj, patch); err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, func() bool {
+		obj := getCluster(t, cluster)
+		_, scheduled := obj.Annotations[targetTimeKey]
+		return obj.Labels[releaseLabel] == "15.2.1" && !scheduled
+	}, "cluster is upgraded once unpaused")
+
+	fakeClock.SetTime(upgradeTime.Add(10 * time.Minute))
+	touch(t, cluster)
+	eventually(t, func() bool {
+		return upgradeState(cluster) == controllers.UpgradeStateCompleted
+	}, "upgrade is verified")
+	eventually(t, func() bool {
+		event, ok := events(t, cluster)[controllers.ReasonUpgradeCompleted]
+		return ok && event.Type == corev1.EventTypeNormal
+	}, "completion event is emitted")
+	_, inProgress := getCluster(t, cluster).Annotations[controllers.ClusterUpgradeInProgress]
+	assert.False(t, inProgress)
+	assert.Equal(t, map[string]float64{versions: 1}, clusterSeries(t, controllers.SuccessTotal, cluster))
+	assert.Equal(t, map[string]float64{versions: 1}, clusterSeries(t, controllers.UpgradesTotal, cluster))
+	assert.Empty(t, clusterSeries(t, controllers.FailuresTotal, cluster))
+	assert.Equal(t, map[string]float64{"state=completed": 1}, activeSeries(clusterSeries(t, controllers.UpgradeStateInfo, cluster)))
+}
+
+func TestMissingUserConfig(t *testing.T) {
+	fakeClock.SetTime(upgradeTime.Add(time.Minute))
+	cluster := newCluster(t, "org-userconfig", true)
+	create(t, cluster)
+
+	eventually(t, func() bool {
+		event, ok := events(t, cluster)[controllers.ReasonUserConfigNotFound]
+		return ok && event.Type == corev1.EventTypeWarning
+	}, "missing userconfig warning is emitted")
+	eventually(t, func() bool {
+		return upgradeState(cluster) == controllers.UpgradeStateFailed
+	}, "upgrade failed")
+	failures := clusterSeries(t, controllers.FailuresTotal, cluster)
+	assert.Len(t, failures, 1)
+	assert.GreaterOrEqual(t, failures[versions], float64(1))
+	assert.Equal(t, map[string]float64{"state=failed": 1}, activeSeries(clusterSeries(t, controllers.UpgradeStateInfo, cluster)))
+	assert.Equal(t, map[string]float64{"reason=" + controllers.ReasonUserConfigNotFound: 1}, clusterSeries(t, controllers.UpgradeStateReason, cluster))
+
+	cm := newUserConfig(cluster)
+	create(t, cm)
+	touch(t, cluster)
+
+	eventually(t, func() bool {
+		obj := &corev1.ConfigMap{}
+		if err := k8sClient.Get(context.Background(), client.ObjectKeyFromObject(cm), obj); err != nil {
+			return false
+		}
+		return strings.Contains(obj.Data["values"], "version: 15.2.1")
+	}, "userconfig is updated to the target release")
+	eventually(t, func() bool {
+		_, scheduled := getCluster(t, cluster).Annotations[targetTimeKey]
+		return !scheduled
+	}, "schedule annotations are removed")
+	assert.Equal(t, "14.2.2", getCluster(t, cluster).Labels[releaseLabel], "the release label of CAPI clusters is not changed by the operator")
+}
+
+func TestUpdateConflict(t *testing.T) {
+	fakeClock.SetTime(upgradeTime.Add(-2 * time.Hour))
+	cluster := newCluster(t, "org-conflict", false)
+	create(t, cluster)
+
+	eventually(t, func() bool {
+		return upgradeState(cluster) == controllers.UpgradeStatePending
+	}, "upgrade is pending")
+
+	stale := getCluster(t, cluster)
+	touch(t, cluster)
+
+	// A second reconciler already past the upgrade time works on the stale
+	// object and runs into a conflict.
+	r := &controllers.ClusterReconciler{
+		Client:       k8sClient,
+		Log:          ctrl.Log.WithName("conflict"),
+		Scheme:       scheme,
+		Installation: "envtest",
+		Clock:        clocktesting.NewFakeClock(upgradeTime.Add(time.Minute)),
+	}
+	_, err := r.ReconcileUpgrade(context.Background(), stale, r.Log)
+	assert.Error(t, err)
+
+	eventually(t, func() bool {
+		event, ok := events(t, cluster)[controllers.ReasonUpdateConflict]
+		return ok && event.Type == corev1.EventTypeWarning
+	}, "conflict warning is emitted")
+	assert.Equal(t, "14.2.2", getCluster(t, cluster).Labels[releaseLabel], "conflicting update is not applied")
+}
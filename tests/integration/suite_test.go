@@ -0,0 +1,298 @@
+//go:build integration
+
+// Package integration runs the operator against a real API server started by
+// envtest. Run it with make test-integration.
+package integration
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	clocktesting "k8s.io/utils/clock/testing"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+
+	upgradev1alpha1 "github.com/giantswarm/upgrade-schedule-operator/api/v1alpha1"
+	"github.com/giantswarm/upgrade-schedule-operator/controllers"
+	"github.com/giantswarm/upgrade-schedule-operator/util/record"
+)
+
+const (
+	timeout  = 10 * time.Second
+	interval = 100 * time.Millisecond
+
+	// capiCRDPathEnv overrides the directory the Cluster API CRDs are
+	// loaded from.
+	capiCRDPathEnv = "CAPI_CRD_PATH"
+)
+
+var (
+	scheme = runtime.NewScheme()
+
+	k8sClient client.Client
+	fakeClock *clocktesting.FakeClock
+	upgrades  *controllers.UpgradeStore
+)
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(capi.AddToScheme(scheme))
+	utilruntime.Must(upgradev1alpha1.AddToScheme(scheme))
+}
+
+func TestMain(m *testing.M) {
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		// CI has to run the tests instead of passing without them.
+		if os.Getenv("CI") != "" {
+			fmt.Fprintln(os.Stderr, "KUBEBUILDER_ASSETS is not set. Run make test-integration.")
+			os.Exit(1)
+		}
+		fmt.Println("Skipping integration tests because KUBEBUILDER_ASSETS is not set. Run make test-integration.")
+		os.Exit(0)
+	}
+
+	ctrl.SetLogger(zap.New(zap.UseDevMode(true), zap.WriteTo(os.Stderr)))
+
+	crdPath, err := capiCRDPath()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	testEnv := &envtest.Environment{
+		CRDInstallOptions: envtest.CRDInstallOptions{
+			Paths: []string{
+				filepath.Join(crdPath, "cluster.x-k8s.io_clusters.yaml"),
+				filepath.Join("..", "..", "helm", "upgrade-schedule-operator", "crds"),
+			},
+		},
+		ErrorIfCRDPathMissing: true,
+	}
+	cfg, err := testEnv.Start()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to start test environment:", err)
+		os.Exit(1)
+	}
+
+	code := run(m, cfg)
+
+	if err := testEnv.Stop(); err != nil {
+		fmt.Fprintln(os.Stderr, "failed to stop test environment:", err)
+	}
+	os.Exit(code)
+}
+
+// run starts the manager with the reconciler the same way main does and runs
+// the tests against it.
+func run(m *testing.M, restConfig *rest.Config) int {
+	mgr, err := ctrl.NewManager(restConfig, ctrl.Options{
+		Scheme: scheme,
+		Metrics: metricsserver.Options{
+			BindAddress: "0",
+		},
+		HealthProbeBindAddress: "0",
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to create manager:", err)
+		return 1
+	}
+
+	record.InitFromRecorder(mgr.GetEventRecorderFor("cluster-controller"))
+
+	fakeClock = clocktesting.NewFakeClock(time.Date(2025, 3, 12, 10, 0, 0, 0, time.UTC))
+	upgrades = controllers.NewUpgradeStore(fakeClock)
+	err = (&controllers.ClusterReconciler{
+		Client:       mgr.GetClient(),
+		Log:          ctrl.Log.WithName("controllers").WithName("Cluster"),
+		Scheme:       mgr.GetScheme(),
+		Installation: "envtest",
+		Upgrades:     upgrades,
+		Clock:        fakeClock,
+	}).SetupWithManager(mgr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to set up reconciler:", err)
+		return 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- mgr.Start(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	k8sClient, err = client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to create client:", err)
+		return 1
+	}
+
+	return m.Run()
+}
+
+// capiCRDPath returns the directory containing the Cluster API CRDs of the
+// Cluster API module version used by the operator.
+func capiCRDPath() (string, error) {
+	if path := os.Getenv(capiCRDPathEnv); path != "" {
+		return path, nil
+	}
+
+	out, err := exec.Command("go", "list", "-m", "-f", "{{.Dir}}", "sigs.k8s.io/cluster-api").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the cluster-api module, set %s: %w", capiCRDPathEnv, err)
+	}
+	return filepath.Join(strings.TrimSpace(string(out)), "config", "crd", "bases"), nil
+}
+
+// eventually polls condition until it returns true or the timeout expires.
+func eventually(t *testing.T, condition func() bool, msgAndArgs ...interface{}) {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if condition() {
+			return
+		}
+		time.Sleep(interval)
+	}
+	t.Fatal(append([]interface{}{"condition not met within", timeout, ":"}, msgAndArgs...)...)
+}
+
+// consistently fails if condition returns false within the given duration.
+func consistently(t *testing.T, duration time.Duration, condition func() bool, msgAndArgs ...interface{}) {
+	t.Helper()
+
+	deadline := time.Now().Add(duration)
+	for time.Now().Before(deadline) {
+		if !condition() {
+			t.Fatal(append([]interface{}{"condition not met:"}, msgAndArgs...)...)
+		}
+		time.Sleep(interval)
+	}
+}
+
+func createNamespace(t *testing.T, name string) {
+	t.Helper()
+
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	if err := k8sClient.Create(context.Background(), ns); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// touch changes an unrelated annotation of the cluster to trigger a reconcile
+// after the fake clock was advanced.
+func touch(t *testing.T, cluster *capi.Cluster) {
+	t.Helper()
+
+	obj := getCluster(t, cluster)
+	patch := client.MergeFrom(obj.DeepCopy())
+	if obj.Annotations == nil {
+		obj.Annotations = map[string]string{}
+	}
+	obj.Annotations["test.giantswarm.io/touched"] = time.Now().Format(time.RFC3339Nano)
+	if err := k8sClient.Patch(context.Background(), obj, patch); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func getCluster(t *testing.T, cluster *capi.Cluster) *capi.Cluster {
+	t.Helper()
+
+	obj := &capi.Cluster{}
+	if err := k8sClient.Get(context.Background(), client.ObjectKeyFromObject(cluster), obj); err != nil {
+		t.Fatal(err)
+	}
+	return obj
+}
+
+// clusterSeries returns the values of the series of the collector for the
+// cluster by their remaining labels, e.g. reason=,state=none. Series of
+// other clusters are left out.
+func clusterSeries(t *testing.T, c prometheus.Collector, cluster *capi.Cluster) map[string]float64 {
+	t.Helper()
+
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(c)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	series := map[string]float64{}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			var labels []string
+			own := 0
+			for _, label := range metric.GetLabel() {
+				switch {
+				case label.GetName() == "installation" && label.GetValue() == "envtest",
+					label.GetName() == "cluster_id" && label.GetValue() == cluster.Name,
+					label.GetName() == "cluster_namespace" && label.GetValue() == cluster.Namespace:
+					own++
+				default:
+					labels = append(labels, label.GetName()+"="+label.GetValue())
+				}
+			}
+			if own != 3 {
+				continue
+			}
+			value := metric.GetGauge().GetValue()
+			if metric.GetCounter() != nil {
+				value = metric.GetCounter().GetValue()
+			}
+			series[strings.Join(labels, ",")] = value
+		}
+	}
+	return series
+}
+
+// activeSeries returns the series with a value other than 0, e.g. the state
+// of a cluster.
+func activeSeries(series map[string]float64) map[string]float64 {
+	active := map[string]float64{}
+	for labels, value := range series {
+		if value != 0 {
+			active[labels] = value
+		}
+	}
+	return active
+}
+
+// events returns the events emitted for the cluster by reason.
+func events(t *testing.T, cluster *capi.Cluster) map[string]corev1.Event {
+	t.Helper()
+
+	list := &corev1.EventList{}
+	if err := k8sClient.List(context.Background(), list, client.InNamespace(cluster.Namespace)); err != nil {
+		t.Fatal(err)
+	}
+
+	reasons := map[string]corev1.Event{}
+	for _, event := range list.Items {
+		if event.InvolvedObject.Kind == "Cluster" && event.InvolvedObject.Name == cluster.Name {
+			reasons[event.Reason] = event
+		}
+	}
+	return reasons
+}
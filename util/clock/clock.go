@@ -0,0 +1,38 @@
+// Package clock implements the clocks used by the operator.
+package clock
+
+import (
+	"time"
+
+	"k8s.io/utils/clock"
+)
+
+// New returns the real clock, or a clock running at the given offset from
+// the real clock if the offset is not zero.
+func New(offset time.Duration) clock.PassiveClock {
+	if offset == 0 {
+		return clock.RealClock{}
+	}
+	return OffsetClock{
+		PassiveClock: clock.RealClock{},
+		Offset:       offset,
+	}
+}
+
+// OffsetClock is a clock running at a fixed offset from the wrapped clock. It
+// is meant for debugging only, e.g. to run through the lifecycle of a
+// scheduled upgrade on a test installation without waiting for it.
+type OffsetClock struct {
+	clock.PassiveClock
+	Offset time.Duration
+}
+
+// Now returns the current time of the wrapped clock shifted by the offset.
+func (c OffsetClock) Now() time.Time {
+	return c.PassiveClock.Now().Add(c.Offset)
+}
+
+// Since returns the time elapsed since t according to Now.
+func (c OffsetClock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
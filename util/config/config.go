@@ -0,0 +1,227 @@
+// Package config loads the versioned config file of the operator.
+package config
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// APIVersion is the version of the config file.
+	APIVersion = "config.upgrade-schedule-operator.giantswarm.io/v1alpha1"
+	// Kind is the kind of the config file.
+	Kind = "OperatorConfig"
+
+	// legacyAPIVersion and legacyKind are the version and kind of the
+	// ControllerManagerConfig file generated by kubebuilder, which only
+	// contains the manager settings.
+	legacyAPIVersion = "controller-runtime.sigs.k8s.io/v1alpha1"
+	legacyKind       = "ControllerManagerConfig"
+
+	// reloadInterval is how often the config file is checked for changes.
+	reloadInterval = 30 * time.Second
+)
+
+// OperatorConfig is the config file of the operator. The manager settings
+// are applied at startup only, the operator settings are reloaded when the
+// file changes.
+type OperatorConfig struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+
+	Health         Health         `json:"health"`
+	Metrics        Metrics        `json:"metrics"`
+	Webhook        Webhook        `json:"webhook"`
+	LeaderElection LeaderElection `json:"leaderElection"`
+
+	Operator Operator `json:"operator"`
+}
+
+type Health struct {
+	HealthProbeBindAddress string `json:"healthProbeBindAddress,omitempty"`
+}
+
+type Metrics struct {
+	BindAddress string `json:"bindAddress,omitempty"`
+}
+
+type Webhook struct {
+	Port int `json:"port,omitempty"`
+}
+
+type LeaderElection struct {
+	LeaderElect  bool   `json:"leaderElect,omitempty"`
+	ResourceName string `json:"resourceName,omitempty"`
+}
+
+// Operator are the settings of the operator which can be reloaded. They are
+// plain values, the operator maps them onto its settings.
+type Operator struct {
+	// AnnouncementOffset is how long before the upgrade time the upgrade
+	// is announced.
+	AnnouncementOffset metav1.Duration `json:"announcementOffset,omitempty"`
+	// BusinessHours are the hours of the weekdays, in UTC, the contact is
+	// not named in the announcement of upgrades during.
+	BusinessHours BusinessHours `json:"businessHours,omitempty"`
+	// Contact is named in the announcement of upgrades outside of the
+	// business hours.
+	Contact string `json:"contact"`
+	// RequeueInterval is how often upgrades held back by the emergency stop
+	// or the concurrency limit of their upgrade policy are retried.
+	RequeueInterval metav1.Duration `json:"requeueInterval,omitempty"`
+}
+
+type BusinessHours struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Default returns the config used without config file.
+func Default() *OperatorConfig {
+	return &OperatorConfig{
+		APIVersion: APIVersion,
+		Kind:       Kind,
+		Health:     Health{HealthProbeBindAddress: ":8081"},
+		Metrics:    Metrics{BindAddress: ":8080"},
+		Webhook:    Webhook{Port: 9443},
+		LeaderElection: LeaderElection{
+			ResourceName: "190fff4f.giantswarm",
+		},
+		Operator: Operator{
+			AnnouncementOffset: metav1.Duration{Duration: 15 * time.Minute},
+			BusinessHours:      BusinessHours{Start: 8, End: 16},
+			Contact:            "kaascloud@giantswarm.io",
+			RequeueInterval:    metav1.Duration{Duration: time.Minute},
+		},
+	}
+}
+
+// Load reads and validates the config file. Settings missing in the file
+// keep their defaults.
+func Load(path string) (*OperatorConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading config file %s", path)
+	}
+	c, err := Parse(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "config file %s", path)
+	}
+	return c, nil
+}
+
+// Parse parses and validates the content of a config file.
+func Parse(data []byte) (*OperatorConfig, error) {
+	c := Default()
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return nil, errors.Wrap(err, "parsing config")
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Validate returns an error if the config can not be used.
+func (c *OperatorConfig) Validate() error {
+	switch {
+	case c.APIVersion == APIVersion && c.Kind == Kind:
+	case c.APIVersion == legacyAPIVersion && c.Kind == legacyKind:
+	default:
+		return errors.Errorf("unsupported config %s %s, it has to be %s %s", c.APIVersion, c.Kind, APIVersion, Kind)
+	}
+	if c.Webhook.Port < 1 || c.Webhook.Port > 65535 {
+		return errors.Errorf("webhook port %d is invalid", c.Webhook.Port)
+	}
+	if c.LeaderElection.ResourceName == "" {
+		return errors.New("leader election resource name must not be empty")
+	}
+	return errors.Wrap(c.Operator.Validate(), "invalid operator settings")
+}
+
+// Validate returns an error if the operator settings can not be used.
+func (o Operator) Validate() error {
+	if o.AnnouncementOffset.Duration <= 0 {
+		return errors.Errorf("announcement offset %v has to be positive", o.AnnouncementOffset.Duration)
+	}
+	if o.BusinessHours.Start < 0 || o.BusinessHours.End > 24 || o.BusinessHours.Start >= o.BusinessHours.End {
+		return errors.Errorf("business hours %d to %d have to be within 0 to 24 and start before they end", o.BusinessHours.Start, o.BusinessHours.End)
+	}
+	if o.RequeueInterval.Duration < time.Second {
+		return errors.Errorf("requeue interval %v has to be at least 1s", o.RequeueInterval.Duration)
+	}
+	return nil
+}
+
+// Watcher reloads the operator settings when the config file changes. It is
+// a manager runnable.
+type Watcher struct {
+	path     string
+	current  *OperatorConfig
+	onChange func(Operator)
+	log      logr.Logger
+}
+
+// NewWatcher creates a Watcher of the config file loaded as current, calling
+// onChange with the new settings when valid operator settings are loaded.
+func NewWatcher(path string, current *OperatorConfig, onChange func(Operator), log logr.Logger) *Watcher {
+	return &Watcher{path: path, current: current, onChange: onChange, log: log}
+}
+
+// NeedLeaderElection returns false, all replicas have to use the same
+// settings.
+func (w *Watcher) NeedLeaderElection() bool {
+	return false
+}
+
+// Start checks the config file for changes until the context is done. Files
+// of mounted ConfigMaps are replaced rather than modified, so the content is
+// compared instead of watching file events.
+func (w *Watcher) Start(ctx context.Context) error {
+	last, _ := os.ReadFile(w.path)
+	ticker := time.NewTicker(reloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		data, err := os.ReadFile(w.path)
+		if err != nil {
+			w.log.Error(err, "Failed to read the config file, keeping the current settings.", "path", w.path)
+			continue
+		}
+		if bytes.Equal(data, last) {
+			continue
+		}
+		last = data
+		w.reload(data)
+	}
+}
+
+// reload applies the operator settings of the changed config file. Changes of
+// the manager settings are only applied on restart.
+func (w *Watcher) reload(data []byte) {
+	c, err := Parse(data)
+	if err != nil {
+		w.log.Error(err, "Invalid config file, keeping the current settings.", "path", w.path)
+		return
+	}
+	if c.Health != w.current.Health || c.Metrics != w.current.Metrics || c.Webhook != w.current.Webhook || c.LeaderElection != w.current.LeaderElection {
+		w.log.Info("The manager settings of the config file changed, restart the operator to apply them.", "path", w.path)
+	}
+	if c.Operator != w.current.Operator {
+		w.log.Info("Reloaded the operator settings of the config file.", "path", w.path)
+		w.onChange(c.Operator)
+	}
+	w.current.Operator = c.Operator
+}
@@ -0,0 +1,152 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		name             string
+		data             string
+		expectedOperator Operator
+		expectedPort     int
+		expectedErr      string
+	}{
+		{
+			name: "case 0: operator config",
+			data: `apiVersion: config.upgrade-schedule-operator.giantswarm.io/v1alpha1
+kind: OperatorConfig
+webhook:
+  port: 9444
+operator:
+  announcementOffset: 1h
+  businessHours:
+    start: 9
+    end: 17
+  contact: oncall@example.com
+  requeueInterval: 30s
+`,
+			expectedOperator: Operator{
+				AnnouncementOffset: metav1.Duration{Duration: time.Hour},
+				BusinessHours:      BusinessHours{Start: 9, End: 17},
+				Contact:            "oncall@example.com",
+				RequeueInterval:    metav1.Duration{Duration: 30 * time.Second},
+			},
+			expectedPort: 9444,
+		},
+		{
+			name: "case 1: defaults",
+			data: `apiVersion: config.upgrade-schedule-operator.giantswarm.io/v1alpha1
+kind: OperatorConfig
+`,
+			expectedOperator: Default().Operator,
+			expectedPort:     9443,
+		},
+		{
+			name: "case 2: ControllerManagerConfig",
+			data: `apiVersion: controller-runtime.sigs.k8s.io/v1alpha1
+kind: ControllerManagerConfig
+health:
+  healthProbeBindAddress: :8081
+metrics:
+  bindAddress: 127.0.0.1:8080
+webhook:
+  port: 9443
+leaderElection:
+  leaderElect: true
+  resourceName: 190fff4f.giantswarm
+`,
+			expectedOperator: Default().Operator,
+			expectedPort:     9443,
+		},
+		{
+			name: "case 3: unsupported version",
+			data: `apiVersion: config.upgrade-schedule-operator.giantswarm.io/v2
+kind: OperatorConfig
+`,
+			expectedErr: "unsupported config config.upgrade-schedule-operator.giantswarm.io/v2 OperatorConfig, it has to be config.upgrade-schedule-operator.giantswarm.io/v1alpha1 OperatorConfig",
+		},
+		{
+			name: "case 4: unknown field",
+			data: `apiVersion: config.upgrade-schedule-operator.giantswarm.io/v1alpha1
+kind: OperatorConfig
+operator:
+  announcementOfset: 1h
+`,
+			expectedErr: `parsing config: error unmarshaling JSON: while decoding JSON: json: unknown field "announcementOfset"`,
+		},
+		{
+			name: "case 5: invalid business hours",
+			data: `apiVersion: config.upgrade-schedule-operator.giantswarm.io/v1alpha1
+kind: OperatorConfig
+operator:
+  businessHours:
+    start: 17
+    end: 9
+`,
+			expectedErr: "invalid operator settings: business hours 17 to 9 have to be within 0 to 24 and start before they end",
+		},
+		{
+			name: "case 6: invalid webhook port",
+			data: `apiVersion: config.upgrade-schedule-operator.giantswarm.io/v1alpha1
+kind: OperatorConfig
+webhook:
+  port: 99999
+`,
+			expectedErr: "webhook port 99999 is invalid",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := Parse([]byte(tc.data))
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedOperator, c.Operator)
+			assert.Equal(t, tc.expectedPort, c.Webhook.Port)
+		})
+	}
+}
+
+func TestWatcherReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	initial := `apiVersion: config.upgrade-schedule-operator.giantswarm.io/v1alpha1
+kind: OperatorConfig
+`
+	assert.NoError(t, os.WriteFile(path, []byte(initial), 0o600))
+	current, err := Load(path)
+	assert.NoError(t, err)
+
+	var reloaded []Operator
+	w := NewWatcher(path, current, func(operator Operator) {
+		reloaded = append(reloaded, operator)
+	}, logr.Discard())
+
+	// Invalid files are ignored.
+	w.reload([]byte(initial + "operator:\n  requeueInterval: 1ms\n"))
+	assert.Empty(t, reloaded)
+
+	// Changes of the manager settings only are not applied.
+	w.reload([]byte(initial + "webhook:\n  port: 9444\n"))
+	assert.Empty(t, reloaded)
+	assert.Equal(t, 9443, w.current.Webhook.Port)
+
+	w.reload([]byte(initial + "operator:\n  announcementOffset: 30m\n"))
+	if assert.Len(t, reloaded, 1) {
+		assert.Equal(t, 30*time.Minute, reloaded[0].AnnouncementOffset.Duration)
+	}
+
+	// Unchanged operator settings are not applied again.
+	w.reload([]byte(initial + "operator:\n  announcementOffset: 30m\nwebhook:\n  port: 9444\n"))
+	assert.Len(t, reloaded, 1)
+}
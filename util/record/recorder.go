@@ -28,22 +28,55 @@ func InitFromRecorder(recorder record.EventRecorder) {
 	})
 }
 
+// Recorder records events with its EventRecorder, e.g. of the objects of
+// another cluster. The zero value records with the global default recorder.
+type Recorder struct {
+	record.EventRecorder
+}
+
+func (r Recorder) recorder() record.EventRecorder {
+	if r.EventRecorder == nil {
+		return defaultRecorder
+	}
+	return r.EventRecorder
+}
+
+// Event constructs an event from the given information and puts it in the queue for sending.
+func (r Recorder) Event(object runtime.Object, reason, message string) {
+	r.recorder().Event(object, corev1.EventTypeNormal, cases.Title(language.Und, cases.NoLower).String(reason), message)
+}
+
+// Eventf is just like Event, but with Sprintf for the message field.
+func (r Recorder) Eventf(object runtime.Object, reason, message string, args ...interface{}) {
+	r.recorder().Eventf(object, corev1.EventTypeNormal, cases.Title(language.Und, cases.NoLower).String(reason), message, args...)
+}
+
+// Warn constructs a warning event from the given information and puts it in the queue for sending.
+func (r Recorder) Warn(object runtime.Object, reason, message string) {
+	r.recorder().Event(object, corev1.EventTypeWarning, cases.Title(language.Und, cases.NoLower).String(reason), message)
+}
+
+// Warnf is just like Warn, but with Sprintf for the message field.
+func (r Recorder) Warnf(object runtime.Object, reason, message string, args ...interface{}) {
+	r.recorder().Eventf(object, corev1.EventTypeWarning, cases.Title(language.Und, cases.NoLower).String(reason), message, args...)
+}
+
 // Event constructs an event from the given information and puts it in the queue for sending.
 func Event(object runtime.Object, reason, message string) {
-	defaultRecorder.Event(object, corev1.EventTypeNormal, cases.Title(language.Und, cases.NoLower).String(reason), message)
+	Recorder{}.Event(object, reason, message)
 }
 
 // Eventf is just like Event, but with Sprintf for the message field.
 func Eventf(object runtime.Object, reason, message string, args ...interface{}) {
-	defaultRecorder.Eventf(object, corev1.EventTypeNormal, cases.Title(language.Und, cases.NoLower).String(reason), message, args...)
+	Recorder{}.Eventf(object, reason, message, args...)
 }
 
 // Warn constructs a warning event from the given information and puts it in the queue for sending.
 func Warn(object runtime.Object, reason, message string) {
-	defaultRecorder.Event(object, corev1.EventTypeWarning, cases.Title(language.Und, cases.NoLower).String(reason), message)
+	Recorder{}.Warn(object, reason, message)
 }
 
 // Warnf is just like Warn, but with Sprintf for the message field.
 func Warnf(object runtime.Object, reason, message string, args ...interface{}) {
-	defaultRecorder.Eventf(object, corev1.EventTypeWarning, cases.Title(language.Und, cases.NoLower).String(reason), message, args...)
+	Recorder{}.Warnf(object, reason, message, args...)
 }
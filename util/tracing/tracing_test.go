@@ -0,0 +1,79 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+)
+
+func TestTracesURL(t *testing.T) {
+	testCases := []struct {
+		name        string
+		endpoint    string
+		expected    string
+		expectedErr bool
+	}{
+		{
+			name:     "case 0: endpoint without path",
+			endpoint: "http://tempo.monitoring:4318",
+			expected: "http://tempo.monitoring:4318/v1/traces",
+		},
+		{
+			name:     "case 1: endpoint with root path",
+			endpoint: "https://tempo.monitoring:4318/",
+			expected: "https://tempo.monitoring:4318/v1/traces",
+		},
+		{
+			name:     "case 2: endpoint with path",
+			endpoint: "http://collector.monitoring:4318/otlp/v1/traces",
+			expected: "http://collector.monitoring:4318/otlp/v1/traces",
+		},
+		{
+			name:        "case 3: endpoint without scheme",
+			endpoint:    "tempo.monitoring:4318",
+			expectedErr: true,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+			u, err := tracesURL(tc.endpoint)
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, u)
+		})
+	}
+}
+
+func TestSetup(t *testing.T) {
+	paths := make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		paths <- req.URL.Path
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	shutdown, err := Setup(ctx, srv.URL, "gauss")
+	assert.NoError(t, err)
+
+	_, span := otel.Tracer("test").Start(ctx, "Reconcile")
+	span.End()
+	assert.NoError(t, shutdown(ctx))
+
+	select {
+	case path := <-paths:
+		assert.Equal(t, "/v1/traces", path)
+	default:
+		t.Fatal("no spans were exported")
+	}
+}
@@ -0,0 +1,196 @@
+// Package webhooks implements the admission webhooks of the operator.
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/utils/clock"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/giantswarm/upgrade-schedule-operator/controllers"
+)
+
+// AuditPath is the path the audit webhook is served on.
+const AuditPath = "/mutate-cluster-x-k8s-io-v1beta1-cluster-audit"
+
+// ClusterAuditor is a mutating webhook recording who scheduled, changed,
+// cancelled or approved the upgrade of a cluster. It sets the requested by,
+// changed by and scheduled at annotations on the cluster, keeps users from
+// setting them or the approvals of others and writes every attempted change
+// to the audit sink. The operator records the change in the audit trail of the history
+// ConfigMap of the cluster once it was persisted. The webhook only rejects
+// approvals on behalf of others and approvals by the requester.
+type ClusterAuditor struct {
+	Log logr.Logger
+	// Sink receives the audit records of the attempted changes. It is
+	// optional.
+	Sink *controllers.AuditSink
+	// Clock defaults to the real clock.
+	Clock clock.PassiveClock
+}
+
+// Handle records attempted changes of the schedule of a cluster, sets the
+// identities of the change and validates approvals.
+func (a *ClusterAuditor) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionv1.Create && req.Operation != admissionv1.Update {
+		return admission.Allowed("")
+	}
+
+	cluster := &clusterv1.Cluster{}
+	if err := json.Unmarshal(req.Object.Raw, cluster); err != nil {
+		return admission.Errored(http.StatusBadRequest, errors.Wrap(err, "failed to decode cluster"))
+	}
+	if cluster.Namespace == "" {
+		cluster.Namespace = req.Namespace
+	}
+	oldCluster := &clusterv1.Cluster{}
+	if len(req.OldObject.Raw) > 0 {
+		if err := json.Unmarshal(req.OldObject.Raw, oldCluster); err != nil {
+			return admission.Errored(http.StatusBadRequest, errors.Wrap(err, "failed to decode old cluster"))
+		}
+	}
+
+	before, after := controllers.AuditScheduleOf(oldCluster), controllers.AuditScheduleOf(cluster)
+	action := controllers.AuditAction(before, after)
+	if action == controllers.AuditActionApproved {
+		for _, approver := range controllers.AddedApprovers(before, after) {
+			if approver != req.UserInfo.Username {
+				return admission.Denied(fmt.Sprintf("%s can not approve the upgrade on behalf of %s", req.UserInfo.Username, approver))
+			}
+		}
+		if requester := oldCluster.Annotations[controllers.ClusterUpgradeRequestedBy]; requester == req.UserInfo.Username {
+			return admission.Denied(fmt.Sprintf("%s can not approve the upgrade they scheduled", requester))
+		}
+	}
+
+	if action != "" {
+		a.audit(req, cluster, action, before, after)
+	}
+
+	obj := &unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON(req.Object.Raw); err != nil {
+		return admission.Errored(http.StatusBadRequest, errors.Wrap(err, "failed to decode cluster"))
+	}
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	// The identities are always taken from the user info of the request or
+	// kept from the old cluster, so that they can not be forged.
+	user := req.UserInfo.Username
+	if action == "" {
+		restore(annotations, oldCluster, controllers.ClusterUpgradeChangedBy)
+	} else {
+		annotations[controllers.ClusterUpgradeChangedBy] = user
+	}
+	switch action {
+	case controllers.AuditActionScheduled, controllers.AuditActionChanged:
+		annotations[controllers.ClusterUpgradeRequestedBy] = user
+		// Approvals are given for a schedule, changing it revokes them.
+		delete(annotations, controllers.ClusterUpgradeApprovedBy)
+		// The notice of an upgrade counts from the time its upgrade time
+		// was set.
+		if action == controllers.AuditActionScheduled || before.UpgradeTime != after.UpgradeTime {
+			annotations[controllers.ClusterUpgradeScheduledAt] = a.now().Format(time.RFC3339)
+		} else {
+			restore(annotations, oldCluster, controllers.ClusterUpgradeScheduledAt)
+		}
+	case controllers.AuditActionCancelled, controllers.AuditActionTriggered:
+		delete(annotations, controllers.ClusterUpgradeRequestedBy)
+		delete(annotations, controllers.ClusterUpgradeApprovedBy)
+		delete(annotations, controllers.ClusterUpgradeScheduledAt)
+	default:
+		restore(annotations, oldCluster, controllers.ClusterUpgradeRequestedBy)
+		restore(annotations, oldCluster, controllers.ClusterUpgradeScheduledAt)
+		setApprovers(annotations, approvals(before.ApprovedBy, after.ApprovedBy, user))
+	}
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	obj.SetAnnotations(annotations)
+	modified, err := obj.MarshalJSON()
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, errors.WithStack(err))
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, modified)
+}
+
+// audit writes the record of the attempted change to the sink. Dry runs are
+// not recorded.
+func (a *ClusterAuditor) audit(req admission.Request, cluster *clusterv1.Cluster, action string, before controllers.AuditSchedule, after controllers.AuditSchedule) {
+	if a.Sink == nil || (req.DryRun != nil && *req.DryRun) {
+		return
+	}
+	record := controllers.AuditRecord{
+		Time:                  a.now().Format(time.RFC3339),
+		Cluster:               cluster.Name,
+		Namespace:             cluster.Namespace,
+		Action:                action,
+		User:                  req.UserInfo.Username,
+		Groups:                req.UserInfo.Groups,
+		TargetVersion:         after.TargetVersion,
+		UpgradeTime:           after.UpgradeTime,
+		PreviousTargetVersion: before.TargetVersion,
+		PreviousUpgradeTime:   before.UpgradeTime,
+		ApprovedBy:            after.ApprovedBy,
+		Attempt:               true,
+	}
+	if err := a.Sink.Write(record); err != nil {
+		a.Log.Error(err, "Failed to write audit record.", "cluster", cluster.Name, "namespace", cluster.Namespace)
+	}
+}
+
+// restore sets the annotation to its value on the old cluster.
+func restore(annotations map[string]string, oldCluster *clusterv1.Cluster, key string) {
+	if value, ok := oldCluster.Annotations[key]; ok {
+		annotations[key] = value
+	} else {
+		delete(annotations, key)
+	}
+}
+
+// approvals returns the approvers of the old cluster with the approval of
+// the user added or removed as requested. Users can only give or revoke their
+// own approval.
+func approvals(before []string, after []string, user string) []string {
+	approvers := slices.DeleteFunc(slices.Clone(before), func(approver string) bool {
+		return approver == user
+	})
+	if slices.Contains(after, user) {
+		approvers = append(approvers, user)
+		sort.Strings(approvers)
+	}
+	return approvers
+}
+
+// setApprovers sets the approved by annotation to the approvers. The
+// annotation is left alone if it lists them already.
+func setApprovers(annotations map[string]string, approvers []string) {
+	if slices.Equal(approvers, controllers.ParseApprovers(annotations[controllers.ClusterUpgradeApprovedBy])) {
+		return
+	}
+	if len(approvers) == 0 {
+		delete(annotations, controllers.ClusterUpgradeApprovedBy)
+		return
+	}
+	annotations[controllers.ClusterUpgradeApprovedBy] = strings.Join(approvers, ",")
+}
+
+func (a *ClusterAuditor) now() time.Time {
+	if a.Clock == nil {
+		return time.Now().UTC()
+	}
+	return a.Clock.Now().UTC()
+}
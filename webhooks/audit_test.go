@@ -0,0 +1,392 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clocktesting "k8s.io/utils/clock/testing"
+	"k8s.io/utils/ptr"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/giantswarm/upgrade-schedule-operator/controllers"
+)
+
+func newCluster(annotations map[string]string) *capi.Cluster {
+	return &capi.Cluster{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "cluster.x-k8s.io/v1beta1",
+			Kind:       "Cluster",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "dh82p",
+			Namespace:   "org-acme",
+			Annotations: annotations,
+		},
+	}
+}
+
+func TestClusterAuditor(t *testing.T) {
+	scheduled := map[string]string{
+		"alpha.giantswarm.io/update-schedule-target-release": "15.2.1",
+		"alpha.giantswarm.io/update-schedule-target-time":    "12 Mar 25 12:00 UTC",
+	}
+	rescheduled := map[string]string{
+		"alpha.giantswarm.io/update-schedule-target-release": "15.2.1",
+		"alpha.giantswarm.io/update-schedule-target-time":    "13 Mar 25 12:00 UTC",
+		controllers.ClusterUpgradeRequestedBy:                "jane@acme.com",
+		controllers.ClusterUpgradeScheduledAt:                "2025-03-01T12:00:00Z",
+	}
+	requested := map[string]string{
+		"alpha.giantswarm.io/update-schedule-target-release": "15.2.1",
+		"alpha.giantswarm.io/update-schedule-target-time":    "12 Mar 25 12:00 UTC",
+		controllers.ClusterUpgradeRequestedBy:                "jane@acme.com",
+		controllers.ClusterUpgradeScheduledAt:                "2025-03-01T12:00:00Z",
+	}
+	approved := map[string]string{
+		"alpha.giantswarm.io/update-schedule-target-release": "15.2.1",
+		"alpha.giantswarm.io/update-schedule-target-time":    "12 Mar 25 12:00 UTC",
+		controllers.ClusterUpgradeRequestedBy:                "jane@acme.com",
+		controllers.ClusterUpgradeApprovedBy:                 "john@acme.com",
+		controllers.ClusterUpgradeScheduledAt:                "2025-03-01T12:00:00Z",
+	}
+	triggered := map[string]string{
+		controllers.ClusterUpgradeInProgress: `{"origin":"14.2.2","target":"15.2.1"}`,
+	}
+
+	testCases := []struct {
+		name           string
+		operation      admissionv1.Operation
+		old            *capi.Cluster
+		new            *capi.Cluster
+		user           string
+		dryRun         bool
+		expectedDenied bool
+		expectedAction string
+		// expectedIdentities are the requested by, approved by, changed by
+		// and scheduled at annotations of the admitted cluster.
+		expectedIdentities map[string]string
+	}{
+		{
+			name:           "case 0: schedule on create",
+			operation:      admissionv1.Create,
+			new:            newCluster(scheduled),
+			expectedAction: controllers.AuditActionScheduled,
+			expectedIdentities: map[string]string{
+				controllers.ClusterUpgradeRequestedBy: "john@acme.com",
+				controllers.ClusterUpgradeChangedBy:   "john@acme.com",
+				controllers.ClusterUpgradeScheduledAt: "2025-03-11T12:00:00Z",
+			},
+		},
+		{
+			name:           "case 1: schedule on update",
+			operation:      admissionv1.Update,
+			old:            newCluster(nil),
+			new:            newCluster(scheduled),
+			expectedAction: controllers.AuditActionScheduled,
+			expectedIdentities: map[string]string{
+				controllers.ClusterUpgradeRequestedBy: "john@acme.com",
+				controllers.ClusterUpgradeChangedBy:   "john@acme.com",
+				controllers.ClusterUpgradeScheduledAt: "2025-03-11T12:00:00Z",
+			},
+		},
+		{
+			name:           "case 2: reschedule",
+			operation:      admissionv1.Update,
+			old:            newCluster(requested),
+			new:            newCluster(rescheduled),
+			expectedAction: controllers.AuditActionChanged,
+			expectedIdentities: map[string]string{
+				controllers.ClusterUpgradeRequestedBy: "john@acme.com",
+				controllers.ClusterUpgradeChangedBy:   "john@acme.com",
+				controllers.ClusterUpgradeScheduledAt: "2025-03-11T12:00:00Z",
+			},
+		},
+		{
+			name:           "case 3: cancel",
+			operation:      admissionv1.Update,
+			old:            newCluster(requested),
+			new:            newCluster(map[string]string{controllers.ClusterUpgradeRequestedBy: "jane@acme.com"}),
+			expectedAction: controllers.AuditActionCancelled,
+			expectedIdentities: map[string]string{
+				controllers.ClusterUpgradeChangedBy: "john@acme.com",
+			},
+		},
+		{
+			name:           "case 4: trigger",
+			operation:      admissionv1.Update,
+			old:            newCluster(approved),
+			new:            newCluster(triggered),
+			expectedAction: controllers.AuditActionTriggered,
+			expectedIdentities: map[string]string{
+				controllers.ClusterUpgradeChangedBy: "john@acme.com",
+			},
+		},
+		{
+			name:      "case 5: unrelated change",
+			operation: admissionv1.Update,
+			old:       newCluster(requested),
+			new:       newCluster(requested),
+			expectedIdentities: map[string]string{
+				controllers.ClusterUpgradeRequestedBy: "jane@acme.com",
+				controllers.ClusterUpgradeScheduledAt: "2025-03-01T12:00:00Z",
+			},
+		},
+		{
+			name:      "case 6: dry run",
+			operation: admissionv1.Update,
+			old:       newCluster(nil),
+			new:       newCluster(scheduled),
+			dryRun:    true,
+			expectedIdentities: map[string]string{
+				controllers.ClusterUpgradeRequestedBy: "john@acme.com",
+				controllers.ClusterUpgradeChangedBy:   "john@acme.com",
+				controllers.ClusterUpgradeScheduledAt: "2025-03-11T12:00:00Z",
+			},
+		},
+		{
+			name:           "case 7: approve",
+			operation:      admissionv1.Update,
+			old:            newCluster(requested),
+			new:            newCluster(approved),
+			expectedAction: controllers.AuditActionApproved,
+			expectedIdentities: map[string]string{
+				controllers.ClusterUpgradeRequestedBy: "jane@acme.com",
+				controllers.ClusterUpgradeApprovedBy:  "john@acme.com",
+				controllers.ClusterUpgradeChangedBy:   "john@acme.com",
+				controllers.ClusterUpgradeScheduledAt: "2025-03-01T12:00:00Z",
+			},
+		},
+		{
+			name:           "case 8: approve on behalf of another identity",
+			operation:      admissionv1.Update,
+			old:            newCluster(requested),
+			new:            newCluster(approved),
+			user:           "jim@acme.com",
+			expectedDenied: true,
+		},
+		{
+			name:      "case 9: approve own schedule",
+			operation: admissionv1.Update,
+			old: newCluster(map[string]string{
+				"alpha.giantswarm.io/update-schedule-target-release": "15.2.1",
+				"alpha.giantswarm.io/update-schedule-target-time":    "12 Mar 25 12:00 UTC",
+				controllers.ClusterUpgradeRequestedBy:                "john@acme.com",
+			}),
+			new: newCluster(map[string]string{
+				"alpha.giantswarm.io/update-schedule-target-release": "15.2.1",
+				"alpha.giantswarm.io/update-schedule-target-time":    "12 Mar 25 12:00 UTC",
+				controllers.ClusterUpgradeRequestedBy:                "john@acme.com",
+				controllers.ClusterUpgradeApprovedBy:                 "john@acme.com",
+			}),
+			expectedDenied: true,
+		},
+		{
+			name:      "case 10: revoke approval",
+			operation: admissionv1.Update,
+			old:       newCluster(approved),
+			new:       newCluster(requested),
+			expectedIdentities: map[string]string{
+				controllers.ClusterUpgradeRequestedBy: "jane@acme.com",
+				controllers.ClusterUpgradeScheduledAt: "2025-03-01T12:00:00Z",
+			},
+		},
+		{
+			name:      "case 11: reschedule revokes approvals",
+			operation: admissionv1.Update,
+			old:       newCluster(approved),
+			new: newCluster(map[string]string{
+				"alpha.giantswarm.io/update-schedule-target-release": "15.2.1",
+				"alpha.giantswarm.io/update-schedule-target-time":    "13 Mar 25 12:00 UTC",
+				controllers.ClusterUpgradeRequestedBy:                "jane@acme.com",
+				controllers.ClusterUpgradeApprovedBy:                 "john@acme.com",
+			}),
+			expectedAction: controllers.AuditActionChanged,
+			expectedIdentities: map[string]string{
+				controllers.ClusterUpgradeRequestedBy: "john@acme.com",
+				controllers.ClusterUpgradeChangedBy:   "john@acme.com",
+				controllers.ClusterUpgradeScheduledAt: "2025-03-11T12:00:00Z",
+			},
+		},
+		{
+			name:      "case 12: forge the requester",
+			operation: admissionv1.Update,
+			old:       newCluster(requested),
+			new: newCluster(map[string]string{
+				"alpha.giantswarm.io/update-schedule-target-release": "15.2.1",
+				"alpha.giantswarm.io/update-schedule-target-time":    "12 Mar 25 12:00 UTC",
+				controllers.ClusterUpgradeRequestedBy:                "jim@acme.com",
+			}),
+			expectedIdentities: map[string]string{
+				controllers.ClusterUpgradeRequestedBy: "jane@acme.com",
+				controllers.ClusterUpgradeScheduledAt: "2025-03-01T12:00:00Z",
+			},
+		},
+		{
+			name:      "case 13: forge the requester on create",
+			operation: admissionv1.Create,
+			new: newCluster(map[string]string{
+				controllers.ClusterUpgradeRequestedBy: "jim@acme.com",
+				controllers.ClusterUpgradeChangedBy:   "jim@acme.com",
+			}),
+			expectedIdentities: map[string]string{},
+		},
+		{
+			name:      "case 14: revoke the approval of another identity",
+			operation: admissionv1.Update,
+			old:       newCluster(approved),
+			new:       newCluster(requested),
+			user:      "jim@acme.com",
+			expectedIdentities: map[string]string{
+				controllers.ClusterUpgradeRequestedBy: "jane@acme.com",
+				controllers.ClusterUpgradeApprovedBy:  "john@acme.com",
+				controllers.ClusterUpgradeScheduledAt: "2025-03-01T12:00:00Z",
+			},
+		},
+		{
+			name:      "case 15: schedule with forged approvals",
+			operation: admissionv1.Update,
+			old:       newCluster(nil),
+			new: newCluster(map[string]string{
+				"alpha.giantswarm.io/update-schedule-target-release": "15.2.1",
+				"alpha.giantswarm.io/update-schedule-target-time":    "12 Mar 25 12:00 UTC",
+				controllers.ClusterUpgradeRequestedBy:                "jane@acme.com",
+				controllers.ClusterUpgradeApprovedBy:                 "jim@acme.com",
+			}),
+			expectedAction: controllers.AuditActionScheduled,
+			expectedIdentities: map[string]string{
+				controllers.ClusterUpgradeRequestedBy: "john@acme.com",
+				controllers.ClusterUpgradeChangedBy:   "john@acme.com",
+				controllers.ClusterUpgradeScheduledAt: "2025-03-11T12:00:00Z",
+			},
+		},
+		{
+			name:      "case 16: forge the scheduled at time",
+			operation: admissionv1.Update,
+			old:       newCluster(requested),
+			new: newCluster(map[string]string{
+				"alpha.giantswarm.io/update-schedule-target-release": "15.2.1",
+				"alpha.giantswarm.io/update-schedule-target-time":    "12 Mar 25 12:00 UTC",
+				controllers.ClusterUpgradeRequestedBy:                "jane@acme.com",
+				controllers.ClusterUpgradeScheduledAt:                "2025-01-01T12:00:00Z",
+			}),
+			expectedIdentities: map[string]string{
+				controllers.ClusterUpgradeRequestedBy: "jane@acme.com",
+				controllers.ClusterUpgradeScheduledAt: "2025-03-01T12:00:00Z",
+			},
+		},
+		{
+			name:      "case 17: change the target keeps the scheduled at time",
+			operation: admissionv1.Update,
+			old:       newCluster(requested),
+			new: newCluster(map[string]string{
+				"alpha.giantswarm.io/update-schedule-target-release": "15.3.0",
+				"alpha.giantswarm.io/update-schedule-target-time":    "12 Mar 25 12:00 UTC",
+				controllers.ClusterUpgradeRequestedBy:                "jane@acme.com",
+				controllers.ClusterUpgradeScheduledAt:                "2025-01-01T12:00:00Z",
+			}),
+			expectedAction: controllers.AuditActionChanged,
+			expectedIdentities: map[string]string{
+				controllers.ClusterUpgradeRequestedBy: "john@acme.com",
+				controllers.ClusterUpgradeChangedBy:   "john@acme.com",
+				controllers.ClusterUpgradeScheduledAt: "2025-03-01T12:00:00Z",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sink := &bytes.Buffer{}
+			a := &ClusterAuditor{
+				Log:   ctrl.Log.WithName("fake"),
+				Sink:  controllers.NewAuditSink(sink),
+				Clock: clocktesting.NewFakePassiveClock(time.Date(2025, 3, 11, 12, 0, 0, 0, time.UTC)),
+			}
+
+			user := tc.user
+			if user == "" {
+				user = "john@acme.com"
+			}
+			req := admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: tc.operation,
+				Namespace: "org-acme",
+				UserInfo:  authenticationv1.UserInfo{Username: user, Groups: []string{"customer:acme"}},
+				Object:    runtime.RawExtension{Raw: mustMarshal(t, tc.new)},
+				DryRun:    ptr.To(tc.dryRun),
+			}}
+			if tc.old != nil {
+				req.OldObject = runtime.RawExtension{Raw: mustMarshal(t, tc.old)}
+			}
+
+			resp := a.Handle(context.TODO(), req)
+			assert.Equal(t, !tc.expectedDenied, resp.Allowed)
+			if tc.expectedDenied {
+				assert.Empty(t, sink.String())
+				return
+			}
+
+			admitted := admittedCluster(t, req.Object.Raw, resp)
+			identities := map[string]string{}
+			for _, key := range []string{controllers.ClusterUpgradeRequestedBy, controllers.ClusterUpgradeApprovedBy, controllers.ClusterUpgradeChangedBy, controllers.ClusterUpgradeScheduledAt} {
+				if value, ok := admitted.Annotations[key]; ok {
+					identities[key] = value
+				}
+			}
+			assert.Equal(t, tc.expectedIdentities, identities)
+
+			if tc.expectedAction == "" {
+				assert.Empty(t, sink.String())
+				return
+			}
+
+			// The webhook only records the attempt, the change is recorded in
+			// the audit trail by the operator once it was persisted.
+			record := controllers.AuditRecord{}
+			assert.NoError(t, json.Unmarshal(sink.Bytes(), &record))
+			assert.Equal(t, tc.expectedAction, record.Action)
+			assert.True(t, record.Attempt)
+			assert.Equal(t, "john@acme.com", record.User)
+			assert.Equal(t, []string{"customer:acme"}, record.Groups)
+			assert.Equal(t, "org-acme", record.Namespace)
+		})
+	}
+}
+
+// admittedCluster applies the patches of the response to the cluster.
+func admittedCluster(t *testing.T, raw []byte, resp admission.Response) *capi.Cluster {
+	t.Helper()
+
+	patch, err := jsonpatch.DecodePatch(mustMarshal(t, resp.Patches))
+	if err != nil {
+		t.Fatal(err)
+	}
+	patched, err := patch.Apply(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cluster := &capi.Cluster{}
+	if err := json.Unmarshal(patched, cluster); err != nil {
+		t.Fatal(err)
+	}
+	return cluster
+}
+
+func mustMarshal(t *testing.T, obj interface{}) []byte {
+	t.Helper()
+
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}